@@ -0,0 +1,170 @@
+package mongo
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// Clock it's an interface for types telling the actual time, used to
+// calculate the created_on and updated_on values of documents.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator it's an interface for types generating the _id of new
+// documents.
+type IDGenerator interface {
+	NewID() ObjectId
+}
+
+var (
+	// defaults stores the Clock and IDGenerator used by connection.
+	defaults = struct {
+		sync.RWMutex
+		clock Clock
+		ids   IDGenerator
+	}{
+		clock: SystemClock(),
+		ids:   ObjectIdGenerator(),
+	}
+)
+
+// SetClock defines the Clock used by connection to calculate times of
+// documents. Receiving nil, it returns to use SystemClock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = SystemClock()
+	}
+
+	defaults.Lock()
+	defaults.clock = c
+	defaults.Unlock()
+}
+
+// SetIDGenerator defines the IDGenerator used by connection to create
+// ids of documents. Receiving nil, it returns to use
+// ObjectIdGenerator.
+func SetIDGenerator(g IDGenerator) {
+	if g == nil {
+		g = ObjectIdGenerator()
+	}
+
+	defaults.Lock()
+	defaults.ids = g
+	defaults.Unlock()
+}
+
+// currentClock returns the Clock used by connection.
+func currentClock() (c Clock) {
+	defaults.RLock()
+	c = defaults.clock
+	defaults.RUnlock()
+	return
+}
+
+// currentIDGenerator returns the IDGenerator used by connection.
+func currentIDGenerator() (g IDGenerator) {
+	defaults.RLock()
+	g = defaults.ids
+	defaults.RUnlock()
+	return
+}
+
+// inMilli returns time t as int64 value in Millisecond unit.
+func inMilli(t time.Time) (ms int64) {
+	ms = t.UnixNano() / int64(time.Millisecond)
+	return
+}
+
+// ClockFunc it's an adapter to use a function as Clock.
+type ClockFunc func() time.Time
+
+// Now returns the time returned by calling f.
+func (f ClockFunc) Now() (t time.Time) {
+	t = f()
+	return
+}
+
+// SystemClock returns a Clock telling the actual time of system.
+func SystemClock() (c Clock) {
+	c = ClockFunc(time.Now)
+	return
+}
+
+// FrozenClock returns a Clock always telling time t.
+func FrozenClock(t time.Time) (c Clock) {
+	c = ClockFunc(func() time.Time {
+		return t
+	})
+	return
+}
+
+// steppingClock it's a Clock moving forward each time it's called.
+type steppingClock struct {
+	sync.Mutex
+	next time.Time
+	step time.Duration
+}
+
+// SteppingClock returns a Clock telling time t on first call, and
+// moving forward by step on each following call.
+func SteppingClock(t time.Time, step time.Duration) (c Clock) {
+	c = &steppingClock{
+		next: t,
+		step: step,
+	}
+	return
+}
+
+// Now returns the actual time of clock, and moves it forward.
+func (c *steppingClock) Now() (t time.Time) {
+	c.Lock()
+	t = c.next
+	c.next = c.next.Add(c.step)
+	c.Unlock()
+	return
+}
+
+// IDGeneratorFunc it's an adapter to use a function as IDGenerator.
+type IDGeneratorFunc func() ObjectId
+
+// NewID returns the id returned by calling f.
+func (f IDGeneratorFunc) NewID() (id ObjectId) {
+	id = f()
+	return
+}
+
+// ObjectIdGenerator returns an IDGenerator creating unique ObjectIds,
+// as MongoDB does.
+func ObjectIdGenerator() (g IDGenerator) {
+	g = IDGeneratorFunc(bson.NewObjectId)
+	return
+}
+
+// sequentialIDGenerator it's an IDGenerator counting ids.
+type sequentialIDGenerator struct {
+	last uint64
+}
+
+// SequentialIDGenerator returns an IDGenerator creating ids counting
+// from n, with the count on the last 8 bytes of ObjectId. With n
+// equal to 1, generates ids '000000000000000000000001',
+// '000000000000000000000002' and so on.
+func SequentialIDGenerator(n uint64) (g IDGenerator) {
+	g = &sequentialIDGenerator{
+		last: n - 1,
+	}
+	return
+}
+
+// NewID returns the next id on count.
+func (g *sequentialIDGenerator) NewID() (id ObjectId) {
+	var b [12]byte
+	binary.BigEndian.PutUint64(b[4:], atomic.AddUint64(&g.last, 1))
+	id = ObjectId(b[:])
+	return
+}
@@ -0,0 +1,130 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+)
+
+// Feature Tell time with Clocks
+// - As a developer,
+// - I want to be able to choose the Clock used to calculate document times,
+// - So that I could have deterministic created_on and updated_on values.
+func Test_Tell_time_with_Clocks(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a FrozenClock c at time %[1]v", func(when bdd.When, args ...interface{}) {
+		c := FrozenClock(args[0].(time.Time))
+
+		when("c.Now() is called twice", func(it bdd.It) {
+			first, second := c.Now(), c.Now()
+
+			it("should return %[1]v both times", func(assert bdd.Assert) {
+				assert.Equal(args[0].(time.Time), first)
+				assert.Equal(args[0].(time.Time), second)
+			})
+		})
+	}, like(
+		s(timeFmt("13-01-1870 14:00:30")), s(timeFmt("22-03-2000 10:12:21")),
+	))
+
+	given(t, "a SteppingClock c starting at %[1]v with step of %[2]v", func(when bdd.When, args ...interface{}) {
+		c := SteppingClock(args[0].(time.Time), args[1].(time.Duration))
+
+		when("c.Now() is called twice", func(it bdd.It) {
+			first, second := c.Now(), c.Now()
+
+			it("should return %[1]v first", func(assert bdd.Assert) {
+				assert.Equal(args[0].(time.Time), first)
+			})
+			it("should return %[1]v plus %[2]v after", func(assert bdd.Assert) {
+				assert.Equal(args[0].(time.Time).Add(args[1].(time.Duration)), second)
+			})
+		})
+	}, like(
+		s(timeFmt("13-01-1870 14:00:30"), time.Second), s(timeFmt("22-03-2000 10:12:21"), time.Hour),
+	))
+
+	given(t, "the connection using a FrozenClock at time %[1]v", func(when bdd.When, args ...interface{}) {
+		SetClock(FrozenClock(args[0].(time.Time)))
+		defer resetUtils()
+
+		when("NowInMilli() is called", func(it bdd.It) {
+			it("should return %[1]v in milliseconds", func(assert bdd.Assert) {
+				assert.Equal(expectedNowInMilli(args[0].(time.Time)), NowInMilli())
+			})
+		})
+	}, like(
+		s(timeFmt("13-01-1870 14:00:30")), s(timeFmt("22-03-2000 10:12:21")),
+	))
+}
+
+// Feature Generate ids with IDGenerators
+// - As a developer,
+// - I want to be able to choose the IDGenerator used to create ids,
+// - So that I could have deterministic _id values.
+func Test_Generate_ids_with_IDGenerators(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "the connection using a SequentialIDGenerator starting at 1", func(when bdd.When) {
+		SetIDGenerator(SequentialIDGenerator(1))
+		defer resetUtils()
+
+		when("NewID() is called twice", func(it bdd.It) {
+			first, second := NewID(), NewID()
+
+			it("should return '000000000000000000000001' first", func(assert bdd.Assert) {
+				assert.Equal("000000000000000000000001", first.Hex())
+			})
+			it("should return '000000000000000000000002' after", func(assert bdd.Assert) {
+				assert.Equal("000000000000000000000002", second.Hex())
+			})
+		})
+	})
+}
+
+// Feature Configure Clock and IDGenerator per Handle
+// - As a developer,
+// - I want to be able to choose a Clock and IDGenerator for a single Handle,
+// - So that I could have deterministic documents only where needed.
+func Test_Configure_Clock_and_IDGenerator_per_Handle(t *testing.T) {
+	defer cleanChanges()
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a linked ProductHandle p using a FrozenClock at %[1]v and a SequentialIDGenerator starting at %[3]v", func(when bdd.When, args ...interface{}) {
+		p := newProductHandle()
+		p.SetClock(FrozenClock(args[0].(time.Time)))
+		p.SetIDGenerator(SequentialIDGenerator(args[2].(uint64)))
+
+		when("p.Insert() is called", func(it bdd.It) {
+			err := p.Insert()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("p.Document().ID().Hex() should return %[2]v", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), p.Document().ID().Hex())
+			})
+			it("p.Document().CreatedOn() should return %[1]v", func(assert bdd.Assert) {
+				assert.Equal(expectedNowInMilli(args[0].(time.Time)), p.Document().CreatedOn())
+			})
+		})
+
+		when("p.Update(p.Document().ID()) is called", func(it bdd.It) {
+			err := p.Safely().Update(p.Document().ID())
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("p.Document().UpdatedOn() should return %[1]v", func(assert bdd.Assert) {
+				assert.Equal(expectedNowInMilli(args[0].(time.Time)), p.Document().UpdatedOn())
+			})
+		})
+	}, like(
+		s(timeFmt("01-01-2000 00:00:01"), "00000000000000000000000a", uint64(10)),
+		s(timeFmt("19-12-2017 22:59:00"), "0000000000000000000000ff", uint64(255)),
+	))
+}
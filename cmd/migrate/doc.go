@@ -0,0 +1,30 @@
+// Copyright 2009 Dênnis Dantas de Sousa. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Migrate runs the migrations registered by a package of the module on
+current directory, with the package github.com/ddspog/mongo/migrations.
+
+Since migrations are Go functions, migrate builds a small program
+importing the package, on a temporary directory of the module, and runs
+it with the command given. The connection uses MONGODB_URL, like
+mongo.Connect.
+
+Usage:
+
+	migrate [-pkg dir] [status | up [version] | down [n]]
+
+The package defaults to ./migrations, and can be a directory or an
+import path. The commands are:
+
+	status       lists migrations, and if they were applied
+	up           applies all migrations pending
+	up version   applies migrations pending until version
+	down         rolls back the last migration applied
+	down n       rolls back the last n migrations applied
+
+Without a command, status is shown. The exit status is 2 on invalid
+arguments, and 1 when the command fails.
+*/
+package main
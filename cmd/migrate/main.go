@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var (
+	pkg = flag.String("pkg", "./migrations", "package registering the migrations, as directory or import path")
+)
+
+// usage prints the usage of migrate.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of migrate:\n")
+	fmt.Fprintf(os.Stderr, "\tmigrate [-pkg dir] [status | up [version] | down [n]]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("migrate: ")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	code, err := run(*pkg, flag.Args())
+	if err != nil {
+		log.Print(err)
+		code = 1
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runnerSource it's the program running the migrations registered by
+// the package imported, with migrations.Main.
+const runnerSource = `// Code generated by migrate. DO NOT EDIT.
+
+package main
+
+import (
+	"github.com/ddspog/mongo/migrations"
+
+	_ %q
+)
+
+func main() {
+	migrations.Main()
+}
+`
+
+// runner returns the source of program running the migrations of
+// package with import path.
+func runner(path string) (src []byte) {
+	src = []byte(fmt.Sprintf(runnerSource, path))
+	return
+}
+
+// importPath returns the import path of package pkg, a directory or an
+// import path, on the module of current directory.
+func importPath(pkg string) (path string, err error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}", pkg)
+	cmd.Stderr = &stderr
+
+	var out []byte
+	if out, err = cmd.Output(); err != nil {
+		err = fmt.Errorf("package %s: %s", pkg, strings.TrimSpace(stderr.String()))
+		return
+	}
+
+	path = strings.TrimSpace(string(out))
+	return
+}
+
+// run builds the program running the migrations of package pkg, on a
+// temporary directory of current module, and runs it with args. It
+// returns the exit code of program.
+func run(pkg string, args []string) (code int, err error) {
+	var path string
+	if path, err = importPath(pkg); err != nil {
+		return
+	}
+
+	// The program must be inside the module, to import its packages.
+	var dir string
+	if dir, err = ioutil.TempDir(".", "migrate"); err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "main.go"), runner(path), 0644); err != nil {
+		return
+	}
+
+	bin := filepath.Join(dir, "migrate")
+	build := exec.Command("go", "build", "-o", bin, "./"+filepath.ToSlash(dir))
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err = build.Run(); err != nil {
+		err = fmt.Errorf("building migrations of %s: %w", path, err)
+		return
+	}
+
+	// Built programs are run directly, keeping their exit code.
+	cmd := exec.Command(bin, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	var exit *exec.ExitError
+	if err = cmd.Run(); errors.As(err, &exit) {
+		code, err = exit.ExitCode(), nil
+	}
+	return
+}
@@ -0,0 +1,51 @@
+// +build !acceptance
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// Feature Build the program running migrations
+// - As a developer,
+// - I want a program importing my migrations built for me,
+// - So that I don't need to write and keep a main package for them.
+func Test_Build_the_program_running_migrations(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "the package of migrations example.com/app/migrations", func(when bdd.When, args ...interface{}) {
+		when("runner() is called", func(it bdd.It) {
+			src := runner("example.com/app/migrations")
+			f, err := parser.ParseFile(token.NewFileSet(), "main.go", src, parser.ImportsOnly)
+
+			it("should create a valid Go file", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should import the migrations package and the one given", func(assert bdd.Assert) {
+				assert.Len(f.Imports, 2)
+				assert.Equal(`"github.com/ddspog/mongo/migrations"`, f.Imports[0].Path.Value)
+				assert.Equal(`"example.com/app/migrations"`, f.Imports[1].Path.Value)
+				assert.Equal("_", f.Imports[1].Name.Name)
+			})
+		})
+	})
+
+	given(t, "the directory of migrations package on this module", func(when bdd.When, args ...interface{}) {
+		when("importPath() is called with it, and with a directory missing", func(it bdd.It) {
+			path, err := importPath("../../migrations")
+			_, errMissing := importPath("./missing")
+
+			it("should return the import path of package", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("github.com/ddspog/mongo/migrations", path)
+			})
+			it("should return an error for the directory missing", func(assert bdd.Assert) {
+				assert.Error(errMissing)
+			})
+		})
+	})
+}
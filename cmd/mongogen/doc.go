@@ -0,0 +1,50 @@
+// Copyright 2009 Dênnis Dantas de Sousa. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Mongogen generates the boilerplate needed to use a struct type as
+mongo.Documenter, and a typed Handle to store it.
+
+Given a struct with bson tags, on a package:
+
+	//go:generate mongogen -type Product
+	type Product struct {
+		IDV        mongo.ObjectId `bson:"_id"`
+		CreatedOnV int64          `bson:"created_on"`
+		UpdatedOnV int64          `bson:"updated_on"`
+		NameV      string         `bson:"name" mongo:"unique"`
+		PriceV     float32        `bson:"price" mongo:"index,desc"`
+	}
+
+	func (p *Product) Validate() (err error) {
+		return
+	}
+
+Running go generate creates the file product_mongo.go, containing:
+
+	- The Documenter methods of Product, except Validate, that must
+	  be written by hand. Also the Stamper methods.
+	- ProductIndexes, the indexes declared on struct tags.
+	- ProductHandle, a Handle with Safely, Clean, SetDocument,
+	  Document, SearchFor, Find and FindAll working with Product.
+	- NewProductHandle, the constructor of ProductHandle.
+
+The fields tagged with _id, created_on and updated_on are required,
+with types ObjectId and int64. Fields are indexed with the mongo tag,
+accepting the options:
+
+	index   creates an index on field.
+	unique  creates an unique index on field.
+	sparse  creates a sparse index on field.
+	desc    indexes field on descending order.
+
+Usage:
+
+	mongogen -type T[,T...] [-collection name] [-output file] [dir]
+
+The collection name defaults to the snake case of type name, in plural,
+like products for Product. It can only be chosen generating a single
+type. Without dir, the package on actual directory is used.
+*/
+package main
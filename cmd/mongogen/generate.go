@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+
+	"github.com/ddspog/mongo"
+)
+
+// source it's the template of code generated for a type.
+var source = template.Must(template.New("source").Parse(`// Code generated by mongogen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+// {{.Type}}Indexes it's the indexes of {{.Type}} declared on its struct
+// tags.
+var {{.Type}}Indexes = []mgo.Index{
+{{- range .Indexes}}
+	{Key: []string{ {{- printf "%q" .Key -}} }{{if .Unique}}, Unique: true{{end}}{{if .Sparse}}, Sparse: true{{end}}},
+{{- end}}
+}
+
+// New creates a new {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) New() (doc mongo.Documenter) {
+	doc = &{{.Type}}{}
+	return
+}
+
+// Map translates a {{.Type}} to a M object, more easily read by mgo
+// methods.
+func ({{.Receiver}} *{{.Type}}) Map() (out mongo.M, err error) {
+	out, err = mongo.MapDocumenter({{.Receiver}})
+	return
+}
+
+// Init translates a M received, to the {{.Type}} structure. It fills
+// the structure fields with the values of each key in the M received.
+func ({{.Receiver}} *{{.Type}}) Init(in mongo.M) (err error) {
+	var doc mongo.Documenter = {{.Receiver}}
+	err = mongo.InitDocumenter(in, &doc)
+	return
+}
+
+// ID returns the _id attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) ID() (id mongo.ObjectId) {
+	id = {{.Receiver}}.{{.ID}}
+	return
+}
+
+// CreatedOn returns the created_on attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) CreatedOn() (t int64) {
+	t = {{.Receiver}}.{{.CreatedOn}}
+	return
+}
+
+// UpdatedOn returns the updated_on attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) UpdatedOn() (t int64) {
+	t = {{.Receiver}}.{{.UpdatedOn}}
+	return
+}
+
+// GenerateID creates a new id for a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) GenerateID() {
+	{{.Receiver}}.{{.ID}} = mongo.NewID()
+}
+
+// CalculateCreatedOn update the created_on attribute with a value
+// corresponding to actual time.
+func ({{.Receiver}} *{{.Type}}) CalculateCreatedOn() {
+	{{.Receiver}}.{{.CreatedOn}} = mongo.NowInMilli()
+}
+
+// CalculateUpdatedOn update the updated_on attribute with a value
+// corresponding to actual time.
+func ({{.Receiver}} *{{.Type}}) CalculateUpdatedOn() {
+	{{.Receiver}}.{{.UpdatedOn}} = mongo.NowInMilli()
+}
+
+// SetID defines the _id attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) SetID(id mongo.ObjectId) {
+	{{.Receiver}}.{{.ID}} = id
+}
+
+// SetCreatedOn defines the created_on attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) SetCreatedOn(t int64) {
+	{{.Receiver}}.{{.CreatedOn}} = t
+}
+
+// SetUpdatedOn defines the updated_on attribute of a {{.Type}}.
+func ({{.Receiver}} *{{.Type}}) SetUpdatedOn(t int64) {
+	{{.Receiver}}.{{.UpdatedOn}} = t
+}
+
+// {{.Type}}Handle it's a Handle storing {{.Type}} documents on
+// {{.Collection}} collection.
+type {{.Type}}Handle struct {
+	*mongo.Handle
+}
+
+// New{{.Type}}Handle returns a {{.Type}}Handle linked to the
+// {{.Collection}} collection, with {{.Type}}Indexes.
+func New{{.Type}}Handle() (h *{{.Type}}Handle) {
+	h = &{{.Type}}Handle{
+		Handle: mongo.NewHandle({{printf "%q" .Collection}}, &{{.Type}}{}, {{.Type}}Indexes...),
+	}
+	return
+}
+
+// Safely sets {{.Type}}Handle to close after any operation.
+func (h *{{.Type}}Handle) Safely() (r *{{.Type}}Handle) {
+	h.Handle.Safely()
+	r = h
+	return
+}
+
+// Clean documents and search map values, returns {{.Type}}Handle for
+// chaining purposes.
+func (h *{{.Type}}Handle) Clean() (r *{{.Type}}Handle) {
+	h.Handle.Clean()
+	r = h
+	return
+}
+
+// SetDocument sets a {{.Type}} on {{.Type}}Handle and returns it for
+// chaining purposes.
+func (h *{{.Type}}Handle) SetDocument(d *{{.Type}}) (r *{{.Type}}Handle) {
+	h.Handle.SetDocument(d)
+	r = h
+	return
+}
+
+// Document returns the {{.Type}} of {{.Type}}Handle.
+func (h *{{.Type}}Handle) Document() (d *{{.Type}}) {
+	d, _ = h.Handle.Document().(*{{.Type}})
+	return
+}
+
+// SearchFor sets search map value of {{.Type}}Handle and returns it
+// for chaining purposes.
+func (h *{{.Type}}Handle) SearchFor(s mongo.M) (r *{{.Type}}Handle) {
+	h.Handle.SearchFor(s)
+	r = h
+	return
+}
+
+// Find search on connected collection for a {{.Type}} matching data
+// stored on {{.Type}}Handle and returns it.
+func (h *{{.Type}}Handle) Find() (d *{{.Type}}, err error) {
+	var doc mongo.Documenter
+	doc, err = h.Handle.Find()
+	d, _ = doc.(*{{.Type}})
+	return
+}
+
+// FindAll search on connected collection for all {{.Type}} documents
+// matching data stored on {{.Type}}Handle and returns them.
+func (h *{{.Type}}Handle) FindAll(opts ...mongo.QueryOptions) (da []*{{.Type}}, err error) {
+	var docs []mongo.Documenter
+	docs, err = h.Handle.FindAll(opts...)
+	da = make([]*{{.Type}}, len(docs))
+	for i := range docs {
+		da[i], _ = docs[i].(*{{.Type}})
+	}
+	return
+}
+`))
+
+// generate returns the formatted code for model m.
+func generate(m *model) (out []byte, err error) {
+	var buf bytes.Buffer
+	if err = source.Execute(&buf, m); err == nil {
+		out, err = format.Source(buf.Bytes())
+	}
+	return
+}
+
+// run generates the code of type t on package at dir, writing it on
+// file output, relative to dir. Empty collection and output uses
+// default values.
+func run(dir, t, collection, output string) (err error) {
+	var m *model
+	if m, err = parseDir(dir, t); err != nil {
+		return
+	}
+
+	if collection != "" {
+		m.Collection = collection
+	}
+
+	if output == "" {
+		output = mongo.SnakeCase.Key(t) + "_mongo.go"
+	}
+
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(dir, output)
+	}
+
+	var out []byte
+	if out, err = generate(m); err == nil {
+		err = ioutil.WriteFile(output, out, 0644)
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	typeNames  = flag.String("type", "", "comma-separated list of type names; must be set")
+	collection = flag.String("collection", "", "collection name; default snake case of type name in plural")
+	output     = flag.String("output", "", "output file name; default <type>_mongo.go")
+)
+
+// usage prints the usage of mongogen.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of mongogen:\n")
+	fmt.Fprintf(os.Stderr, "\tmongogen -type T[,T...] [-collection name] [-output file] [dir]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mongogen: ")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+
+	types := strings.Split(*typeNames, ",")
+	if len(types) > 1 && (*collection != "" || *output != "") {
+		log.Fatal("-collection and -output can only be used with a single type")
+	}
+
+	for _, t := range types {
+		if err := run(dir, t, *collection, *output); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
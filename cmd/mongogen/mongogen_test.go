@@ -0,0 +1,143 @@
+// +build !acceptance
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+const (
+	// productSource it's a package with a type to be generated.
+	productSource = `package shop
+
+import "github.com/ddspog/mongo"
+
+type Product struct {
+	IDV        mongo.ObjectId ` + "`bson:\"_id\"`" + `
+	CreatedOnV int64          ` + "`bson:\"created_on\"`" + `
+	UpdatedOnV int64          ` + "`bson:\"updated_on\"`" + `
+	NameV      string         ` + "`bson:\"name\" mongo:\"unique\"`" + `
+	PriceV     float32        ` + "`bson:\"price\" mongo:\"index,sparse,desc\"`" + `
+	NoteV      string         ` + "`bson:\"note\" mongo:\"sparse\"`" + `
+}
+
+type Category struct {
+	IDV        mongo.ObjectId ` + "`bson:\"_id\"`" + `
+	CreatedOnV int64          ` + "`bson:\"created_on\"`" + `
+}
+
+type Price float32
+`
+)
+
+// writePackage creates a temp dir with a file containing src.
+func writePackage(src string) (dir string) {
+	dir, _ = ioutil.TempDir("", "mongogen")
+	_ = ioutil.WriteFile(filepath.Join(dir, "shop.go"), []byte(src), 0644)
+	return
+}
+
+// Feature Generate Documenter and Handle code
+// - As a developer,
+// - I want to generate the Documenter and Handle code of my types,
+// - So that I don't need to write and maintain the boilerplate.
+func Test_Generate_Documenter_and_Handle_code(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a package with type Product", func(when bdd.When, args ...interface{}) {
+		dir := writePackage(productSource)
+		defer os.RemoveAll(dir)
+
+		when("run(dir, 'Product', '', '') is called twice", func(it bdd.It) {
+			errFirst := run(dir, "Product", "", "")
+			errSecond := run(dir, "Product", "", "")
+
+			out, errRead := ioutil.ReadFile(filepath.Join(dir, "product_mongo.go"))
+			code := string(out)
+
+			_, errParse := parser.ParseFile(token.NewFileSet(), "product_mongo.go", out, 0)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.NoError(errSecond)
+				assert.NoError(errRead)
+			})
+			it("should create a valid Go file", func(assert bdd.Assert) {
+				assert.NoError(errParse)
+			})
+			it("should implement Documenter on Product", func(assert bdd.Assert) {
+				assert.Contains(code, "func (p *Product) ID() (id mongo.ObjectId) {")
+				assert.Contains(code, "id = p.IDV")
+				assert.Contains(code, "p.CreatedOnV = mongo.NowInMilli()")
+				assert.Contains(code, "func (p *Product) SetUpdatedOn(t int64) {")
+			})
+			it("should create a ProductHandle on products collection", func(assert bdd.Assert) {
+				assert.Contains(code, `mongo.NewHandle("products", &Product{}, ProductIndexes...)`)
+				assert.Contains(code, "func (h *ProductHandle) FindAll(opts ...mongo.QueryOptions) (da []*Product, err error) {")
+			})
+			it("should declare the indexes of struct tags", func(assert bdd.Assert) {
+				assert.Contains(code, `{Key: []string{"name"}, Unique: true},`)
+				assert.Contains(code, `{Key: []string{"-price"}, Sparse: true},`)
+				assert.False(strings.Contains(code, `"note"`))
+			})
+		})
+
+		when("run(dir, 'Product', 'goods', 'goods.go') is called", func(it bdd.It) {
+			err := run(dir, "Product", "goods", "goods.go")
+			out, _ := ioutil.ReadFile(filepath.Join(dir, "goods.go"))
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should create a ProductHandle on goods collection", func(assert bdd.Assert) {
+				assert.Contains(string(out), `mongo.NewHandle("goods", &Product{}, ProductIndexes...)`)
+			})
+		})
+	})
+
+	given(t, "a package with types Category, lacking updated_on, and Price", func(when bdd.When, args ...interface{}) {
+		dir := writePackage(productSource)
+		defer os.RemoveAll(dir)
+
+		when("run() is called with types Category, Price and Order", func(it bdd.It) {
+			errCategory := run(dir, "Category", "", "")
+			errPrice := run(dir, "Price", "", "")
+			errOrder := run(dir, "Order", "", "")
+
+			it("should return errors for all types", func(assert bdd.Assert) {
+				assert.EqualError(errCategory, "Category: missing field with bson tag updated_on")
+				assert.EqualError(errPrice, "Price: "+ErrNotStruct.Error())
+				assert.EqualError(errOrder, "Order: "+ErrTypeNotFound.Error())
+			})
+		})
+	})
+}
+
+// Feature Name collections after types
+// - As a developer,
+// - I want the collections to be named after my types,
+// - So that I don't need to choose names for each one.
+func Test_Name_collections_after_types(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a type named %[1]v", func(when bdd.When, args ...interface{}) {
+		when("collectionName() is called", func(it bdd.It) {
+			name := collectionName(args[0].(string))
+
+			it("should return %[2]v", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), name)
+			})
+		})
+	}, like(
+		s("Product", "products"), s("Category", "categories"), s("Day", "days"),
+		s("Box", "boxes"), s("HTTPLog", "http_logs"), s("OrderItem", "order_items"),
+	))
+}
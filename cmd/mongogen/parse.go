@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ddspog/mongo"
+)
+
+var (
+	// ErrTypeNotFound it's returned when the type can't be found on
+	// package.
+	ErrTypeNotFound = errors.New("type not found on package")
+	// ErrNotStruct it's returned when the type isn't a struct.
+	ErrNotStruct = errors.New("type isn't a struct")
+)
+
+// model it's the information about a type, needed to generate its
+// code.
+type model struct {
+	Package    string
+	Type       string
+	Receiver   string
+	Collection string
+	ID         string
+	CreatedOn  string
+	UpdatedOn  string
+	Indexes    []index
+}
+
+// index it's an index declared on struct tags.
+type index struct {
+	Key    string
+	Unique bool
+	Sparse bool
+}
+
+// parseDir reads the package on dir, returning the model of type t.
+// Files on dir generated by mongogen are ignored.
+func parseDir(dir, t string) (m *model, err error) {
+	var names []string
+	if names, err = filepath.Glob(filepath.Join(dir, "*.go")); err != nil {
+		return
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		var f *ast.File
+		if f, err = parser.ParseFile(fset, name, nil, 0); err != nil {
+			return
+		}
+
+		if isGenerated(f) {
+			continue
+		}
+
+		if spec := findType(f, t); spec != nil {
+			m, err = parseType(f.Name.Name, spec)
+			return
+		}
+	}
+
+	err = fmt.Errorf("%s: %w", t, ErrTypeNotFound)
+	return
+}
+
+// isGenerated checks if f has the comment of generated files.
+func isGenerated(f *ast.File) (r bool) {
+	for _, c := range f.Comments {
+		if c.Pos() > f.Package {
+			break
+		}
+
+		for _, l := range c.List {
+			if strings.HasPrefix(l.Text, "// Code generated ") && strings.HasSuffix(l.Text, " DO NOT EDIT.") {
+				r = true
+				return
+			}
+		}
+	}
+	return
+}
+
+// findType search for the declaration of type t on file f.
+func findType(f *ast.File, t string) (spec *ast.TypeSpec) {
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			for _, s := range gen.Specs {
+				if ts := s.(*ast.TypeSpec); ts.Name.Name == t {
+					spec = ts
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// parseType reads the fields of type spec, declared on package pkg.
+func parseType(pkg string, spec *ast.TypeSpec) (m *model, err error) {
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		err = fmt.Errorf("%s: %w", spec.Name.Name, ErrNotStruct)
+		return
+	}
+
+	m = &model{
+		Package:    pkg,
+		Type:       spec.Name.Name,
+		Receiver:   receiver(spec.Name.Name),
+		Collection: collectionName(spec.Name.Name),
+	}
+
+	for _, field := range st.Fields.List {
+		if field.Tag == nil || len(field.Names) != 1 {
+			continue
+		}
+
+		tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+		key := strings.Split(tag.Get("bson"), ",")[0]
+		name := field.Names[0].Name
+
+		switch key {
+		case "_id":
+			err = checkType(m, key, field.Type, "ObjectId")
+			m.ID = name
+		case "created_on":
+			err = checkType(m, key, field.Type, "int64")
+			m.CreatedOn = name
+		case "updated_on":
+			err = checkType(m, key, field.Type, "int64")
+			m.UpdatedOn = name
+		case "", "-":
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		if i, ok := parseIndex(key, tag.Get("mongo")); ok {
+			m.Indexes = append(m.Indexes, i)
+		}
+	}
+
+	switch "" {
+	case m.ID:
+		err = fmt.Errorf("%s: missing field with bson tag _id", m.Type)
+	case m.CreatedOn:
+		err = fmt.Errorf("%s: missing field with bson tag created_on", m.Type)
+	case m.UpdatedOn:
+		err = fmt.Errorf("%s: missing field with bson tag updated_on", m.Type)
+	}
+	return
+}
+
+// checkType returns an error if the field with bson key on m hasn't
+// type expected, ignoring the package qualifier.
+func checkType(m *model, key string, expr ast.Expr, expected string) (err error) {
+	var name string
+	switch e := expr.(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.SelectorExpr:
+		name = e.Sel.Name
+	}
+
+	if name != expected {
+		err = fmt.Errorf("%s: field with bson tag %s must have type %s", m.Type, key, expected)
+	}
+	return
+}
+
+// parseIndex returns the index on field with bson key, declared with
+// the mongo tag options opts. It returns false when opts doesn't
+// declare an index.
+func parseIndex(key, opts string) (i index, ok bool) {
+	i.Key = key
+	for _, opt := range strings.Split(opts, ",") {
+		switch strings.TrimSpace(opt) {
+		case "index":
+			ok = true
+		case "unique":
+			ok, i.Unique = true, true
+		case "sparse":
+			i.Sparse = true
+		case "desc":
+			i.Key = "-" + key
+		}
+	}
+	return
+}
+
+// receiver returns the receiver name used on methods of type t, the
+// first letter of t in lower case. The letter t, used on generated
+// methods, is replaced by the whole type name.
+func receiver(t string) (r string) {
+	if r = strings.ToLower(t[:1]); r == "t" {
+		if r = strings.ToLower(t[:1]) + t[1:]; r == "t" {
+			r = "x"
+		}
+	}
+	return
+}
+
+// collectionName returns the snake case of type name t, in plural.
+func collectionName(t string) (name string) {
+	name = mongo.SnakeCase.Key(t)
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		name += "es"
+	case len(name) > 1 && strings.HasSuffix(name, "y") && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		name = name[:len(name)-1] + "ies"
+	default:
+		name += "s"
+	}
+	return
+}
+
@@ -0,0 +1,37 @@
+// Copyright 2009 Dênnis Dantas de Sousa. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Mongoio exports documents of a collection to a file, and imports them
+back, using the Export and Import methods of mongo.Handle.
+
+Documents are written and read on the formats:
+
+	bson   BSON documents prefixed by their length, like the .bson
+	       files of mongodump.
+	json   MongoDB Extended JSON, one document per line.
+	csv    the fields chosen, with a header naming them. Strings are
+	       written as they are, and other values as Extended JSON,
+	       so they're imported back with their types.
+
+The format defaults to the extension of file, or json without one.
+The connection uses MONGODB_URL, or mongodb://localhost:27017/test
+without this environment variable.
+
+Usage:
+
+	mongoio export -collection name [-format f] [-fields a,b.c]
+		[-query json] [-canonical] [-batch n] [-quiet] [-output file]
+	mongoio import -collection name [-format f] [-upsert] [-batch n]
+		[-quiet] [file]
+
+Export writes the documents matching query, an Extended JSON filter,
+or all of them without one, to file or standard output. Only fields
+are written if chosen, being required by csv. Import reads documents
+from file or standard input, inserting them in batches of n documents.
+With -upsert, documents with the same _id are replaced, instead of
+failing the import. The number of documents done it's reported after
+each batch, unless -quiet.
+*/
+package main
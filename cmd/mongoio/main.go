@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// usage prints the usage of mongoio.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of mongoio:\n")
+	fmt.Fprintf(os.Stderr, "\tmongoio export -collection name [-format f] [-fields a,b.c] [-query json] [-canonical] [-batch n] [-quiet] [-output file]\n")
+	fmt.Fprintf(os.Stderr, "\tmongoio import -collection name [-format f] [-upsert] [-batch n] [-quiet] [file]\n")
+	fmt.Fprintf(os.Stderr, "Run mongoio export -h or mongoio import -h for the flags of each command.\n")
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mongoio: ")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cfg config
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "export":
+		cfg, err = parseExport(args)
+	case "import":
+		cfg, err = parseImport(args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+
+	if err = run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ddspog/mongo"
+)
+
+// document it's the Documenter of collections exported and imported,
+// holding any fields.
+type document struct {
+	mongo.Document `bson:",inline"`
+	Fields         mongo.M `bson:",inline"`
+}
+
+// New creates a new document bound to its Document.
+func (d *document) New() (doc mongo.Documenter) {
+	doc = mongo.Bind(&document{})
+	return
+}
+
+// Validate accepts any document.
+func (d *document) Validate() (err error) {
+	return
+}
+
+// config holds the options of a command.
+type config struct {
+	export     bool
+	collection string
+	file       string
+	query      mongo.M
+	exportOpts mongo.ExportOptions
+	importOpts mongo.ImportOptions
+	quiet      bool
+}
+
+// parseExport returns the config of export command with args.
+func parseExport(args []string) (cfg config, err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	collection := fs.String("collection", "", "collection name; must be set")
+	format := fs.String("format", "", "file format: bson, json or csv; default by file extension, or json")
+	fields := fs.String("fields", "", "comma-separated list of fields exported; must be set with csv")
+	query := fs.String("query", "", "Extended JSON filter of documents exported; default all documents")
+	canonical := fs.Bool("canonical", false, "write canonical Extended JSON, instead of relaxed")
+	batch := fs.Int("batch", 1000, "number of documents read on each batch")
+	quiet := fs.Bool("quiet", false, "don't report the documents exported")
+	output := fs.String("output", "", "output file name; default standard output")
+	_ = fs.Parse(args)
+
+	cfg = config{
+		export:     true,
+		collection: *collection,
+		file:       *output,
+		quiet:      *quiet,
+	}
+	cfg.exportOpts.BatchSize = *batch
+
+	if *fields != "" {
+		cfg.exportOpts.Fields = strings.Split(*fields, ",")
+	}
+	if *canonical {
+		cfg.exportOpts.Mode = mongo.Canonical
+	}
+	if *query != "" {
+		if err = mongo.UnmarshalExtJSON([]byte(*query), &cfg.query); err != nil {
+			err = fmt.Errorf("invalid -query: %w", err)
+			return
+		}
+	}
+
+	if cfg.exportOpts.Format, err = parseFormat(*format, *output); err == nil {
+		err = checkCollection(cfg)
+	}
+	return
+}
+
+// parseImport returns the config of import command with args.
+func parseImport(args []string) (cfg config, err error) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	collection := fs.String("collection", "", "collection name; must be set")
+	format := fs.String("format", "", "file format: bson, json or csv; default by file extension, or json")
+	upsert := fs.Bool("upsert", false, "replace documents with the same _id, instead of failing")
+	batch := fs.Int("batch", 1000, "number of documents written on each batch")
+	quiet := fs.Bool("quiet", false, "don't report the documents imported")
+	_ = fs.Parse(args)
+
+	cfg = config{
+		collection: *collection,
+		file:       fs.Arg(0),
+		quiet:      *quiet,
+	}
+	cfg.importOpts.BatchSize = *batch
+	cfg.importOpts.Upsert = *upsert
+
+	if cfg.importOpts.Format, err = parseFormat(*format, cfg.file); err == nil {
+		err = checkCollection(cfg)
+	}
+	return
+}
+
+// parseFormat returns the ExportFormat named by name, or by the
+// extension of file if name is empty. Without both, it's JSONLines.
+func parseFormat(name, file string) (f mongo.ExportFormat, err error) {
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	switch strings.ToLower(name) {
+	case "bson":
+		f = mongo.BSONDump
+	case "", "json", "jsonl", "ndjson":
+		f = mongo.JSONLines
+	case "csv":
+		f = mongo.CSV
+	default:
+		err = fmt.Errorf("unknown format %q, use -format bson, json or csv", name)
+	}
+	return
+}
+
+// checkCollection returns an error if cfg has no collection.
+func checkCollection(cfg config) (err error) {
+	if cfg.collection == "" {
+		err = errors.New("-collection must be set")
+	}
+	return
+}
+
+// run connects to MongoDB and runs the command of cfg.
+func run(cfg config) (err error) {
+	if err = mongo.Connect(); err != nil {
+		return
+	}
+	defer mongo.Disconnect()
+
+	h := mongo.NewHandle(cfg.collection, &document{})
+	defer h.Close()
+
+	if cfg.export {
+		err = runExport(h, cfg)
+	} else {
+		err = runImport(h, cfg)
+	}
+	return
+}
+
+// runExport exports the documents of h to the file of cfg.
+func runExport(h *mongo.Handle, cfg config) (err error) {
+	var w io.Writer = os.Stdout
+	if cfg.file != "" {
+		var f *os.File
+		if f, err = os.Create(cfg.file); err != nil {
+			return
+		}
+		defer func() {
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+		}()
+		w = f
+	}
+
+	if len(cfg.query) > 0 {
+		h.SearchFor(cfg.query)
+	}
+
+	cfg.exportOpts.Progress = progress(cfg.quiet, "exported")
+	_, err = h.Export(w, cfg.exportOpts)
+	return
+}
+
+// runImport imports the documents on the file of cfg to h.
+func runImport(h *mongo.Handle, cfg config) (err error) {
+	var r io.Reader = os.Stdin
+	if cfg.file != "" {
+		var f *os.File
+		if f, err = os.Open(cfg.file); err != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	cfg.importOpts.Progress = progress(cfg.quiet, "imported")
+
+	var n int
+	if n, err = h.Import(r, cfg.importOpts); err != nil {
+		err = fmt.Errorf("%w, after %d documents imported", err, n)
+	}
+	return
+}
+
+// progress returns the function reporting the documents done, or nil
+// if quiet.
+func progress(quiet bool, done string) (f func(int)) {
+	if !quiet {
+		f = func(n int) {
+			log.Printf("%d documents %s", n, done)
+		}
+	}
+	return
+}
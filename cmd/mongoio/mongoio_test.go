@@ -0,0 +1,114 @@
+// +build !acceptance
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo"
+)
+
+// Feature Choose the format of files
+// - As a developer,
+// - I want the format of files chosen by flag or by extension,
+// - So that I don't need to repeat it on every command.
+func Test_Choose_the_format_of_files(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "the format '%[1]v' and file '%[2]v'", func(when bdd.When, args ...interface{}) {
+		when("parseFormat() is called", func(it bdd.It) {
+			f, err := parseFormat(args[0].(string), args[1].(string))
+
+			if args[2] != nil {
+				it("should return the format %[3]v", func(assert bdd.Assert) {
+					assert.NoError(err)
+					assert.Equal(args[2].(mongo.ExportFormat), f)
+				})
+			} else {
+				it("should return an error", func(assert bdd.Assert) {
+					assert.Error(err)
+				})
+			}
+		})
+	}, like(
+		s("", "", mongo.JSONLines),
+		s("", "products.bson", mongo.BSONDump),
+		s("", "products.jsonl", mongo.JSONLines),
+		s("", "products.CSV", mongo.CSV),
+		s("csv", "products.json", mongo.CSV),
+		s("", "products.txt", nil),
+		s("xml", "", nil),
+	))
+}
+
+// Feature Parse flags of commands
+// - As a developer,
+// - I want the flags of export and import checked,
+// - So that I know what's wrong before connecting.
+func Test_Parse_flags_of_commands(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "the args of export with query, fields and canonical", func(when bdd.When, args ...interface{}) {
+		when("parseExport() is called", func(it bdd.It) {
+			cfg, err := parseExport([]string{
+				"-collection", "products", "-fields", "name,price.value",
+				"-query", `{"price": {"$gt": {"$numberInt": "10"}}}`,
+				"-canonical", "-output", "products.csv",
+			})
+
+			it("should return the config of an export to CSV", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.True(cfg.export)
+				assert.Equal("products", cfg.collection)
+				assert.Equal("products.csv", cfg.file)
+				assert.Equal(mongo.CSV, cfg.exportOpts.Format)
+				assert.Equal(mongo.Canonical, cfg.exportOpts.Mode)
+				assert.Equal([]string{"name", "price.value"}, cfg.exportOpts.Fields)
+				assert.Equal(mongo.M{"price": mongo.M{"$gt": 10}}, cfg.query)
+			})
+		})
+
+		when("parseExport() is called with an invalid query", func(it bdd.It) {
+			_, err := parseExport([]string{"-collection", "products", "-query", "{"})
+
+			it("should return an error", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+	})
+
+	given(t, "the args of import with upsert and a file", func(when bdd.When, args ...interface{}) {
+		when("parseImport() is called", func(it bdd.It) {
+			cfg, err := parseImport([]string{"-collection", "products", "-upsert", "-batch", "10", "products.bson"})
+
+			it("should return the config of an import of dump", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.False(cfg.export)
+				assert.Equal("products.bson", cfg.file)
+				assert.Equal(mongo.BSONDump, cfg.importOpts.Format)
+				assert.True(cfg.importOpts.Upsert)
+				assert.Equal(10, cfg.importOpts.BatchSize)
+			})
+		})
+
+		when("parseImport() is called without collection", func(it bdd.It) {
+			_, err := parseImport([]string{"products.bson"})
+
+			it("should return an error", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+	})
+
+	given(t, "an empty document", func(when bdd.When, args ...interface{}) {
+		when("its Map() is called", func(it bdd.It) {
+			m, err := (&document{}).New().Map()
+
+			it("should match every document", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Len(m, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package mongo
+
+import (
+	"reflect"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// EncodeFunc it's a function returning the value to be stored in
+// place of v, as done by GetBSON method of bson.Getter.
+type EncodeFunc = bsonutils.EncodeFunc
+
+// DecodeFunc it's a function setting out with the value on raw, as
+// done by SetBSON method of bson.Setter.
+type DecodeFunc = bsonutils.DecodeFunc
+
+// RegisterEncoder sets f to marshal values of type t, when mapping
+// documents with MapDocumenter, InitDocumenter or Map methods. It
+// allows storing types that can't implement bson.Getter, like the ones
+// from other packages. If t it's an interface, f marshals any type
+// implementing it. A nil f removes the encoder of t.
+func RegisterEncoder(t reflect.Type, f EncodeFunc) {
+	bsonutils.DefaultRegistry.RegisterEncoder(t, f)
+}
+
+// RegisterDecoder sets f to unmarshal values into type t, when mapping
+// documents with InitDocumenter. It allows reading
+// types that can't implement bson.Setter, like the ones from other
+// packages. If t it's an interface, f unmarshals into any type
+// implementing it. A nil f removes the decoder of t.
+func RegisterDecoder(t reflect.Type, f DecodeFunc) {
+	bsonutils.DefaultRegistry.RegisterDecoder(t, f)
+}
@@ -0,0 +1,193 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo/internal/bsonutils"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ledger it's a type with fields whose types can't implement
+// bson.Getter and bson.Setter.
+type ledger struct {
+	Balance big.Int   `bson:"balance"`
+	History []big.Int `bson:"history"`
+	Label   labeler   `bson:"label"`
+}
+
+// bigIntType it's the type of big.Int.
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// labeler it's an interface with encoder registered in tests.
+type labeler interface {
+	Label() string
+}
+
+// tag it's a labeler.
+type tag string
+
+// Label returns the tag in upper case.
+func (t tag) Label() string {
+	return strings.ToUpper(string(t))
+}
+
+// encodeBigInt marshals a big.Int as a string.
+func encodeBigInt(v reflect.Value) (interface{}, error) {
+	n := v.Interface().(big.Int)
+	return n.String(), nil
+}
+
+// decodeBigInt unmarshals a string into a big.Int.
+func decodeBigInt(raw bson.Raw, out reflect.Value) (err error) {
+	var s string
+	if err = raw.Unmarshal(&s); err != nil {
+		return
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return &bson.TypeError{Type: out.Type(), Kind: raw.Kind}
+	}
+	out.Set(reflect.ValueOf(*n))
+	return
+}
+
+// bigInt returns the big.Int of s.
+func bigInt(s string) (n big.Int) {
+	n.SetString(s, 10)
+	return
+}
+
+// newLedgerRegistry returns a Registry with the codecs of big.Int and
+// labeler.
+func newLedgerRegistry() (r *bsonutils.Registry) {
+	r = bsonutils.NewRegistry()
+	r.RegisterEncoder(bigIntType, encodeBigInt)
+	r.RegisterDecoder(bigIntType, decodeBigInt)
+	r.RegisterEncoder(reflect.TypeOf((*labeler)(nil)).Elem(), func(v reflect.Value) (interface{}, error) {
+		return v.Interface().(labeler).Label(), nil
+	})
+	r.RegisterDecoder(reflect.TypeOf((*labeler)(nil)).Elem(), func(raw bson.Raw, out reflect.Value) (err error) {
+		var s string
+		if err = raw.Unmarshal(&s); err == nil {
+			out.Set(reflect.ValueOf(tag(s)))
+		}
+		return
+	})
+	return
+}
+
+// Feature Map third party types with codecs
+// - As a developer,
+// - I want to register encoders and decoders of types,
+// - So that I could store types I can't add methods to.
+func Test_Map_third_party_types_with_codecs(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a ledger l with big.Int fields, and a Registry r with their codec", func(when bdd.When, args ...interface{}) {
+		l := ledger{
+			Balance: bigInt("123456789012345678901234567890"),
+			History: []big.Int{bigInt("-1"), bigInt("42")},
+			Label:   tag("savings"),
+		}
+		r := newLedgerRegistry()
+
+		when("marshalled with an Encoder using r", func(it bdd.It) {
+			buf, errMarshal := bsonutils.Encoder{Registry: r}.Marshal(l)
+			m, errM := UnmarshalToM(buf)
+
+			it("should store big.Int values as strings", func(assert bdd.Assert) {
+				assert.NoError(errMarshal)
+				assert.NoError(errM)
+				assert.Equal("123456789012345678901234567890", m["balance"])
+				assert.Equal([]interface{}{"-1", "42"}, m["history"])
+			})
+			it("should use the encoder of interface implemented", func(assert bdd.Assert) {
+				assert.Equal("SAVINGS", m["label"])
+			})
+
+			var out ledger
+			errDecode := bsonutils.Decoder{Registry: r}.Unmarshal(buf, &out)
+
+			it("should be read back by a Decoder using r", func(assert bdd.Assert) {
+				assert.NoError(errDecode)
+				assert.Equal(l.Balance.String(), out.Balance.String())
+				assert.Len(out.History, 2)
+				assert.Equal(tag("SAVINGS"), out.Label)
+			})
+		})
+
+		when("a decoder of r returns bson.ErrSetZero", func(it bdd.It) {
+			buf, _ := bsonutils.Encoder{Registry: r}.Marshal(l)
+			r.RegisterDecoder(bigIntType, func(raw bson.Raw, out reflect.Value) error {
+				return bson.ErrSetZero
+			})
+
+			out := ledger{Balance: bigInt("1")}
+			err := bsonutils.Decoder{Registry: r}.Unmarshal(buf, &out)
+
+			it("should set the field to zero", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(0, out.Balance.Sign())
+			})
+		})
+
+		when("the encoder of big.Int it's removed from r", func(it bdd.It) {
+			r.RegisterEncoder(bigIntType, nil)
+			buf, err := bsonutils.Encoder{Registry: r}.Marshal(l)
+			m, _ := UnmarshalToM(buf)
+
+			it("should store big.Int values as documents", func(assert bdd.Assert) {
+				assert.NoError(err)
+				_, ok := m["balance"].(M)
+				assert.True(ok)
+			})
+		})
+	})
+
+	given(t, "the big.Int codec registered with RegisterEncoder and RegisterDecoder", func(when bdd.When, args ...interface{}) {
+		RegisterEncoder(bigIntType, encodeBigInt)
+		RegisterDecoder(bigIntType, decodeBigInt)
+		defer RegisterEncoder(bigIntType, nil)
+		defer RegisterDecoder(bigIntType, nil)
+
+		m, errMap := MapDocumenter(&wallet{Balance: bigInt("1000")})
+
+		var d Documenter = &wallet{}
+		errInit := InitDocumenter(m, &d)
+
+		when("a wallet it's mapped and initialized again", func(it bdd.It) {
+			it("should store the balance as a string", func(assert bdd.Assert) {
+				assert.NoError(errMap)
+				assert.Equal("1000", m["balance"])
+			})
+			it("should read back the balance", func(assert bdd.Assert) {
+				assert.NoError(errInit)
+				assert.Equal("1000", d.(*wallet).Balance.String())
+			})
+		})
+	})
+}
+
+// wallet it's a Documenter with a big.Int field.
+type wallet struct {
+	Document `bson:",inline"`
+	Balance  big.Int `bson:"balance"`
+}
+
+// New creates a new instance of wallet.
+func (w *wallet) New() (doc Documenter) {
+	doc = Bind(&wallet{})
+	return
+}
+
+// Validate checks nothing on wallet.
+func (w *wallet) Validate() (err error) {
+	return
+}
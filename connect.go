@@ -2,6 +2,8 @@ package mongo
 
 //noinspection GoInvalidPackageImport
 import (
+	"errors"
+
 	"github.com/ddspog/mongo/internal/connecter"
 	"github.com/globalsign/mgo"
 )
@@ -10,11 +12,24 @@ import (
 // database of a temporary database.
 type Connecter = connecter.MongoConnecter
 
+var (
+	// ErrNotConnected it's an error received when an operation needs
+	// a connection, but Connect wasn't called.
+	ErrNotConnected = errors.New("not connected to MongoDB")
+)
+
 var (
 	// NewConnecter returns a new real database connecter.
 	NewConnecter = connecter.New
 	// NewTestableConnecter returns a temporary database connecter.
 	NewTestableConnecter = connecter.NewTestable
+	// NewRecordingConnecter returns a connecter recording operations
+	// made through another connecter on a cassette file. Only the
+	// first server of that connecter is recorded.
+	NewRecordingConnecter = connecter.NewRecorder
+	// NewReplayConnecter returns a connecter replaying a cassette
+	// file, without connecting to any database.
+	NewReplayConnecter = connecter.NewReplay
 	// conn connects with MongoDB
 	conn = NewConnecter()
 )
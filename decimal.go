@@ -0,0 +1,69 @@
+package mongo
+
+import (
+	"math/big"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// Decimal128 it's a decimal number stored as BSON decimal128, with up
+// to 34 digits, exact on base 10. It's the type meant for money and
+// other values that can't be stored as float. The zero value it's 0.
+//
+// Decimal128 values are immutable: Add, Sub, Mul, Quo and Round return
+// new ones. Cmp compares them, and BigInt and BigFloat convert them.
+type Decimal128 = bsonutils.Decimal128
+
+// RoundingMode it's the rule used by Round method of Decimal128 when
+// digits are discarded.
+type RoundingMode = bsonutils.RoundingMode
+
+const (
+	// RoundHalfEven rounds to nearest, ties to the even digit.
+	RoundHalfEven = bsonutils.RoundHalfEven
+	// RoundHalfUp rounds to nearest, ties away from zero.
+	RoundHalfUp = bsonutils.RoundHalfUp
+	// RoundDown rounds toward zero, truncating.
+	RoundDown = bsonutils.RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp = bsonutils.RoundUp
+	// RoundFloor rounds toward negative infinity.
+	RoundFloor = bsonutils.RoundFloor
+	// RoundCeiling rounds toward positive infinity.
+	RoundCeiling = bsonutils.RoundCeiling
+)
+
+var (
+	// ErrInvalidDecimal it's an error received when parsing a string
+	// that isn't a decimal number.
+	ErrInvalidDecimal = bsonutils.ErrInvalidDecimal
+	// ErrDecimalRange it's an error received when a number it's too
+	// large to be held by a Decimal128.
+	ErrDecimalRange = bsonutils.ErrDecimalRange
+	// ErrDecimalNotFinite it's an error received when converting NaN
+	// or infinite Decimal128 values to types that can't hold them.
+	ErrDecimalNotFinite = bsonutils.ErrDecimalNotFinite
+)
+
+// ParseDecimal128 returns the Decimal128 of s, a decimal number like
+// "-12.50" or "1.5E+3", also accepting "NaN", "Inf" and "Infinity".
+// Numbers with more than 34 digits are rounded half to even.
+func ParseDecimal128(s string) (d Decimal128, err error) {
+	d, err = bsonutils.ParseDecimal128(s)
+	return
+}
+
+// NewDecimal128 returns the Decimal128 of coef×10^exp, like cents with
+// exp -2. Coefficients with more than 34 digits are rounded half to
+// even.
+func NewDecimal128(coef *big.Int, exp int) (d Decimal128, err error) {
+	d, err = bsonutils.NewDecimal128(coef, exp)
+	return
+}
+
+// Decimal128FromBigFloat returns the Decimal128 with the shortest
+// decimal representation of f, rounded to 34 digits if needed.
+func Decimal128FromBigFloat(f *big.Float) (d Decimal128, err error) {
+	d, err = bsonutils.Decimal128FromBigFloat(f)
+	return
+}
@@ -0,0 +1,273 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo/bson"
+)
+
+// invoice it's a Documenter holding money as Decimal128.
+type invoice struct {
+	Document `bson:",inline"`
+	Total    Decimal128 `bson:"total" validate:"min=0"`
+}
+
+// New creates a new instance of invoice.
+func (i *invoice) New() (doc Documenter) {
+	doc = Bind(&invoice{})
+	return
+}
+
+// Validate checks nothing on invoice.
+func (i *invoice) Validate() (err error) {
+	return
+}
+
+// decimal returns the Decimal128 of s, ignoring errors.
+func decimal(s string) (d Decimal128) {
+	d, _ = ParseDecimal128(s)
+	return
+}
+
+// Feature Parse and print Decimal128 values
+// - As a developer,
+// - I want to parse decimal numbers from strings and print them,
+// - So that I could read money from users without losing cents.
+func Test_Parse_and_print_Decimal128_values(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a string '%[1]v'", func(when bdd.When, args ...interface{}) {
+		when("ParseDecimal128 is called", func(it bdd.It) {
+			d, err := ParseDecimal128(args[0].(string))
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should print as '%[2]v'", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), d.String())
+			})
+		})
+	}, like(
+		s("19.90", "19.90"), s("-0.001", "-0.001"), s("+1500", "1500"),
+		s("1.5E+3", "1.5E+3"), s("1.5e-8", "1.5E-8"), s(".5", "0.5"),
+		s("NaN", "NaN"), s("-Infinity", "-Inf"), s("inf", "Inf"),
+		s("12345678901234567890123456789012345", "1.234567890123456789012345678901234E+34"),
+	))
+
+	given(t, "an invalid string '%[1]v'", func(when bdd.When, args ...interface{}) {
+		when("ParseDecimal128 is called", func(it bdd.It) {
+			_, err := ParseDecimal128(args[0].(string))
+
+			it("should return %[2]v", func(assert bdd.Assert) {
+				assert.Equal(args[1], err)
+			})
+		})
+	}, like(
+		s("", ErrInvalidDecimal), s("abc", ErrInvalidDecimal), s("1e", ErrInvalidDecimal),
+		s("1.2.3", ErrInvalidDecimal), s("--1", ErrInvalidDecimal), s("1E+7000", ErrDecimalRange),
+	))
+
+	given(t, "a zero Decimal128", func(when bdd.When, args ...interface{}) {
+		var d Decimal128
+
+		when("it's printed", func(it bdd.It) {
+			it("should print as '0'", func(assert bdd.Assert) {
+				assert.Equal("0", d.String())
+				assert.Equal(0, d.Sign())
+			})
+		})
+	})
+}
+
+// Feature Calculate with Decimal128 values
+// - As a developer,
+// - I want to add, multiply, divide, round and compare decimals,
+// - So that I could calculate money exactly.
+func Test_Calculate_with_Decimal128_values(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "some Decimal128 values", func(when bdd.When, args ...interface{}) {
+		when("used on arithmetic", func(it bdd.It) {
+			it("should add and subtract exactly", func(assert bdd.Assert) {
+				assert.Equal("0.3", decimal("0.1").Add(decimal("0.2")).String())
+				assert.Equal("0.00", decimal("10").Sub(decimal("10.00")).String())
+				assert.Equal("-5.5", decimal("4.5").Sub(decimal("10")).String())
+			})
+			it("should multiply keeping the digits", func(assert bdd.Assert) {
+				assert.Equal("59.70", decimal("19.90").Mul(decimal("3")).String())
+				assert.Equal("-0.0006", decimal("0.02").Mul(decimal("-0.03")).String())
+			})
+			it("should divide rounding to 34 digits", func(assert bdd.Assert) {
+				assert.Equal("2.5", decimal("10").Quo(decimal("4")).String())
+				assert.Equal("0.3333333333333333333333333333333333", decimal("1").Quo(decimal("3")).String())
+				assert.Equal("0.6666666666666666666666666666666667", decimal("2").Quo(decimal("3")).String())
+			})
+			it("should handle infinities and NaN", func(assert bdd.Assert) {
+				assert.True(decimal("1").Quo(decimal("0")).IsInf(1))
+				assert.True(decimal("-1").Quo(decimal("0")).IsInf(-1))
+				assert.True(decimal("0").Quo(decimal("0")).IsNaN())
+				assert.True(decimal("Inf").Add(decimal("-Inf")).IsNaN())
+				assert.True(decimal("Inf").Mul(decimal("-2")).IsInf(-1))
+			})
+		})
+
+		when("rounded to 2 places", func(it bdd.It) {
+			it("should follow the RoundingMode", func(assert bdd.Assert) {
+				assert.Equal("2.34", decimal("2.345").Round(2, RoundHalfEven).String())
+				assert.Equal("2.36", decimal("2.355").Round(2, RoundHalfEven).String())
+				assert.Equal("2.35", decimal("2.345").Round(2, RoundHalfUp).String())
+				assert.Equal("2.34", decimal("2.349").Round(2, RoundDown).String())
+				assert.Equal("2.35", decimal("2.341").Round(2, RoundUp).String())
+				assert.Equal("-2.35", decimal("-2.341").Round(2, RoundFloor).String())
+				assert.Equal("-2.34", decimal("-2.349").Round(2, RoundCeiling).String())
+				assert.Equal("10.00", decimal("9.999").Round(2, RoundHalfEven).String())
+			})
+			it("should keep values with fewer digits", func(assert bdd.Assert) {
+				assert.Equal("2.3", decimal("2.3").Round(2, RoundHalfEven).String())
+			})
+		})
+
+		when("compared", func(it bdd.It) {
+			it("should compare values, not representations", func(assert bdd.Assert) {
+				assert.Equal(0, decimal("1.0").Cmp(decimal("1.00")))
+				assert.Equal(0, decimal("-0").Cmp(decimal("0")))
+				assert.Equal(-1, decimal("-1").Cmp(decimal("0.5")))
+				assert.Equal(1, decimal("1E+3").Cmp(decimal("999.99")))
+				assert.Equal(-1, decimal("-2").Cmp(decimal("-1")))
+				assert.Equal(1, decimal("Inf").Cmp(decimal("1E+6000")))
+				assert.Equal(-1, decimal("NaN").Cmp(decimal("-Inf")))
+			})
+		})
+	})
+}
+
+// Feature Convert Decimal128 values
+// - As a developer,
+// - I want to convert decimals from and to math/big values,
+// - So that I could use them with other libraries.
+func Test_Convert_Decimal128_values(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a Decimal128 d of 12.50", func(when bdd.When, args ...interface{}) {
+		d := decimal("12.50")
+
+		when("converted to big values", func(it bdd.It) {
+			coef, exp, errInt := d.BigInt()
+			f, errFloat := d.BigFloat()
+
+			it("should return its coefficient and exponent", func(assert bdd.Assert) {
+				assert.NoError(errInt)
+				assert.Equal("1250", coef.String())
+				assert.Equal(-2, exp)
+			})
+			it("should return its big.Float", func(assert bdd.Assert) {
+				assert.NoError(errFloat)
+				assert.Equal("12.5", f.Text('g', -1))
+			})
+		})
+
+		when("created from big values", func(it bdd.It) {
+			cents, errCents := NewDecimal128(big.NewInt(-1999), -2)
+			tenth, errTenth := Decimal128FromBigFloat(big.NewFloat(0.1))
+
+			it("should return the values expected", func(assert bdd.Assert) {
+				assert.NoError(errCents)
+				assert.NoError(errTenth)
+				assert.Equal("-19.99", cents.String())
+				assert.Equal("0.1", tenth.String())
+			})
+		})
+
+		when("NaN it's converted", func(it bdd.It) {
+			_, _, errInt := decimal("NaN").BigInt()
+			_, errFloat := decimal("NaN").BigFloat()
+
+			it("should return ErrDecimalNotFinite", func(assert bdd.Assert) {
+				assert.Equal(ErrDecimalNotFinite, errInt)
+				assert.Equal(ErrDecimalNotFinite, errFloat)
+			})
+		})
+	})
+}
+
+// Feature Store Decimal128 values
+// - As a developer,
+// - I want Decimal128 fields stored as BSON decimal128,
+// - So that money keeps its exact value on database.
+func Test_Store_Decimal128_values(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "an invoice i with total 19.90", func(when bdd.When, args ...interface{}) {
+		i := &invoice{Total: decimal("19.90")}
+
+		when("mapped with MapDocumenter and marshalled by mgo", func(it bdd.It) {
+			m, errMap := MapDocumenter(i)
+			buf, errMarshal := bson.Marshal(m)
+
+			var raw bson.M
+			errRaw := bson.Unmarshal(buf, &raw)
+
+			var out invoice
+			errOut := bson.Unmarshal(buf, &out)
+
+			it("should store total as BSON decimal128", func(assert bdd.Assert) {
+				assert.NoError(errMap)
+				assert.NoError(errMarshal)
+				assert.NoError(errRaw)
+				total, ok := raw["total"].(bson.Decimal128)
+				assert.True(ok)
+				assert.Equal("19.90", total.String())
+			})
+			it("should read back the same total", func(assert bdd.Assert) {
+				assert.NoError(errOut)
+				assert.Equal(i.Total, out.Total)
+			})
+		})
+
+		when("a M decoded by mgo it's marshalled with MarshalM", func(it bdd.It) {
+			buf, _ := bson.Marshal(M{"total": decimal("19.90")})
+
+			var m M
+			errDecode := bson.Unmarshal(buf, &m)
+			doc, errMarshal := MarshalM(m)
+
+			var out invoice
+			errOut := RawDocument(doc).Unmarshal(&out)
+
+			it("should keep total as BSON decimal128", func(assert bdd.Assert) {
+				assert.NoError(errDecode)
+				assert.NoError(errMarshal)
+				assert.NoError(errOut)
+				assert.Equal(i.Total, out.Total)
+			})
+		})
+
+		when("the total was stored as a double", func(it bdd.It) {
+			buf, _ := bson.Marshal(M{"total": 19.9})
+
+			var out invoice
+			err := bson.Unmarshal(buf, &out)
+
+			it("should read it as a Decimal128", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("19.9", out.Total.String())
+			})
+		})
+
+		when("the total it's negative", func(it bdd.It) {
+			err := ValidateStruct(&invoice{Total: decimal("-0.01")})
+			schema, _ := JSONSchema(i)
+
+			it("should fail the min rule", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+			it("should have a decimal schema with minimum", func(assert bdd.Assert) {
+				assert.Equal(M{"bsonType": "decimal", "minimum": 0.0}, schema["properties"].(M)["total"])
+			})
+		})
+	})
+}
@@ -90,6 +90,35 @@ are the fixtures, a map of documents to populate on this temp database.
 Lastly is a optional address of a Reset function to drop database and
 repopulate it.
 
+Record and Replay
+
+Tests can also run without any MongoDB, replaying operations recorded
+before. Decorate any connecter with a recording connecter, and the
+operations made with it are saved on a cassette file at Disconnect:
+
+	conn := mongo.NewRecordingConnecter(mongo.NewTestableConnecter(
+		"", "testing", fixtures,
+	), "testdata/products.json")
+	mongo.InitConnecter(conn)
+
+Later, the cassette can be replayed. Each operation receives the reply
+recorded for it, and operations not recorded fail with an error. The
+optional address of a Verify function reports unexpected operations,
+and recorded operations that weren't made, catching query regressions:
+
+	var verify func() error
+	mongo.InitConnecter(mongo.NewReplayConnecter("testdata/products.json", &verify))
+
+	Connect()
+	defer Disconnect()
+
+	// Start any tests, and then check with verify().
+
+Note that operations are matched by content, so documents with ids
+and timestamps generated during the test won't match a recording made
+on another run. Only the first server reached by the decorated
+connecter is recorded, so it should connect to a single server.
+
 Documenter
 
 Mongo package also contain utility functions to help modeling documents.
@@ -107,7 +136,7 @@ The Documenter can be used like this:
 		CreatedOnV	int64		`bson:"created_on"`
 		UpdatedOnV	int64		`bson:"updated_on"`
 		NameV		string		`form:"name" binding:"required" bson:"name"`
-		PriceV		float32		`form:"price" binding:"required" bson:"price"`
+		PriceV		mongo.Decimal128	`form:"price" binding:"required" bson:"price"`
 	}
 
 	// Implement the Documenter interface.
@@ -166,6 +195,161 @@ The Documenter can be used like this:
 	p.CalculateCreatedOn()
 	t := p.CreatedOn()
 
+Most of these methods can be avoided embedding the Document type, that
+already implements them. Only New and Validate need to be written:
+
+	type Product struct {
+		mongo.Document	`bson:",inline"`
+		NameV			string	`bson:"name"`
+		PriceV			mongo.Decimal128	`bson:"price"`
+	}
+
+	func (p *Product) New() (doc mongo.Documenter) {
+		doc = mongo.Bind(&Product{})
+		return
+	}
+
+	func (p *Product) Validate() (err error) {
+		return
+	}
+
+Bind links the embedded Document to Product, so Map and Init work
+with all its fields. Handle binds every document it uses. A copy of a
+bound Product isn't bound, returning ErrNotBound until bound again. Documents
+implementing RawInitializer are decoded by Handle and Repository
+straight from the BSON read from collection, without building a M
+given to Init. Types embedding Document can opt in with:
+
+	func (p *Product) InitRaw(raw mongo.RawDocument) error {
+		return p.Document.UnmarshalRaw(raw)
+	}
+
+Rules for fields can be declared with validate tags, checked by
+ValidateStruct. Handle checks them on Insert and Update, before
+calling Validate, returning a *ValidationError with the field errors
+found:
+
+	type Product struct {
+		mongo.Document	`bson:",inline"`
+		NameV			string	`bson:"name" validate:"required,max=100"`
+		PriceV			mongo.Decimal128	`bson:"price" validate:"min=0"`
+		KindV			string	`bson:"kind" validate:"oneof=food drink"`
+	}
+
+The same rules, with the types of fields, can be checked by server on
+writes from any client. JSONSchema derives the $jsonSchema validator
+of a Documenter. Once enabled, every Handle sets it on its collection
+when created, and every Repository on its first operation, like their
+indexes:
+
+	mongo.SetSchemaValidation(true)
+
+	p := handler.NewProductHandler()
+	if err := p.SchemaErr(); err != nil {
+		// The validator couldn't be set on collection.
+	}
+
+It can also be set at any time with ApplySchema:
+
+	err := mongo.ApplySchema("products", product.New())
+
+Money and other values that must be exact on base 10 should use
+Decimal128, stored as BSON decimal128, instead of float32 or float64:
+
+	price, err := mongo.ParseDecimal128("19.90")
+	total := price.Mul(quantity).Add(shipping).Round(2, mongo.RoundHalfEven)
+
+	if total.Cmp(limit) > 0 {
+		// ...
+	}
+
+Documents can be written and read as MongoDB Extended JSON v2, keeping
+ObjectId, dates, Decimal128 and binary values. Relaxed mode it's meant
+for API responses, and Canonical for fixtures:
+
+	out, err := mongo.MarshalExtJSON(product, mongo.Relaxed)
+
+	var products []*Product
+	err = mongo.UnmarshalExtJSON(fixture, &products)
+
+A RawDocument reads fields of BSON documents by dotted paths, without
+decoding them whole:
+
+	doc, err := mongo.NewRawDocument(data)
+	if v, found := doc.Lookup("items.0.price"); found {
+		price, _ := v.Decimal128()
+		// ...
+	}
+
+Dump files, with documents prefixed by their length as written by
+mongodump, are read and written one document at a time by DumpReader
+and DumpWriter, refusing corrupted documents and the ones too large:
+
+	r := mongo.NewDumpReader(file)
+	for {
+		var p Product
+		if err := r.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		// ...
+	}
+
+Fields of types from other packages, that can't implement bson.Getter
+and bson.Setter, can be mapped by functions registered for their types:
+
+	mongo.RegisterEncoder(reflect.TypeOf(big.Int{}), func(v reflect.Value) (interface{}, error) {
+		n := v.Interface().(big.Int)
+		return n.String(), nil
+	})
+
+Types tagged for other formats, or without tags, can define their own
+Encoder, choosing the tags and the NamingStrategy of fields, by
+implementing Encoding. Its keys are used everywhere documents are
+mapped, read, validated, searched by Query or described by JSONSchema:
+
+	func (p *Product) Encoder() mongo.Encoder {
+		return mongo.Encoder{OmitEmptyDefault: true, FallbackTagName: "json", Naming: mongo.SnakeCase}
+	}
+
+Other options, like failing on unknown keys, can be used on their Map
+and Init methods:
+
+	func (p *Product) Init(in mongo.M) (err error) {
+		var d mongo.Documenter = p
+		dec := mongo.Decoder{FallbackTagName: "json", Naming: mongo.SnakeCase, Strict: true}
+		err = mongo.InitDocumenterWith(dec, in, &d)
+		return
+	}
+
+The same options can be set on the Encoder of DumpWriter and the
+Decoder of DumpReader.
+
+The functions NowInMilli and NewID use the Clock and IDGenerator of
+connection. They can be replaced to get deterministic values on tests:
+
+	mongo.SetClock(mongo.SteppingClock(start, time.Second))
+	mongo.SetIDGenerator(mongo.SequentialIDGenerator(1))
+	defer mongo.SetClock(nil)
+	defer mongo.SetIDGenerator(nil)
+
+A Handle can also use its own Clock and IDGenerator, through SetClock
+and SetIDGenerator methods, when its Documenter implements Stamper.
+
+Documenter types always hold created_on and updated_on as int64 in
+Millisecond unit, but Handle can store them as BSON datetime, allowing
+TTL indexes and date operators, or as Unix seconds:
+
+	mongo.SetTimeFormat(mongo.DateTime)
+
+	// Or only for a single Handle.
+	p.SetTimeFormat(mongo.Seconds)
+
+Collections with documents already stored can be converted with:
+
+	n, err := mongo.MigrateTimeFormat("products", mongo.Millis, mongo.DateTime)
+
 Handle
 
 Mongo package also enable creation of Handle, a type that connects to
@@ -185,7 +369,7 @@ for creating embedding types.
 	}
 
 For each new type, a constructor may be needed, and for that Handler
-has a basic constructor. This constructor initializes DocumentV with a
+has a basic constructor. This constructor initializes Document with a
 new model.Documenter type. It also initializes Handle with the name of
 collection used on Handle, and optional indexes for collection.
 
@@ -237,6 +421,38 @@ use of Handle:
 		return
 	}
 
+Search maps can also be built with Query, starting from Q. The method
+Where checks the operators and the fields used, against the bson tags
+of Document, before setting the search map:
+
+	err := p.Where(mongo.Q.Eq("name", "bread").Gt("price", 1).Or(
+		mongo.Q.In("kind", "food", "drink"),
+		mongo.Q.Exists("promo", true),
+	))
+
+Errors received match ErrInvalidQuery or ErrUnknownField. The map can
+be built alone with the M and MFor methods of Query.
+
+Collections with a text index, declared with TextIndex, can be
+searched by relevance with Search. Each result has the document found
+and its score, with the most relevant first:
+
+	p := mongo.NewHandle("products", product.New(), mongo.TextIndex("english", map[string]int{
+		"name":        10,
+		"description": 2,
+	}))
+
+	results, err := p.Search("chocolate cake")
+
+Locations can be stored with the Point and Polygon types, saved as
+GeoJSON. With a 2dsphere index, declared with GeoIndex, documents can
+be found with Near, receiving the distance in meters of each one, and
+Within a Polygon:
+
+	p := mongo.NewHandle("stores", store.New(), mongo.GeoIndex("location"))
+
+	results, err := p.Near(mongo.NewPoint(-35.2, -5.8), 5000)
+
 The complicated functions are Find and FindAll which requires casting
 for the Document type:
 
@@ -260,5 +476,125 @@ for the Document type:
 	}
 
 For all functions written, verification it's advisable.
+
+All this code can be generated by the mongogen command, from a struct
+with bson tags. It creates the Documenter methods, except Validate, a
+ProductHandle with the methods above, and indexes declared with mongo
+tags:
+
+	//go:generate mongogen -type Product
+	type Product struct {
+		IDV			ObjectId	`bson:"_id"`
+		CreatedOnV	int64		`bson:"created_on"`
+		UpdatedOnV	int64		`bson:"updated_on"`
+		NameV		string		`bson:"name" mongo:"unique"`
+	}
+
+Install it with go get github.com/ddspog/mongo/cmd/mongogen.
+
+A Handle exports the documents matching its document data, or search
+map, to dump files, Extended JSON lines or CSV, and imports them back
+in batches, replacing the documents with the same _id on Upsert:
+
+	n, err := p.Export(file, mongo.ExportOptions{
+		Format: mongo.CSV,
+		Fields: []string{"name", "price"},
+	})
+
+	n, err = p.Import(file, mongo.ImportOptions{
+		Format:   mongo.BSONDump,
+		Upsert:   true,
+		Progress: func(n int) { log.Printf("%d documents", n) },
+	})
+
+The mongoio command does the same from a terminal. Install it with go
+get github.com/ddspog/mongo/cmd/mongoio.
+
+Fields holding sensitive data can be encrypted with AES-GCM before
+being stored, tagging them with mongo:"encrypt". Values are encrypted
+on Map and decrypted on Init, with keys of the KeyProvider defined:
+
+	type Patient struct {
+		mongo.Document	`bson:",inline"`
+		SSNV	string	`bson:"ssn" mongo:"encrypt,deterministic"`
+		NotesV	string	`bson:"notes" mongo:"encrypt"`
+	}
+
+	mongo.SetKeyProvider(mongo.StaticKeyProvider("2024", keys))
+
+Each value stores the id of its key, so keys can be rotated while old
+ones are kept on KeyProvider. Deterministic fields have equal values
+encrypted equally, and can be searched by equality, with Eq, Ne, In
+and Nin on a Query, or the same operators on M filters given to
+SearchFor and Repository, whose values are encrypted too. Values are
+encrypted with every key of KeyProviders implementing KeyLister, like
+StaticKeyProvider, so documents stored before a rotation are still
+found, while searches made with the document of Handle use only the
+current key. Other fields are encrypted randomly, and can't be
+searched at all. Fields of nested structs, also inside arrays, are
+encrypted too, and searched by their paths, like "guardians.phone".
+Fields tagged inside maps, or on structs nested on themselves, can't
+be reached, so documents holding them return ErrEncryptionUnsupported.
+Documents are encrypted the same way when written as Extended JSON or
+on dumps, and decrypted when read from them into Documenters, while
+reading into M keeps the values encrypted. Handle leaves fields
+encrypted randomly out of searches made with its document.
+
+Errors received from Handle operations can be told apart with
+errors.Is, matching ErrNotFound, ErrDuplicateKey, ErrTimeout and
+ErrValidation, and inspected with errors.As on types NotFoundError,
+DuplicateKeyError, TimeoutError and ValidationError. They still wrap
+the errors received from mgo:
+
+	err := p.SetDocument(product).Insert()
+
+	var dup *mongo.DuplicateKeyError
+	if errors.As(err, &dup) {
+		// dup.Index and dup.Key tells the value repeated.
+	}
+
+A Handle can be shared by many goroutines. Each operation uses the
+document and search map defined when it starts, and the connection
+closes only after all operations in progress end. Documents are
+checked on each Insert and Update, and errors loading indexes don't
+stop operations, being reported by IndexErr:
+
+	p := handler.NewProductHandler()
+	if err := p.IndexErr(); err != nil {
+		// The indexes couldn't be created.
+	}
+
+Indexes
+
+The indexes given to NewHandle and NewRepository are declared on the
+IndexManager returned by Indexes. Missing indexes are created once per
+process, on the first Handle or operation of a collection. Indexes
+declared with options different from the ones on database are kept,
+being reported by IndexErr with an *IndexDriftError. To change them,
+and drop indexes no longer declared, plan and apply the changes:
+
+	plans, err := mongo.Indexes().Plan()
+	for _, p := range plans {
+		fmt.Println(p)
+	}
+
+	err = mongo.Indexes().Apply(plans...)
+
+Changes on documents can be written as numbered migrations, applied in
+order with the package github.com/ddspog/mongo/migrations.
+
+Repository
+
+When no state is wanted at all, a Repository receives documents and
+filters on each call, using a cloned session for each operation:
+
+	r := mongo.NewRepository("products", product.New(), product.CollectionIndexes...)
+
+	err := r.Insert(p)
+	d, err := r.Find(mongo.M{"name": "bread"})
+	n, err := r.Count(nil)
+
+The documents returned are created by the New method of the prototype
+given, and a single Repository can be shared by all goroutines.
 */
 package mongo
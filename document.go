@@ -0,0 +1,180 @@
+package mongo
+
+import (
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrNotBound it's returned when using Map or Init of a Document
+	// not bound to the type embedding it, or copied from one bound.
+	ErrNotBound = errors.New("Document not bound, use Bind")
+)
+
+// Document it's a type implementing every Documenter method, except
+// New and Validate, to be embedded on types representing documents.
+// The embedding type only needs to implement those two methods.
+// It must be embedded inline, so its fields are stored on the same
+// level of the embedding type fields:
+//
+//     type Product struct {
+//         mongo.Document `bson:",inline"`
+//         NameV          string `bson:"name"`
+//     }
+//
+// Map and Init work on the whole embedding type, but only when Document
+// is bound to it, as done by Bind. Handle binds every document it uses.
+// Copies of a document bound, like p2 := *p1, must be bound again.
+type Document struct {
+	IDV        ObjectId `bson:"_id"`
+	CreatedOnV int64    `bson:"created_on"`
+	UpdatedOnV int64    `bson:"updated_on"`
+	self       Documenter
+}
+
+// binder it's implemented by types embedding Document.
+type binder interface {
+	bind(Documenter)
+	document() *Document
+}
+
+// Bind links the Document embedded on d to d itself, so Map and Init
+// methods work with all fields of the embedding type. It returns d,
+// allowing use on New methods:
+//
+//     func (p *Product) New() mongo.Documenter {
+//         return mongo.Bind(&Product{})
+//     }
+//
+// Types not embedding Document, and nil pointers, are returned
+// untouched.
+func Bind(d Documenter) (out Documenter) {
+	if b, ok := d.(binder); ok {
+		if v := reflect.ValueOf(d); v.Kind() != reflect.Ptr || !v.IsNil() {
+			b.bind(d)
+		}
+	}
+
+	out = d
+	return
+}
+
+// bind links Document to the embedding document.
+func (d *Document) bind(self Documenter) {
+	d.self = self
+}
+
+// document returns the Document embedded.
+func (d *Document) document() *Document {
+	return d
+}
+
+// bound returns the document embedding d. It returns ErrNotBound if d
+// isn't bound, or if the document bound doesn't embed d itself, being
+// d a copy of the Document bound.
+func (d *Document) bound() (self Documenter, err error) {
+	if b, ok := d.self.(binder); !ok || b.document() != d {
+		err = ErrNotBound
+		return
+	}
+
+	self = d.self
+	return
+}
+
+// Map translates the document to a M object, more easily read by mgo
+// methods. It returns ErrNotBound if Document isn't bound.
+func (d *Document) Map() (out M, err error) {
+	var self Documenter
+	if self, err = d.bound(); err == nil {
+		out, err = MapDocumenter(self)
+	}
+	return
+}
+
+// Init translates a M received, to the document structure. It fills
+// the structure fields with the values of each key in the M received.
+// It returns ErrNotBound if Document isn't bound.
+func (d *Document) Init(in M) (err error) {
+	var self Documenter
+	if self, err = d.bound(); err != nil {
+		return
+	}
+
+	err = InitDocumenter(in, &self)
+
+	// Initialization resets the structure, losing the link.
+	d.self = self
+	return
+}
+
+// UnmarshalRaw works as Init, decoding the document raw straight to
+// the structure, without building a M. It returns ErrNotBound if
+// Document isn't bound. Types embedding Document opt in to be decoded
+// this way by Handle, implementing RawInitializer with it:
+//
+//     func (p *Product) InitRaw(raw mongo.RawDocument) error {
+//         return p.Document.UnmarshalRaw(raw)
+//     }
+func (d *Document) UnmarshalRaw(raw RawDocument) (err error) {
+	var self Documenter
+	if self, err = d.bound(); err != nil {
+		return
+	}
+
+	err = decoderOf(self).Unmarshal(raw, self)
+
+	// Initialization resets the structure, losing the link.
+	d.self = self
+	return
+}
+
+// ID returns the _id attribute of a Document.
+func (d *Document) ID() (id ObjectId) {
+	id = d.IDV
+	return
+}
+
+// CreatedOn returns the created_on attribute of a Document.
+func (d *Document) CreatedOn() (t int64) {
+	t = d.CreatedOnV
+	return
+}
+
+// UpdatedOn returns the updated_on attribute of a Document.
+func (d *Document) UpdatedOn() (t int64) {
+	t = d.UpdatedOnV
+	return
+}
+
+// GenerateID creates a new id for a Document.
+func (d *Document) GenerateID() {
+	d.IDV = NewID()
+}
+
+// CalculateCreatedOn update the created_on attribute with a value
+// corresponding to actual time.
+func (d *Document) CalculateCreatedOn() {
+	d.CreatedOnV = NowInMilli()
+}
+
+// CalculateUpdatedOn update the updated_on attribute with a value
+// corresponding to actual time.
+func (d *Document) CalculateUpdatedOn() {
+	d.UpdatedOnV = NowInMilli()
+}
+
+// SetID defines the _id attribute of a Document.
+func (d *Document) SetID(id ObjectId) {
+	d.IDV = id
+}
+
+// SetCreatedOn defines the created_on attribute of a Document.
+func (d *Document) SetCreatedOn(t int64) {
+	d.CreatedOnV = t
+}
+
+// SetUpdatedOn defines the updated_on attribute of a Document.
+func (d *Document) SetUpdatedOn(t int64) {
+	d.UpdatedOnV = t
+}
@@ -0,0 +1,314 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// item it's a type embedding the Document struct.
+type item struct {
+	Document `bson:",inline"`
+	NameV    string `bson:"name"`
+}
+
+// New creates a new item bound to its Document.
+func (i *item) New() (doc Documenter) {
+	doc = Bind(&item{})
+	return
+}
+
+// Validate checks for problems on item.
+func (i *item) Validate() (err error) {
+	return
+}
+
+// InitRaw fills item with the document raw, decoded straight to it.
+func (i *item) InitRaw(raw RawDocument) (err error) {
+	err = i.Document.UnmarshalRaw(raw)
+	return
+}
+
+// titled it's a type overriding Init, reading its name from title.
+type titled struct {
+	Document `bson:",inline"`
+	NameV    string `bson:"name"`
+}
+
+// New creates a new titled bound to its Document.
+func (i *titled) New() (doc Documenter) {
+	doc = Bind(&titled{})
+	return
+}
+
+// Validate checks for problems on titled.
+func (i *titled) Validate() (err error) {
+	return
+}
+
+// Init fills titled with in, taking the name from key title.
+func (i *titled) Init(in M) (err error) {
+	in["name"] = in["title"]
+	err = i.Document.Init(in)
+	return
+}
+
+// Feature Model documents embedding Document
+// - As a developer,
+// - I want to be able to embed Document on my types,
+// - So that I don't need to write the Documenter methods on each one.
+func Test_Model_documents_embedding_Document(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a bound item i with ID '%[1]v' and name '%[2]v'", func(when bdd.When, args ...interface{}) {
+		i := Bind(&item{}).(*item)
+		i.SetID(ObjectIdHex(args[0].(string)))
+		i.NameV = args[1].(string)
+
+		when("i.Map() is called", func(it bdd.It) {
+			out, err := i.Map()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should contain _id and name of item", func(assert bdd.Assert) {
+				assert.Equal(ObjectIdHex(args[0].(string)), out["_id"])
+				assert.Equal(args[1].(string), out["name"])
+			})
+		})
+
+		when("i.Init() is called with a M with name 'other'", func(it bdd.It) {
+			err := i.Init(M{
+				"_id":  ObjectIdHex(args[0].(string)),
+				"name": "other",
+			})
+			out, _ := i.Map()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("i.NameV should return 'other'", func(assert bdd.Assert) {
+				assert.Equal("other", i.NameV)
+			})
+			it("i.Map() should still contain the name", func(assert bdd.Assert) {
+				assert.Equal("other", out["name"])
+			})
+		})
+
+		when("i.GenerateID() and i.CalculateCreatedOn() are called", func(it bdd.It) {
+			SetClock(FrozenClock(timeFmt("22-03-2000 10:12:21")))
+			defer resetUtils()
+
+			i.GenerateID()
+			i.CalculateCreatedOn()
+
+			it("i.ID() should differ from '%[1]v'", func(assert bdd.Assert) {
+				assert.NotEqual(args[0].(string), i.ID().Hex())
+			})
+			it("i.CreatedOn() should return the time of Clock", func(assert bdd.Assert) {
+				assert.Equal(expectedNowInMilli(timeFmt("22-03-2000 10:12:21")), i.CreatedOn())
+			})
+		})
+	}, like(
+		s(id1, "soap"), s(id2, "towel"),
+	))
+
+	given(t, "an unbound item i with name '%[1]v'", func(when bdd.When, args ...interface{}) {
+		i := &item{
+			NameV: args[0].(string),
+		}
+
+		when("i.Map() and i.Init() are called", func(it bdd.It) {
+			_, errMap := i.Map()
+			errInit := i.Init(M{})
+
+			it("should return ErrNotBound on both", func(assert bdd.Assert) {
+				assert.Equal(ErrNotBound, errMap)
+				assert.Equal(ErrNotBound, errInit)
+			})
+		})
+	}, like(
+		s("soap"), s("towel"),
+	))
+
+	given(t, "a copy c, with name '%[1]v', of a bound item i", func(when bdd.When, args ...interface{}) {
+		i := Bind(&item{NameV: "original"}).(*item)
+		c := *i
+		c.NameV = args[0].(string)
+
+		when("c.Map() and c.Init() are called", func(it bdd.It) {
+			_, errMap := c.Map()
+			errInit := c.Init(M{"name": "other"})
+
+			it("should return ErrNotBound on both", func(assert bdd.Assert) {
+				assert.Equal(ErrNotBound, errMap)
+				assert.Equal(ErrNotBound, errInit)
+			})
+			it("should leave i untouched", func(assert bdd.Assert) {
+				assert.Equal("original", i.NameV)
+			})
+		})
+
+		when("c is bound and c.Map() is called", func(it bdd.It) {
+			out, err := Bind(&c).Map()
+
+			it("should map the name '%[1]v' of c", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(args[0].(string), out["name"])
+			})
+		})
+	}, like(
+		s("soap"), s("towel"),
+	))
+
+	given(t, "a Handle h receiving an unbound item with name '%[1]v'", func(when bdd.When, args ...interface{}) {
+		h := NewHandle("items", &item{
+			NameV: args[0].(string),
+		})
+
+		when("h.Document().Map() is called", func(it bdd.It) {
+			out, err := h.Document().Map()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should contain name '%[1]v'", func(assert bdd.Assert) {
+				assert.Equal(args[0].(string), out["name"])
+			})
+		})
+
+		when("h.Clean() is called", func(it bdd.It) {
+			h.Clean()
+			out, _ := h.Document().Map()
+
+			it("should map no name", func(assert bdd.Assert) {
+				assert.Nil(out["name"])
+			})
+		})
+	}, like(
+		s("soap"), s("towel"),
+	))
+}
+
+// Feature Decode documents straight from raw BSON
+// - As a developer,
+// - I want documents read from collection decoded straight to my types,
+// - So that they aren't decoded and encoded again through M.
+func Test_Decode_documents_straight_from_raw_BSON(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a raw document d with times stored as datetime", func(when bdd.When, args ...interface{}) {
+		on := time.Date(2018, 1, 2, 3, 4, 5, 6e6, time.UTC)
+		data, _ := bsonutils.Marshal(M{
+			"_id":        ObjectIdHex(id1),
+			"name":       "soap",
+			"created_on": on,
+		})
+		d := RawDocument(data)
+
+		when("a bound item calls InitRaw(d)", func(it bdd.It) {
+			i := Bind(&item{}).(*item)
+			err := i.InitRaw(d)
+			out, _ := i.Map()
+
+			it("should fill the fields of item", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(ObjectIdHex(id1), i.ID())
+				assert.Equal("soap", i.NameV)
+			})
+			it("should keep item bound", func(assert bdd.Assert) {
+				assert.Equal("soap", out["name"])
+			})
+		})
+
+		when("an unbound item calls InitRaw(d)", func(it bdd.It) {
+			err := (&item{}).InitRaw(d)
+
+			it("should return ErrNotBound", func(assert bdd.Assert) {
+				assert.Equal(ErrNotBound, err)
+			})
+		})
+
+		when("a Handle of titled, overriding Init, reads d with a title", func(it bdd.It) {
+			data, _ := bsonutils.Marshal(M{"_id": ObjectIdHex(id1), "title": "towel"})
+			h := NewHandle("titled", &titled{})
+			i := h.newDocument()
+			err := h.initRaw(i, RawDocument(data))
+
+			it("should decode the titled through its Init", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("towel", i.(*titled).NameV)
+			})
+		})
+
+		when("a Handle of items using DateTime reads d", func(it bdd.It) {
+			h := NewHandle("items", &item{})
+			h.SetTimeFormat(DateTime)
+			i := h.newDocument()
+			err := h.initRaw(i, d)
+
+			it("should decode the item with created_on in milliseconds", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("soap", i.(*item).NameV)
+				assert.Equal(inMilli(on), i.CreatedOn())
+			})
+		})
+
+		when("a Handle of products, without InitRaw, reads d", func(it bdd.It) {
+			h := NewHandle("products", newProduct())
+			h.SetTimeFormat(DateTime)
+			p := h.newDocument()
+			err := h.initRaw(p, d)
+
+			it("should decode the product through Init", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(ObjectIdHex(id1), p.ID())
+				assert.Equal(inMilli(on), p.CreatedOn())
+			})
+		})
+	})
+}
+
+// benchmarkItem returns a Handle of items and a raw item, to benchmark
+// the decoding of documents read from collection.
+func benchmarkItem() (h *Handle, raw RawDocument) {
+	h = NewHandle("items", &item{})
+	raw, _ = bsonutils.Marshal(M{
+		"_id":        ObjectIdHex(id1),
+		"name":       "soap",
+		"created_on": int64(1514862245006),
+		"updated_on": int64(1514862245006),
+	})
+	return
+}
+
+// Benchmark_Decode_documents_through_M decodes documents as done
+// before RawInitializer, through a M given to Init.
+func Benchmark_Decode_documents_through_M(b *testing.B) {
+	h, raw := benchmarkItem()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		m, _ := UnmarshalToM(raw)
+		if err := h.init(h.newDocument(), m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark_Decode_documents_straight_from_raw_BSON decodes documents
+// as done by Handle, straight from the raw document.
+func Benchmark_Decode_documents_straight_from_raw_BSON(b *testing.B) {
+	h, raw := benchmarkItem()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		if err := h.initRaw(h.newDocument(), raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
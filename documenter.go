@@ -1,5 +1,9 @@
 package mongo
 
+import (
+	"reflect"
+)
+
 // Documenter it's an interface that could be common to any documents
 // types used to store values on a MongoDB. It contains getters and
 // generates to important documents values: _id, created_on and
@@ -16,3 +20,48 @@ type Documenter interface {
 	CalculateCreatedOn()
 	CalculateUpdatedOn()
 }
+
+// Stamper it's an optional interface for Documenter types, allowing a
+// Handle with its own Clock or IDGenerator to define _id, created_on
+// and updated_on values directly.
+type Stamper interface {
+	SetID(ObjectId)
+	SetCreatedOn(int64)
+	SetUpdatedOn(int64)
+}
+
+// Encoding it's an optional interface for Documenter types stored with
+// their own Encoder options, like json tags or snake case keys. The
+// keys of its Encoder are used by MapDocumenter, InitDocumenter,
+// JSONSchema, ValidateStruct and Query.MFor, and so by Handle and
+// Repository.
+type Encoding interface {
+	Encoder() Encoder
+}
+
+// RawInitializer it's an optional interface for Documenter types,
+// allowing Handle to decode documents read from collection straight
+// into them, instead of building a M to be given to Init. Document
+// doesn't implement it, so types overriding Init are never decoded
+// skipping it. Types embedding Document can implement it calling
+// Document.UnmarshalRaw.
+type RawInitializer interface {
+	InitRaw(RawDocument) error
+}
+
+// decodeDocument fills d with the document raw, when d implements
+// RawInitializer and Stamper, converting its times from format f. It
+// returns false, doing nothing, if d doesn't implement them, or has
+// fields encrypted, decrypted only by Init.
+func decodeDocument(d Documenter, raw RawDocument, f TimeFormat) (decoded bool, err error) {
+	r, isRaw := d.(RawInitializer)
+	s, isStamper := d.(Stamper)
+	fields, errFields := encryptedFields(reflect.TypeOf(d), encoderOf(d))
+
+	if decoded = isRaw && isStamper && errFields == nil && len(fields) == 0; decoded {
+		if err = r.InitRaw(raw); err == nil {
+			f.loadRawTimes(raw, s)
+		}
+	}
+	return
+}
@@ -3,10 +3,14 @@
 package mongo
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo/internal/bsonutils"
+	"github.com/globalsign/mgo/bson"
 )
 
 // Feature Enable embedding with Document
@@ -110,10 +114,7 @@ func Test_Calculate_Document_values(t *testing.T) {
 	given, like, s := bdd.Sentences().All()
 
 	given(t, "a empty Product p at current time %[1]v", func(when bdd.When, args ...interface{}) {
-		now = func() (t time.Time) {
-			t = args[0].(time.Time)
-			return
-		}
+		SetClock(FrozenClock(args[0].(time.Time)))
 		defer resetUtils()
 
 		p := newProduct()
@@ -146,10 +147,9 @@ func Test_Generate_ID_of_Document(t *testing.T) {
 		p := newProduct()
 
 		when("p.GenerateID() is called", func(it bdd.It) {
-			newID = func() (id ObjectId) {
-				id = ObjectIdHex(args[0].(string))
-				return
-			}
+			SetIDGenerator(IDGeneratorFunc(func() ObjectId {
+				return ObjectIdHex(args[0].(string))
+			}))
 			defer resetUtils()
 
 			p.GenerateID()
@@ -212,3 +212,173 @@ func Test_Encoding_to_map_object(t *testing.T) {
 		s(id1), s(id2), s(id3),
 	))
 }
+
+// Feature Map documents concurrently
+// - As a developer,
+// - I want to map documents while other goroutines marshal values,
+// - So that each one uses its own options, without races.
+//
+// Run with -race to check it.
+func Test_Map_documents_concurrently(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a Product p without updated_on, mapped and marshalled by 20 goroutines", func(when bdd.When, args ...interface{}) {
+		p := newProductWithID(id1)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var omitted, kept int
+
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				if m, err := p.Map(); err == nil {
+					if _, ok := m["updated_on"]; !ok {
+						mu.Lock()
+						omitted++
+						mu.Unlock()
+					}
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				if buf, err := bsonutils.Marshal(p); err == nil {
+					if m, err := UnmarshalToM(buf); err == nil {
+						if _, ok := m["updated_on"]; ok {
+							mu.Lock()
+							kept++
+							mu.Unlock()
+						}
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		when("the results are checked", func(it bdd.It) {
+			it("p.Map() should always omit updated_on", func(assert bdd.Assert) {
+				assert.Equal(20, omitted)
+			})
+			it("bsonutils.Marshal(p) should always keep updated_on", func(assert bdd.Assert) {
+				assert.Equal(20, kept)
+			})
+		})
+	})
+}
+
+// contact it's a type tagged for json, mapped with its own Encoder and
+// Decoder options.
+type contact struct {
+	Document `bson:",inline"`
+	FullName string `validate:"required"`
+	PhoneV   string `json:"phone,omitempty" mongo:"encrypt"`
+}
+
+// New creates a new contact bound to its Document.
+func (c *contact) New() (doc Documenter) {
+	doc = Bind(&contact{})
+	return
+}
+
+// Validate checks for problems on contact.
+func (c *contact) Validate() (err error) {
+	return
+}
+
+// Encoder returns the Encoder of contact, with json tags and snake
+// case keys.
+func (c *contact) Encoder() (enc Encoder) {
+	enc = Encoder{OmitEmptyDefault: true, FallbackTagName: "json", Naming: SnakeCase}
+	return
+}
+
+// Init fills contact with in, with json tags and snake case keys,
+// failing on unknown keys.
+func (c *contact) Init(in M) (err error) {
+	var d Documenter = c
+	dec := Decoder{FallbackTagName: "json", Naming: SnakeCase, Strict: true}
+	err = InitDocumenterWith(dec, in, &d)
+	return
+}
+
+// Feature Map documents with Encoder and Decoder options
+// - As a developer,
+// - I want to choose the tags and naming of fields of my documents,
+// - So that I could store types tagged for other formats.
+func Test_Map_documents_with_Encoder_and_Decoder_options(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a contact c with full name and phone, and keys a and b", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		c := Bind(&contact{FullName: "Ana", PhoneV: "555-0100"}).(*contact)
+		c.SetID(ObjectIdHex(id1))
+
+		when("c.Map() is called", func(it bdd.It) {
+			out, err := c.Map()
+			_, isBinary := out["phone"].(bson.Binary)
+
+			it("should use json tags and snake case keys", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(ObjectIdHex(id1), out["_id"])
+				assert.Equal("Ana", out["full_name"])
+			})
+			it("should encrypt the phone on its json key", func(assert bdd.Assert) {
+				assert.True(isBinary)
+			})
+
+			i := Bind(&contact{}).(*contact)
+			errInit := i.Init(out)
+
+			it("should be read back by Init", func(assert bdd.Assert) {
+				assert.NoError(errInit)
+				assert.Equal("Ana", i.FullName)
+				assert.Equal("555-0100", i.PhoneV)
+			})
+		})
+
+		when("the keys of contact are checked", func(it bdd.It) {
+			schema, errSchema := JSONSchema(c)
+			props := schema["properties"].(M)
+			_, hasFullName := props["full_name"]
+			_, hasPhone := props["phone"]
+
+			errValidate := ValidateStruct(&contact{})
+			var ve *ValidationError
+			isValidation := errors.As(errValidate, &ve)
+
+			_, errKnown := Q.Eq("full_name", "Ana").MFor(&contact{})
+			_, errUnknown := Q.Eq("fullname", "Ana").MFor(&contact{})
+
+			it("should name the properties of JSONSchema by the Encoder", func(assert bdd.Assert) {
+				assert.NoError(errSchema)
+				assert.True(hasFullName)
+				assert.True(hasPhone)
+			})
+			it("should name the fields of ValidationError by the Encoder", func(assert bdd.Assert) {
+				assert.True(isValidation)
+				assert.Equal("full_name", ve.Fields[0].Field)
+			})
+			it("should check the fields of Query by the Encoder", func(assert bdd.Assert) {
+				assert.NoError(errKnown)
+				assert.True(errors.Is(errUnknown, ErrUnknownField))
+			})
+		})
+
+		when("c.Init() is called with an unknown key", func(it bdd.It) {
+			err := c.Init(M{"full_name": "Ana", "age": 30})
+
+			it("should return an error naming the key", func(assert bdd.Assert) {
+				assert.Error(err)
+				assert.Contains(err.Error(), `"age"`)
+			})
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package mongo
+
+import (
+	"io"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// MaxDocumentSize it's the size limit of documents used by DumpReader
+// and DumpWriter without one, the limit of documents on MongoDB.
+const MaxDocumentSize = bsonutils.MaxDocumentSize
+
+// ErrDocumentTooLarge it's an error received when reading or writing a
+// document larger than the size limit.
+var ErrDocumentTooLarge = bsonutils.ErrDocumentTooLarge
+
+// DumpReader reads consecutive BSON documents, each prefixed by its
+// length, like the .bson files written by mongodump, one at a time.
+type DumpReader struct {
+	*bsonutils.Reader
+}
+
+// DumpWriter writes BSON documents, each prefixed by its length, like
+// the .bson files written by mongodump.
+type DumpWriter struct {
+	*bsonutils.Writer
+}
+
+// NewDumpReader returns a DumpReader of documents on r.
+func NewDumpReader(r io.Reader) (dr *DumpReader) {
+	dr = &DumpReader{bsonutils.NewReader(r)}
+	return
+}
+
+// NewDumpWriter returns a DumpWriter of documents on w. Empty fields
+// of documents are omitted, as done by MapDocumenter.
+func NewDumpWriter(w io.Writer) (dw *DumpWriter) {
+	dw = &DumpWriter{bsonutils.NewWriter(w)}
+	dw.Encoder = documenterEncoder
+	return
+}
+
+// Decode reads the next document into out, unmarshalled with the
+// Decoder of DumpReader. It returns io.EOF when there are no more
+// documents. A Documenter it's read as done by InitDocumenterWith,
+// with the fields tagged with mongo:"encrypt" decrypted, and with the
+// keys of its own Encoder if it implements Encoding.
+func (dr *DumpReader) Decode(out interface{}) (err error) {
+	if d, ok := out.(Documenter); ok {
+		dec := dr.Decoder
+		if _, ok := d.(Encoding); ok {
+			dec = decoderOf(d)
+		}
+
+		var doc RawDocument
+		var m M
+		if doc, err = dr.ReadRaw(); err == nil {
+			if m, err = UnmarshalToM(doc); err == nil {
+				err = initDocumenter(dec, m, d)
+			}
+		}
+		return
+	}
+
+	err = dr.Reader.Decode(out)
+	return
+}
+
+// Encode writes in, marshalled with the Encoder of DumpWriter. A
+// Documenter it's mapped as done by MapDocumenterWith, with the fields
+// tagged with mongo:"encrypt" encrypted, and with its own Encoder if
+// it implements Encoding.
+func (dw *DumpWriter) Encode(in interface{}) (err error) {
+	if d, ok := in.(Documenter); ok {
+		enc := dw.Encoder
+		if e, ok := d.(Encoding); ok {
+			enc = e.Encoder()
+		}
+
+		var doc RawDocument
+		if doc, err = documenterRaw(enc, d); err == nil {
+			err = dw.WriteRaw(doc)
+		}
+		return
+	}
+
+	err = dw.Writer.Encode(in)
+	return
+}
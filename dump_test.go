@@ -0,0 +1,123 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// Feature Stream documents of dump files
+// - As a developer,
+// - I want to read and write documents of dump files one at a time,
+// - So that I can process dumps without loading them into memory.
+func Test_Stream_documents_of_dump_files(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a DumpWriter w writing a M, an item and a RawDocument", func(when bdd.When, args ...interface{}) {
+		var buf bytes.Buffer
+		w := NewDumpWriter(&buf)
+		raw, _ := MarshalM(M{"name": "raw"})
+
+		errM := w.Encode(M{"name": "map"})
+		errItem := w.Encode(&item{NameV: "item"})
+		errRaw := w.Encode(RawDocument(raw))
+
+		when("the buffer is read by a DumpReader r", func(it bdd.It) {
+			r := NewDumpReader(bytes.NewReader(buf.Bytes()))
+
+			var names []string
+			var err error
+			for err == nil {
+				var i item
+				if err = r.Decode(&i); err == nil {
+					names = append(names, i.NameV)
+				}
+			}
+
+			it("should write every document", func(assert bdd.Assert) {
+				assert.NoError(errM)
+				assert.NoError(errItem)
+				assert.NoError(errRaw)
+			})
+			it("should read the documents in order, ending with io.EOF", func(assert bdd.Assert) {
+				assert.Equal([]string{"map", "item", "raw"}, names)
+				assert.Equal(io.EOF, err)
+			})
+			it("r.Offset() should be the size of buffer", func(assert bdd.Assert) {
+				assert.Equal(int64(buf.Len()), r.Offset())
+			})
+		})
+
+		when("the buffer is truncated and read by a DumpReader r", func(it bdd.It) {
+			r := NewDumpReader(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+			_, err1 := r.ReadRaw()
+			_, err2 := r.ReadRaw()
+			_, err3 := r.ReadRaw()
+			_, err4 := r.ReadRaw()
+
+			it("should read the documents before the last one", func(assert bdd.Assert) {
+				assert.NoError(err1)
+				assert.NoError(err2)
+			})
+			it("should return io.ErrUnexpectedEOF on the last one, every time", func(assert bdd.Assert) {
+				assert.True(errors.Is(err3, io.ErrUnexpectedEOF))
+				assert.Equal(err3, err4)
+			})
+		})
+
+		when("the buffer is read by a DumpReader r with a small MaxSize", func(it bdd.It) {
+			r := NewDumpReader(bytes.NewReader(buf.Bytes()))
+			r.MaxSize = 10
+			_, err := r.ReadRaw()
+
+			it("should return ErrDocumentTooLarge", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrDocumentTooLarge))
+			})
+		})
+	})
+
+	given(t, "a stream with a corrupted document", func(when bdd.When, args ...interface{}) {
+		doc, _ := MarshalM(M{"name": "soap"})
+		bad := append([]byte(nil), doc...)
+		bad[len(bad)-1] = 1
+
+		when("it's read by a DumpReader r", func(it bdd.It) {
+			r := NewDumpReader(bytes.NewReader(append(append([]byte(nil), doc...), bad...)))
+			_, errFirst := r.ReadRaw()
+			_, errSecond := r.ReadRaw()
+
+			it("should return ErrCorrupted with the offset of document", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.True(errors.Is(errSecond, ErrCorrupted))
+				assert.Contains(errSecond.Error(), fmt.Sprintf("offset %d", len(doc)))
+			})
+		})
+
+		when("it's written by a DumpWriter w", func(it bdd.It) {
+			var buf bytes.Buffer
+			w := NewDumpWriter(&buf)
+			err := w.WriteRaw(bad)
+
+			it("should return ErrCorrupted, writing nothing", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrCorrupted))
+				assert.Equal(0, buf.Len())
+			})
+		})
+
+		when("a DumpWriter w with a small MaxSize writes it", func(it bdd.It) {
+			w := NewDumpWriter(&bytes.Buffer{})
+			w.MaxSize = 10
+			err := w.WriteRaw(doc)
+
+			it("should return ErrDocumentTooLarge", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrDocumentTooLarge))
+			})
+		})
+	})
+}
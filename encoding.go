@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"reflect"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// Encoder holds the options used to marshal documents, like the tag
+// and naming strategy of struct fields, and what to do with inline maps
+// repeating their keys. It's used by MapDocumenterWith and DumpWriter.
+type Encoder = bsonutils.Encoder
+
+// Decoder holds the options used to unmarshal documents, like the tag
+// and naming strategy of struct fields, and if unknown keys fail. It's
+// used by InitDocumenterWith and DumpReader.
+type Decoder = bsonutils.Decoder
+
+// NamingStrategy defines the key of struct fields without tags, from
+// their names.
+type NamingStrategy = bsonutils.NamingStrategy
+
+const (
+	// LowerCase uses the field name in lower case, like httpserver for
+	// HTTPServer. It's the default.
+	LowerCase = bsonutils.LowerCase
+	// SnakeCase uses the field name in snake case, like http_server for
+	// HTTPServer.
+	SnakeCase = bsonutils.SnakeCase
+	// CamelCase uses the field name in camel case, like httpServer for
+	// HTTPServer.
+	CamelCase = bsonutils.CamelCase
+)
+
+// InlineConflict defines what Encoder does with keys of an inline map
+// that are also keys of struct fields.
+type InlineConflict = bsonutils.InlineConflict
+
+const (
+	// InlineConflictError fails the marshaling. It's the default.
+	InlineConflictError = bsonutils.InlineConflictError
+	// InlineConflictFieldWins marshals the struct field, ignoring the
+	// key of inline map.
+	InlineConflictFieldWins = bsonutils.InlineConflictFieldWins
+	// InlineConflictMapWins marshals the key of inline map, ignoring
+	// the struct field.
+	InlineConflictMapWins = bsonutils.InlineConflictMapWins
+)
+
+// fieldKeyer tells the keys of struct fields, like Encoder and
+// Decoder.
+type fieldKeyer interface {
+	FieldKey(field reflect.StructField) (key string, inline bool)
+}
+
+// encoderOf returns the Encoder of documents like v, defined by its
+// Encoder method if it implements Encoding, or the one of
+// MapDocumenter otherwise.
+func encoderOf(v interface{}) (enc Encoder) {
+	if e, ok := v.(Encoding); ok {
+		enc = e.Encoder()
+	} else {
+		enc = documenterEncoder
+	}
+	return
+}
+
+// decoderOf returns the Decoder reading documents like v, with the
+// keys of its Encoder.
+func decoderOf(v interface{}) (dec Decoder) {
+	enc := encoderOf(v)
+	dec = Decoder{
+		TagName:         enc.TagName,
+		FallbackTagName: enc.FallbackTagName,
+		Naming:          enc.Naming,
+		Registry:        enc.Registry,
+	}
+	return
+}
@@ -0,0 +1,653 @@
+package mongo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+	"github.com/globalsign/mgo/bson"
+)
+
+// KeyProvider it's an interface for types holding the AES keys that
+// encrypt fields of documents tagged with mongo:"encrypt". Keys must
+// have 16, 24 or 32 bytes, using AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting new values, with its id.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of id, decrypting values encrypted with it.
+	Key(id string) (key []byte, err error)
+}
+
+// KeyLister it's an optional interface for KeyProviders, listing the
+// ids of all keys they read. Queries comparing deterministic fields
+// match values encrypted with any of them, so documents stored before
+// a key rotation are still found. Without it, only values encrypted
+// with the current key are matched.
+type KeyLister interface {
+	// KeyIDs returns the ids of keys read by Key.
+	KeyIDs() (ids []string, err error)
+}
+
+const (
+	// encryptedSubtype it's the BSON binary subtype of encrypted values,
+	// on the range of user defined subtypes.
+	encryptedSubtype = 0x80
+	// encryptedVersion it's the version of layout of encrypted values.
+	encryptedVersion = 1
+	// randomized and deterministic are the modes of encrypted values.
+	randomized    = 0
+	deterministic = 1
+)
+
+var (
+	// ErrNoKeyProvider it's an error received when encrypting or
+	// decrypting fields without a KeyProvider defined.
+	ErrNoKeyProvider = errors.New("no KeyProvider defined")
+	// ErrUnknownKey it's an error received from StaticKeyProvider when
+	// there isn't a key with the id asked.
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrDecryption it's matched by errors.Is on errors received when
+	// an encrypted value can't be read, being corrupted, tampered or
+	// encrypted with other key.
+	ErrDecryption = errors.New("decryption failed")
+	// ErrEncryptedField it's an error received when a Query uses a field
+	// encrypted, other than by equality on a deterministic one, or with
+	// a value that doesn't fit on its type.
+	ErrEncryptedField = errors.New("encrypted field can't be queried")
+	// ErrEncryptionUnsupported it's an error received mapping documents
+	// with fields tagged with mongo:"encrypt" that can't be reached to
+	// be encrypted, inside maps or structs nested on themselves.
+	ErrEncryptionUnsupported = errors.New("encrypted field can't be reached")
+
+	// keyProvider stores the KeyProvider used by connection.
+	keyProvider = struct {
+		sync.RWMutex
+		p KeyProvider
+	}{}
+
+	// encryptedFieldsCache stores the encryptedFields of each type, by
+	// the fieldKeyer naming their keys.
+	encryptedFieldsCache sync.Map
+)
+
+// SetKeyProvider defines the KeyProvider encrypting and decrypting
+// fields of documents tagged with mongo:"encrypt", on MapDocumenter
+// and InitDocumenter. Receiving nil, documents with those fields can't
+// be mapped, nor initialized with values encrypted.
+func SetKeyProvider(p KeyProvider) {
+	keyProvider.Lock()
+	keyProvider.p = p
+	keyProvider.Unlock()
+}
+
+// currentKeyProvider returns the KeyProvider used by connection, or
+// ErrNoKeyProvider if there isn't one.
+func currentKeyProvider() (p KeyProvider, err error) {
+	keyProvider.RLock()
+	p = keyProvider.p
+	keyProvider.RUnlock()
+
+	if p == nil {
+		err = ErrNoKeyProvider
+	}
+	return
+}
+
+// staticKeyProvider it's a KeyProvider with keys held on memory.
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// StaticKeyProvider returns a KeyProvider with keys, by id, encrypting
+// new values with the key of current. Keys of old values can be kept,
+// while they're still read.
+func StaticKeyProvider(current string, keys map[string][]byte) (p KeyProvider) {
+	p = &staticKeyProvider{current: current, keys: keys}
+	return
+}
+
+// CurrentKey returns the key of current id.
+func (p *staticKeyProvider) CurrentKey() (id string, key []byte, err error) {
+	id = p.current
+	key, err = p.Key(id)
+	return
+}
+
+// Key returns the key of id.
+func (p *staticKeyProvider) Key(id string) (key []byte, err error) {
+	var found bool
+	if key, found = p.keys[id]; !found {
+		err = fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return
+}
+
+// KeyIDs returns the ids of keys, sorted.
+func (p *staticKeyProvider) KeyIDs() (ids []string, err error) {
+	ids = make([]string, 0, len(p.keys))
+	for id := range p.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return
+}
+
+// encryptOption returns if field sf it's encrypted, and deterministic,
+// by its mongo tag.
+func encryptOption(sf reflect.StructField) (encrypted, determined bool) {
+	for _, opt := range strings.Split(sf.Tag.Get("mongo"), ",") {
+		switch strings.TrimSpace(opt) {
+		case "encrypt":
+			encrypted = true
+		case "deterministic":
+			determined = true
+		}
+	}
+	determined = determined && encrypted
+	return
+}
+
+// encryptedField it's a field of document tagged to be encrypted.
+type encryptedField struct {
+	t             reflect.Type
+	deterministic bool
+}
+
+// encryptedFieldsKey identifies the encryptedFields of a type, with the
+// fieldKeyer naming their keys.
+type encryptedFieldsKey struct {
+	t    reflect.Type
+	keys fieldKeyer
+}
+
+// encryptedFieldsEntry it's the result of encryptedFields, cached.
+type encryptedFieldsEntry struct {
+	fields map[string]encryptedField
+	err    error
+}
+
+// encryptedFields returns the fields encrypted of documents of type t,
+// by their keys on keys. Fields of inline structs have their own keys,
+// while fields of nested structs, also inside arrays, have the keys of
+// each level separated by dots, like "address.zip". It returns
+// ErrEncryptionUnsupported if there are fields encrypted that can't be
+// reached, inside maps or structs nested on themselves.
+func encryptedFields(t reflect.Type, keys fieldKeyer) (fields map[string]encryptedField, err error) {
+	cacheKey := encryptedFieldsKey{t, keys}
+	if cached, found := encryptedFieldsCache.Load(cacheKey); found {
+		entry := cached.(encryptedFieldsEntry)
+		fields, err = entry.fields, entry.err
+		return
+	}
+
+	fields = map[string]encryptedField{}
+	err = addEncryptedFields(indirect(t), keys, "", fields, map[reflect.Type]bool{})
+	encryptedFieldsCache.Store(cacheKey, encryptedFieldsEntry{fields, err})
+	return
+}
+
+// addEncryptedFields puts the fields encrypted of struct t on fields,
+// with their keys after prefix. The structs being walked are on seen.
+func addEncryptedFields(t reflect.Type, keys fieldKeyer, prefix string, fields map[string]encryptedField, seen map[reflect.Type]bool) (err error) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField() && err == nil; i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name, inline := keys.FieldKey(sf)
+		encrypted, determined := encryptOption(sf)
+		nested, walk := nestedStructType(sf.Type)
+
+		switch {
+		case name == "-":
+		case inline && !seen[indirect(sf.Type)]:
+			err = addEncryptedFields(indirect(sf.Type), keys, prefix, fields, seen)
+		case encrypted:
+			fields[prefix+name] = encryptedField{t: sf.Type, deterministic: determined}
+		case walk && !seen[nested]:
+			err = addEncryptedFields(nested, keys, prefix+name+".", fields, seen)
+		case encryptsAny(sf.Type, map[reflect.Type]bool{}):
+			err = fmt.Errorf("%w: %s", ErrEncryptionUnsupported, prefix+name)
+		}
+	}
+	return
+}
+
+// nestedStructType returns the struct stored as a nested document by
+// values of type t, also as elements of arrays, and if its fields can
+// be walked.
+func nestedStructType(t reflect.Type) (nested reflect.Type, walk bool) {
+	nested = indirect(t)
+	for (nested.Kind() == reflect.Slice || nested.Kind() == reflect.Array) && nested.Elem().Kind() != reflect.Uint8 {
+		nested = indirect(nested.Elem())
+	}
+
+	switch {
+	case nested.Kind() != reflect.Struct:
+	case nested == timeType, nested == decimalType:
+	case nested.Implements(getterType), reflect.PtrTo(nested).Implements(getterType):
+	default:
+		walk = true
+	}
+	return
+}
+
+// encryptsAny reports if values of type t hold fields tagged with
+// mongo:"encrypt", on any level. The structs already checked are on
+// checked.
+func encryptsAny(t reflect.Type, checked map[reflect.Type]bool) (r bool) {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		r = encryptsAny(t.Elem(), checked)
+	case reflect.Struct:
+		if checked[t] {
+			return
+		}
+		checked[t] = true
+
+		for i := 0; i < t.NumField() && !r; i++ {
+			sf := t.Field(i)
+			encrypted, _ := encryptOption(sf)
+			r = encrypted || encryptsAny(sf.Type, checked)
+		}
+	}
+	return
+}
+
+// encryptRaw returns doc with the values of fields encrypted replaced
+// by their encryption, keeping the order of keys.
+func encryptRaw(doc RawDocument, fields map[string]encryptedField) (out RawDocument, err error) {
+	out, err = encryptElements(doc, fields, "", false)
+	return
+}
+
+// encryptElements returns doc, a document or array on path prefix,
+// with the values of fields encrypted replaced by their encryption.
+// Elements of arrays have the path of array.
+func encryptElements(doc RawDocument, fields map[string]encryptedField, prefix string, array bool) (out RawDocument, err error) {
+	out = make(RawDocument, 4, len(doc))
+
+	errEach := doc.Each(func(name []byte, v RawValue) bool {
+		key, children := prefix+string(name), prefix+string(name)+"."
+		if array {
+			key, children = strings.TrimSuffix(prefix, "."), prefix
+		}
+
+		f, found := fields[key]
+		switch {
+		case found && !array && !v.IsNull():
+			var b bson.Binary
+			if b, err = encryptValue(wrapValue(v), f.deterministic); err != nil {
+				err = fmt.Errorf("field %s: %w", key, err)
+				return false
+			}
+			v = binaryValue(b)
+		case (v.Kind == bson.ElementDocument || v.Kind == bson.ElementArray) && encryptsUnder(fields, children):
+			var sub RawDocument
+			if sub, err = encryptElements(RawDocument(v.Data), fields, children, v.Kind == bson.ElementArray); err != nil {
+				return false
+			}
+			v.Data = sub
+		}
+
+		out = append(append(append(out, v.Kind), name...), 0)
+		out = append(out, v.Data...)
+		return true
+	})
+
+	if err == nil {
+		err = errEach
+	}
+	out = append(out, 0)
+	binary.LittleEndian.PutUint32(out, uint32(len(out)))
+	return
+}
+
+// encryptsUnder reports if any of fields has its path after prefix.
+func encryptsUnder(fields map[string]encryptedField, prefix string) (r bool) {
+	for key := range fields {
+		if r = strings.HasPrefix(key, prefix); r {
+			return
+		}
+	}
+	return
+}
+
+// binaryValue returns b as a BSON binary value.
+func binaryValue(b bson.Binary) (v RawValue) {
+	data := make([]byte, 4, 4+1+len(b.Data))
+	binary.LittleEndian.PutUint32(data, uint32(len(b.Data)))
+	data = append(append(data, b.Kind), b.Data...)
+	v = RawValue{Kind: bson.ElementBinary, Data: data}
+	return
+}
+
+// omitRandomized removes from m, a document mapped, the values of
+// fields encrypted randomly, which never equal the ones stored.
+func omitRandomized(m M, fields map[string]encryptedField) {
+	for key, f := range fields {
+		if !f.deterministic {
+			deleteAt(m, strings.Split(key, "."))
+		}
+	}
+}
+
+// deleteAt removes the values on path from v, from each element of
+// arrays on it.
+func deleteAt(v interface{}, path []string) {
+	switch x := v.(type) {
+	case M:
+		if len(path) == 1 {
+			delete(x, path[0])
+		} else {
+			deleteAt(x[path[0]], path[1:])
+		}
+	case []interface{}:
+		for _, elem := range x {
+			deleteAt(elem, path)
+		}
+	}
+}
+
+// decryptFields returns m with the values of fields encrypted on it
+// decrypted. The values not encrypted are kept, so fields can be
+// encrypted on documents already stored. The m received isn't changed.
+func decryptFields(m M, fields map[string]encryptedField) (out M, err error) {
+	var v interface{} = m
+	for key := range fields {
+		if v, _, err = decryptAt(v, strings.Split(key, ".")); err != nil {
+			err = fmt.Errorf("field %s: %w", key, err)
+			return
+		}
+	}
+	out = v.(M)
+	return
+}
+
+// decryptAt returns v with the values on path decrypted, and if any
+// was. Documents and arrays holding values decrypted are copied, so v
+// isn't changed.
+func decryptAt(v interface{}, path []string) (out interface{}, changed bool, err error) {
+	out = v
+	if len(path) == 0 {
+		if b, ok := v.(bson.Binary); ok && b.Kind == encryptedSubtype {
+			out, err = decryptValue(b)
+			changed = err == nil
+		}
+		return
+	}
+
+	switch x := v.(type) {
+	case M:
+		var sub interface{}
+		if sub, changed, err = decryptAt(x[path[0]], path[1:]); changed {
+			y := make(M, len(x))
+			for k, e := range x {
+				y[k] = e
+			}
+			y[path[0]] = sub
+			out = y
+		}
+	case []interface{}:
+		var y []interface{}
+		for i := 0; i < len(x) && err == nil; i++ {
+			var elem interface{}
+			var elemChanged bool
+			if elem, elemChanged, err = decryptAt(x[i], path); elemChanged {
+				if y == nil {
+					y = append([]interface{}{}, x...)
+				}
+				y[i], changed = elem, true
+			}
+		}
+		if changed {
+			out = y
+		}
+	}
+	return
+}
+
+// encryptQueryValues returns v, a value of field f, encrypted as it's
+// stored with each key read by KeyProvider, to be compared by equality.
+// Values already encrypted are kept.
+func encryptQueryValues(v interface{}, f encryptedField) (out []interface{}, err error) {
+	if b, ok := v.(bson.Binary); v == nil || ok && b.Kind == encryptedSubtype {
+		// Null values aren't encrypted, and encrypted ones are kept.
+		out = []interface{}{v}
+		return
+	}
+
+	// Values of other types are converted to the type of field, as
+	// numbers of other sizes, to have the same encoding. Values changed
+	// by conversion, like 30.5 on an int field, would match others.
+	rv, t := reflect.ValueOf(v), indirect(f.t)
+	if rv.IsValid() && rv.Type() != t && sameKind(rv.Kind(), t.Kind()) {
+		converted := rv.Convert(t)
+		if !sameValue(rv, converted) {
+			err = fmt.Errorf("%w: %v doesn't fit on %s", ErrEncryptedField, v, t)
+			return
+		}
+		v = converted.Interface()
+	}
+
+	var plain []byte
+	var ids []string
+	var p KeyProvider
+	if plain, err = documenterEncoder.Marshal(bson.D{{Name: "v", Value: v}}); err != nil {
+		return
+	}
+	if p, err = currentKeyProvider(); err != nil {
+		return
+	}
+	if ids, err = readKeyIDs(p); err != nil {
+		return
+	}
+
+	out = make([]interface{}, len(ids))
+	for i := 0; i < len(ids) && err == nil; i++ {
+		var key []byte
+		if key, err = p.Key(ids[i]); err == nil {
+			out[i], err = encryptWith(ids[i], key, plain, f.deterministic)
+		}
+	}
+	return
+}
+
+// readKeyIDs returns the ids of keys read by p, the current one first,
+// followed by the others if p implements KeyLister.
+func readKeyIDs(p KeyProvider) (ids []string, err error) {
+	var current string
+	if current, _, err = p.CurrentKey(); err != nil {
+		return
+	}
+	ids = []string{current}
+
+	if l, ok := p.(KeyLister); ok {
+		var listed []string
+		if listed, err = l.KeyIDs(); err != nil {
+			return
+		}
+		for _, id := range listed {
+			if id != current {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return
+}
+
+// encryptValue returns the encryption of plain, a document holding
+// the value on key v, with the current key of KeyProvider.
+func encryptValue(plain []byte, determined bool) (b bson.Binary, err error) {
+	var p KeyProvider
+	if p, err = currentKeyProvider(); err != nil {
+		return
+	}
+
+	var id string
+	var key []byte
+	if id, key, err = p.CurrentKey(); err == nil {
+		b, err = encryptWith(id, key, plain, determined)
+	}
+	return
+}
+
+// encryptWith returns the encryption of plain with key of id. The
+// layout stored it's the version, mode, key id length and key id,
+// followed by the nonce and the AES-GCM sealed value, authenticating
+// the header. Deterministic values use a nonce derived from the key
+// and plain, so equal values have equal encryptions.
+func encryptWith(id string, key []byte, plain []byte, determined bool) (b bson.Binary, err error) {
+	if len(id) > 255 {
+		err = fmt.Errorf("key id %q is longer than 255 bytes", id)
+		return
+	}
+
+	var gcm cipher.AEAD
+	if gcm, err = newGCM(key); err != nil {
+		return
+	}
+
+	header := []byte{encryptedVersion, randomized, byte(len(id))}
+	header = append(header, id...)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if determined {
+		header[1] = deterministic
+		mac := hmac.New(sha256.New, nonceKey(key))
+		mac.Write(header)
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	data := append(append(header, nonce...), gcm.Seal(nil, nonce, plain, header)...)
+	b = bson.Binary{Kind: encryptedSubtype, Data: data}
+	return
+}
+
+// decryptValue returns the value encrypted on b, with the key of its
+// id on KeyProvider.
+func decryptValue(b bson.Binary) (v interface{}, err error) {
+	var p KeyProvider
+	if p, err = currentKeyProvider(); err != nil {
+		return
+	}
+
+	data := b.Data
+	if len(data) < 3 || data[0] != encryptedVersion || len(data) < 3+int(data[2]) {
+		err = fmt.Errorf("%w: unknown layout", ErrDecryption)
+		return
+	}
+	header, data := data[:3+int(data[2])], data[3+int(data[2]):]
+
+	var key []byte
+	if key, err = p.Key(string(header[3:])); err != nil {
+		return
+	}
+
+	var gcm cipher.AEAD
+	if gcm, err = newGCM(key); err != nil {
+		return
+	}
+	if len(data) < gcm.NonceSize() {
+		err = fmt.Errorf("%w: too short", ErrDecryption)
+		return
+	}
+
+	var plain []byte
+	if plain, err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], header); err != nil {
+		err = fmt.Errorf("%w: %s", ErrDecryption, err)
+		return
+	}
+
+	var wrapper bson.M
+	if err = bsonutils.Unmarshal(plain, &wrapper); err == nil {
+		v = wrapper["v"]
+	}
+	return
+}
+
+// wrapValue returns the document holding v on key v, the plain value
+// encrypted. It keeps the BSON encoding of v, so deterministic values
+// are encrypted equally when encoded from the same type.
+func wrapValue(v RawValue) (doc []byte) {
+	size := 4 + 1 + 2 + len(v.Data) + 1
+	doc = make([]byte, 4, size)
+	binary.LittleEndian.PutUint32(doc, uint32(size))
+	doc = append(doc, v.Kind, 'v', 0)
+	doc = append(doc, v.Data...)
+	doc = append(doc, 0)
+	return
+}
+
+// newGCM returns AES-GCM with key.
+func newGCM(key []byte) (gcm cipher.AEAD, err error) {
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err == nil {
+		gcm, err = cipher.NewGCM(block)
+	}
+	return
+}
+
+// nonceKey returns the key deriving nonces of deterministic values,
+// apart from the one encrypting them.
+func nonceKey(key []byte) (k []byte) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("mongo deterministic nonce"))
+	k = mac.Sum(nil)
+	return
+}
+
+// sameValue reports if converted it's the value v, converted back to
+// its type and with the same sign. Values not comparable, converted
+// between types of same kind, are always the same.
+func sameValue(v, converted reflect.Value) (r bool) {
+	if !v.Type().Comparable() {
+		r = true
+		return
+	}
+
+	negative := func(x reflect.Value) bool {
+		switch {
+		case x.Kind() >= reflect.Int && x.Kind() <= reflect.Int64:
+			return x.Int() < 0
+		case x.Kind() == reflect.Float32 || x.Kind() == reflect.Float64:
+			return x.Float() < 0
+		}
+		return false
+	}
+	r = converted.Convert(v.Type()).Interface() == v.Interface() && negative(v) == negative(converted)
+	return
+}
+
+// sameKind reports if values of kinds a and b convert without changing
+// their meaning, being equal kinds or both numbers.
+func sameKind(a, b reflect.Kind) (r bool) {
+	number := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	r = a == b || (number(a) && number(b))
+	return
+}
@@ -0,0 +1,530 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo/bson"
+)
+
+// patient it's a type with fields encrypted.
+type patient struct {
+	Document `bson:",inline"`
+	NameV    string `bson:"name"`
+	SSNV     string `bson:"ssn" mongo:"encrypt,deterministic"`
+	AgeV     int64  `bson:"age,omitempty" mongo:"encrypt,deterministic"`
+	NotesV   string `bson:"notes,omitempty" mongo:"encrypt"`
+}
+
+// New creates a new patient bound to its Document.
+func (p *patient) New() (doc Documenter) {
+	doc = Bind(&patient{})
+	return
+}
+
+// Validate checks for problems on patient.
+func (p *patient) Validate() (err error) {
+	return
+}
+
+// patientKeys returns a KeyProvider encrypting with key current, and
+// holding keys a and b.
+func patientKeys(current string) (p KeyProvider) {
+	p = StaticKeyProvider(current, map[string][]byte{
+		"a": bytes.Repeat([]byte{1}, 32),
+		"b": bytes.Repeat([]byte{2}, 16),
+	})
+	return
+}
+
+// currentKeyOnly it's a KeyProvider hiding the KeyLister of the one
+// embedded.
+type currentKeyOnly struct {
+	KeyProvider
+}
+
+// Feature Encrypt fields of documents
+// - As a developer,
+// - I want fields holding personal data encrypted before being stored,
+// - So that they can't be read from the database without the keys.
+func Test_Encrypt_fields_of_documents(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a patient p with ssn, age and notes, and keys a and b", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		p := Bind(&patient{NameV: "Jane", SSNV: "123-45-6789", AgeV: 30, NotesV: "allergic"}).(*patient)
+		p.SetID(ObjectIdHex(id1))
+
+		when("p.Map() is called twice", func(it bdd.It) {
+			first, errFirst := p.Map()
+			second, _ := p.Map()
+			ssn, isBinary := first["ssn"].(bson.Binary)
+
+			it("should encrypt only the fields tagged", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.Equal("Jane", first["name"])
+				assert.True(isBinary)
+				assert.Equal(byte(encryptedSubtype), ssn.Kind)
+				assert.False(bytes.Contains(ssn.Data, []byte("123-45-6789")))
+			})
+			it("should encrypt deterministic fields equally, and the others not", func(assert bdd.Assert) {
+				assert.Equal(first["ssn"], second["ssn"])
+				assert.Equal(first["age"], second["age"])
+				assert.NotEqual(first["notes"], second["notes"])
+			})
+
+			i := Bind(&patient{}).(*patient)
+			errInit := i.Init(first)
+
+			it("should be decrypted by Init", func(assert bdd.Assert) {
+				assert.NoError(errInit)
+				assert.Equal("123-45-6789", i.SSNV)
+				assert.Equal(int64(30), i.AgeV)
+				assert.Equal("allergic", i.NotesV)
+			})
+			it("should keep the M mapped encrypted", func(assert bdd.Assert) {
+				_, stillBinary := first["ssn"].(bson.Binary)
+				assert.True(stillBinary)
+			})
+		})
+
+		when("p is mapped with key a and read with key b as current", func(it bdd.It) {
+			m, _ := p.Map()
+			SetKeyProvider(patientKeys("b"))
+			rotated, _ := p.Map()
+
+			i := Bind(&patient{}).(*patient)
+			err := i.Init(m)
+
+			it("should still decrypt the values of key a", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("123-45-6789", i.SSNV)
+			})
+			it("should encrypt new values with key b", func(assert bdd.Assert) {
+				assert.NotEqual(m["ssn"], rotated["ssn"])
+			})
+		})
+
+		when("an encrypted value is tampered and read", func(it bdd.It) {
+			m, _ := p.Map()
+			ssn := m["ssn"].(bson.Binary)
+			ssn.Data = append([]byte(nil), ssn.Data...)
+			ssn.Data[len(ssn.Data)-1] ^= 1
+			m["ssn"] = ssn
+
+			err := Bind(&patient{}).Init(m)
+
+			it("should return ErrDecryption", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrDecryption))
+			})
+		})
+
+		when("values not encrypted are read", func(it bdd.It) {
+			i := Bind(&patient{}).(*patient)
+			err := i.Init(M{"ssn": "123-45-6789"})
+
+			it("should read them as they are", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("123-45-6789", i.SSNV)
+			})
+		})
+
+		when("p is read by a Handle from raw BSON", func(it bdd.It) {
+			m, _ := p.Map()
+			raw, _ := MarshalM(m)
+
+			h := NewHandle("patients", &patient{})
+			d := h.newDocument()
+			err := h.initRaw(d, raw)
+
+			it("should decrypt its fields", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("123-45-6789", d.(*patient).SSNV)
+			})
+		})
+
+		when("p.Map() is called without a KeyProvider", func(it bdd.It) {
+			SetKeyProvider(nil)
+			_, err := p.Map()
+
+			it("should return ErrNoKeyProvider", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrNoKeyProvider))
+			})
+		})
+	})
+}
+
+// Feature Query encrypted fields
+// - As a developer,
+// - I want to search documents by equality on deterministic fields,
+// - So that encrypted fields can still identify documents.
+func Test_Query_encrypted_fields(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a patient p mapped with key a", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		p := Bind(&patient{SSNV: "123-45-6789", AgeV: 30}).(*patient)
+		mapped, _ := p.Map()
+
+		when("a Query compares ssn and age by equality", func(it bdd.It) {
+			m, err := Q.Eq("ssn", "123-45-6789").In("age", 30, 31).MFor(&patient{})
+
+			it("should encrypt the values as stored", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(mapped["ssn"], m["ssn"].(M)["$in"].([]interface{})[0])
+				assert.Equal(mapped["age"], m["age"].(M)["$in"].([]interface{})[0])
+			})
+		})
+
+		when("the keys rotate to b, and a Query compares ssn by Eq and Ne", func(it bdd.It) {
+			SetKeyProvider(patientKeys("b"))
+			defer SetKeyProvider(patientKeys("a"))
+
+			eq, errEq := Q.Eq("ssn", "123-45-6789").MFor(&patient{})
+			ne, errNe := Q.Ne("ssn", "123-45-6789").MFor(&patient{})
+			stored, _ := eq["ssn"].(M)["$in"].([]interface{})
+
+			it("should match the values encrypted with b and a, on $in and $nin", func(assert bdd.Assert) {
+				assert.NoError(errEq)
+				assert.NoError(errNe)
+				assert.Len(stored, 2)
+				assert.NotEqual(mapped["ssn"], stored[0])
+				assert.Equal(mapped["ssn"], stored[1])
+				assert.Equal(stored, ne["ssn"].(M)["$nin"])
+			})
+		})
+
+		when("the KeyProvider doesn't implement KeyLister", func(it bdd.It) {
+			SetKeyProvider(currentKeyOnly{patientKeys("a")})
+			defer SetKeyProvider(patientKeys("a"))
+
+			m, err := Q.Eq("ssn", "123-45-6789").MFor(&patient{})
+
+			it("should compare ssn with the value encrypted with the current key", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(mapped["ssn"], m["ssn"])
+			})
+		})
+
+		when("a Query compares ssn by order, or notes by equality", func(it bdd.It) {
+			_, errOrder := Q.Gt("ssn", "1").MFor(&patient{})
+			_, errRandom := Q.Or(Q.Eq("notes", "x")).MFor(&patient{})
+			_, errExists := Q.Exists("notes", true).MFor(&patient{})
+
+			it("should return ErrEncryptedField", func(assert bdd.Assert) {
+				assert.True(errors.Is(errOrder, ErrEncryptedField))
+				assert.True(errors.Is(errRandom, ErrEncryptedField))
+			})
+			it("should accept $exists", func(assert bdd.Assert) {
+				assert.NoError(errExists)
+			})
+		})
+
+		when("a Query compares age with 30.5 or 30.0", func(it bdd.It) {
+			_, errFraction := Q.Eq("age", 30.5).MFor(&patient{})
+			_, errIn := Q.In("age", 30, 30.5).MFor(&patient{})
+			m, errWhole := Q.Eq("age", 30.0).MFor(&patient{})
+
+			it("should return ErrEncryptedField for values changed by conversion", func(assert bdd.Assert) {
+				assert.True(errors.Is(errFraction, ErrEncryptedField))
+				assert.True(errors.Is(errIn, ErrEncryptedField))
+			})
+			it("should encrypt 30.0 as the age 30 stored", func(assert bdd.Assert) {
+				assert.NoError(errWhole)
+				assert.Equal(mapped["age"], m["age"].(M)["$in"].([]interface{})[0])
+			})
+		})
+
+		when("JSONSchema(p) is called", func(it bdd.It) {
+			schema, err := JSONSchema(p)
+			props := schema["properties"].(M)
+
+			it("should declare the encrypted fields as binary", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(M{"bsonType": "binData"}, props["ssn"])
+				assert.Equal("string", props["name"].(M)["bsonType"])
+			})
+		})
+	})
+}
+
+// guardian it's a nested struct of ward, with a field encrypted.
+type guardian struct {
+	Name  string `bson:"name"`
+	Phone string `bson:"phone" mongo:"encrypt,deterministic"`
+}
+
+// ward it's a type with fields encrypted on nested structs.
+type ward struct {
+	Document  `bson:",inline"`
+	NameV     string     `bson:"name"`
+	Primary   guardian   `bson:"primary"`
+	Backup    *guardian  `bson:"backup,omitempty"`
+	Guardians []guardian `bson:"guardians"`
+}
+
+// New creates a new ward bound to its Document.
+func (w *ward) New() (doc Documenter) {
+	doc = Bind(&ward{})
+	return
+}
+
+// Validate checks for problems on ward.
+func (w *ward) Validate() (err error) {
+	return
+}
+
+// registry it's a type with a field encrypted inside map values.
+type registry struct {
+	Document `bson:",inline"`
+	ByName   map[string]guardian `bson:"by_name"`
+}
+
+// New creates a new registry bound to its Document.
+func (r *registry) New() (doc Documenter) {
+	doc = Bind(&registry{})
+	return
+}
+
+// Validate checks for problems on registry.
+func (r *registry) Validate() (err error) {
+	return
+}
+
+// Feature Encrypt fields of nested documents
+// - As a developer,
+// - I want fields tagged on nested structs and arrays encrypted too,
+// - So that personal data is never stored in plain text.
+func Test_Encrypt_fields_of_nested_documents(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a ward w with phones on primary, backup and guardians", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		w := Bind(&ward{
+			NameV:     "Tom",
+			Primary:   guardian{Name: "Ann", Phone: "555-0001"},
+			Backup:    &guardian{Name: "Bob", Phone: "555-0002"},
+			Guardians: []guardian{{Name: "Cid", Phone: "555-0003"}, {Name: "Dee", Phone: "555-0004"}},
+		}).(*ward)
+
+		when("w.Map() is called", func(it bdd.It) {
+			m, err := w.Map()
+			primary := m["primary"].(M)
+			guardians := m["guardians"].([]interface{})
+			_, primaryBinary := primary["phone"].(bson.Binary)
+			_, backupBinary := m["backup"].(M)["phone"].(bson.Binary)
+			_, firstBinary := guardians[0].(M)["phone"].(bson.Binary)
+			_, lastBinary := guardians[1].(M)["phone"].(bson.Binary)
+
+			it("should encrypt the phones, keeping the names", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.True(primaryBinary)
+				assert.True(backupBinary)
+				assert.True(firstBinary)
+				assert.True(lastBinary)
+				assert.Equal("Ann", primary["name"])
+				assert.Equal("Cid", guardians[0].(M)["name"])
+			})
+
+			i := Bind(&ward{}).(*ward)
+			errInit := i.Init(m)
+			_, stillBinary := primary["phone"].(bson.Binary)
+
+			it("should be decrypted by Init, keeping the M mapped", func(assert bdd.Assert) {
+				assert.NoError(errInit)
+				assert.Equal("555-0001", i.Primary.Phone)
+				assert.Equal("555-0002", i.Backup.Phone)
+				assert.Equal("555-0004", i.Guardians[1].Phone)
+				assert.True(stillBinary)
+			})
+
+			q, errQuery := Q.Eq("guardians.0.phone", "555-0003").MFor(&ward{})
+
+			it("should encrypt values queried on the nested fields", func(assert bdd.Assert) {
+				assert.NoError(errQuery)
+				assert.Equal(guardians[0].(M)["phone"], q["guardians.0.phone"].(M)["$in"].([]interface{})[0])
+			})
+		})
+	})
+
+	given(t, "a registry r with phones inside a map", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		r := Bind(&registry{ByName: map[string]guardian{"ann": {Phone: "555-0001"}}}).(*registry)
+
+		when("r.Map() is called", func(it bdd.It) {
+			_, err := r.Map()
+
+			it("should return ErrEncryptionUnsupported, naming the field", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrEncryptionUnsupported))
+				assert.Contains(err.Error(), "by_name")
+			})
+		})
+	})
+}
+
+// Feature Keep fields encrypted on every write
+// - As a developer,
+// - I want fields tagged to be encrypted on filters, Extended JSON and dumps,
+// - So that personal data never leaves my application in plain text.
+func Test_Keep_fields_encrypted_on_every_write(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a patient p with ssn and notes, and keys a and b", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		p := Bind(&patient{NameV: "Jane", SSNV: "123-45-6789", NotesV: "allergic"}).(*patient)
+		mapped, _ := p.Map()
+
+		when("a Handle h of p maps its filter", func(it bdd.It) {
+			h := NewHandle("patients", p)
+			m, err := h.mapped()
+			_, hasNotes := m["notes"]
+
+			it("should keep ssn encrypted, and omit the random notes", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(mapped["ssn"], m["ssn"])
+				assert.Equal("Jane", m["name"])
+				assert.False(hasNotes)
+			})
+		})
+
+		when("p and a slice with p are written as Extended JSON and read back", func(it bdd.It) {
+			single, errSingle := MarshalExtJSON(p, Canonical)
+			list, errList := MarshalExtJSON([]*patient{p}, Canonical)
+
+			it("should write ssn and notes encrypted", func(assert bdd.Assert) {
+				assert.NoError(errSingle)
+				assert.NoError(errList)
+				assert.False(bytes.Contains(single, []byte("123-45-6789")))
+				assert.False(bytes.Contains(list, []byte("allergic")))
+				assert.True(bytes.Contains(single, []byte("$binary")))
+				assert.True(bytes.Contains(single, []byte("Jane")))
+			})
+
+			var one patient
+			errOne := UnmarshalExtJSON(single, &one)
+
+			var many []*patient
+			errMany := UnmarshalExtJSON(list, &many)
+
+			it("should read ssn and notes decrypted back", func(assert bdd.Assert) {
+				assert.NoError(errOne)
+				assert.NoError(errMany)
+				assert.Equal("123-45-6789", one.SSNV)
+				assert.Equal("allergic", one.NotesV)
+				assert.Len(many, 1)
+				assert.Equal("123-45-6789", many[0].SSNV)
+				assert.Equal("allergic", many[0].NotesV)
+				assert.Equal("Jane", many[0].NameV)
+				_, errBound := many[0].bound()
+				assert.NoError(errBound)
+			})
+		})
+
+		when("p is written by a DumpWriter and read back", func(it bdd.It) {
+			var buf bytes.Buffer
+			errWrite := NewDumpWriter(&buf).Encode(p)
+			written := buf.Bytes()
+
+			var m M
+			errRead := NewDumpReader(bytes.NewReader(written)).Decode(&m)
+			_, isBinary := m["ssn"].(bson.Binary)
+
+			it("should write ssn and notes encrypted", func(assert bdd.Assert) {
+				assert.NoError(errWrite)
+				assert.NoError(errRead)
+				assert.False(bytes.Contains(written, []byte("123-45-6789")))
+				assert.False(bytes.Contains(written, []byte("allergic")))
+				assert.True(isBinary)
+				assert.Equal("Jane", m["name"])
+			})
+
+			var back patient
+			errBack := NewDumpReader(bytes.NewReader(written)).Decode(&back)
+
+			it("should read ssn and notes decrypted into a patient", func(assert bdd.Assert) {
+				assert.NoError(errBack)
+				assert.Equal("123-45-6789", back.SSNV)
+				assert.Equal("allergic", back.NotesV)
+				assert.Equal("Jane", back.NameV)
+			})
+		})
+	})
+}
+
+// Feature Encrypt values of M filters
+// - As a developer,
+// - I want values of M filters compared with encrypted fields encrypted,
+// - So that searches with SearchFor and Repository find documents.
+func Test_Encrypt_values_of_M_filters(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a patient p mapped with key a", func(when bdd.When, args ...interface{}) {
+		SetKeyProvider(patientKeys("a"))
+		defer SetKeyProvider(nil)
+
+		p := Bind(&patient{SSNV: "123-45-6789", AgeV: 30}).(*patient)
+		mapped, _ := p.Map()
+		query, _ := Q.Eq("ssn", "123-45-6789").MFor(&patient{})
+
+		when("a Handle h searches for ssn on a M, and on a Query", func(it bdd.It) {
+			h := NewHandle("patients", &patient{})
+			h.SearchFor(M{"ssn": "123-45-6789", "name": "Jane"})
+			m, err := h.mapped()
+
+			errWhere := h.Where(Q.Eq("ssn", "123-45-6789"))
+			where, errMapped := h.mapped()
+
+			it("should encrypt ssn as the Query does", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(query["ssn"], m["ssn"])
+				assert.Equal(mapped["ssn"], m["ssn"].(M)["$in"].([]interface{})[0])
+				assert.Equal("Jane", m["name"])
+			})
+			it("should keep the values encrypted by Where", func(assert bdd.Assert) {
+				assert.NoError(errWhere)
+				assert.NoError(errMapped)
+				assert.Equal(query["ssn"], where["ssn"])
+			})
+		})
+
+		when("a filter of Repository uses operators and $or", func(it bdd.It) {
+			m, err := filterFor(&patient{}, M{
+				"age": M{"$ne": 30, "$nin": []int{31}},
+				"$or": []M{{"ssn": M{"$in": []string{"123-45-6789"}}}},
+			})
+			nin, _ := m["age"].(M)["$nin"].([]interface{})
+			in, _ := m["$or"].([]M)[0]["ssn"].(M)["$in"].([]interface{})
+
+			it("should encrypt the values of each operator", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Len(nin, 4)
+				assert.Equal(mapped["age"], nin[0])
+				assert.Equal(query["ssn"].(M)["$in"], in)
+			})
+		})
+
+		when("a filter compares notes, or ssn by order", func(it bdd.It) {
+			_, errRandom := filterFor(&patient{}, M{"notes": "allergic"})
+			_, errOrder := filterFor(&patient{}, M{"ssn": M{"$gt": "1"}})
+
+			it("should return ErrEncryptedField", func(assert bdd.Assert) {
+				assert.True(errors.Is(errRandom, ErrEncryptedField))
+				assert.True(errors.Is(errOrder, ErrEncryptedField))
+			})
+		})
+	})
+}
@@ -0,0 +1,164 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/globalsign/mgo"
+)
+
+var (
+	// ErrNotFound it's matched by errors.Is on errors received when no
+	// document were found by an operation.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateKey it's matched by errors.Is on errors received when
+	// an operation violates an unique index.
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrTimeout it's matched by errors.Is on errors received when an
+	// operation exceeded its time limit, or timed out on network.
+	// Servers not reachable at all aren't timeouts.
+	ErrTimeout = errors.New("timeout")
+	// ErrValidation it's matched by errors.Is on errors received when a
+	// document fails the rules on its validate tags.
+	ErrValidation = errors.New("validation failed")
+
+	// dupKeyPattern extracts index and key from duplicate key messages.
+	dupKeyPattern = regexp.MustCompile(`index:\s+(\S+)\s+dup key:\s+(\{.*\})`)
+)
+
+// NotFoundError it's an error received when no document were found on
+// Collection by an operation. It wraps the mgo error.
+type NotFoundError struct {
+	Collection string
+	Err        error
+}
+
+// Error returns a message describing the error.
+func (e *NotFoundError) Error() (s string) {
+	s = fmt.Sprintf("document not found on %s", e.Collection)
+	return
+}
+
+// Is reports if target it's ErrNotFound.
+func (e *NotFoundError) Is(target error) (r bool) {
+	r = target == ErrNotFound
+	return
+}
+
+// Unwrap returns the error received from mgo.
+func (e *NotFoundError) Unwrap() (err error) {
+	err = e.Err
+	return
+}
+
+// DuplicateKeyError it's an error received when an operation on
+// Collection violates the unique Index, repeating Key. It wraps the mgo
+// error.
+type DuplicateKeyError struct {
+	Collection string
+	Index      string
+	Key        string
+	Err        error
+}
+
+// Error returns a message describing the error.
+func (e *DuplicateKeyError) Error() (s string) {
+	s = fmt.Sprintf("duplicate key %s on index %s of %s", e.Key, e.Index, e.Collection)
+	return
+}
+
+// Is reports if target it's ErrDuplicateKey.
+func (e *DuplicateKeyError) Is(target error) (r bool) {
+	r = target == ErrDuplicateKey
+	return
+}
+
+// Unwrap returns the error received from mgo.
+func (e *DuplicateKeyError) Unwrap() (err error) {
+	err = e.Err
+	return
+}
+
+// TimeoutError it's an error received when an operation on Collection
+// couldn't reach MongoDB in time. It wraps the mgo error.
+type TimeoutError struct {
+	Collection string
+	Err        error
+}
+
+// Error returns a message describing the error.
+func (e *TimeoutError) Error() (s string) {
+	s = fmt.Sprintf("timeout on %s: %v", e.Collection, e.Err)
+	return
+}
+
+// Is reports if target it's ErrTimeout.
+func (e *TimeoutError) Is(target error) (r bool) {
+	r = target == ErrTimeout
+	return
+}
+
+// Unwrap returns the error received from mgo.
+func (e *TimeoutError) Unwrap() (err error) {
+	err = e.Err
+	return
+}
+
+// Is reports if target it's ErrValidation.
+func (e *ValidationError) Is(target error) (r bool) {
+	r = target == ErrValidation
+	return
+}
+
+// wrapErr translates err received from mgo on an operation on
+// collection to the error types of package. Other errors are returned
+// untouched.
+func wrapErr(collection string, err error) (out error) {
+	switch {
+	case err == nil:
+	case err == mgo.ErrNotFound:
+		out = &NotFoundError{
+			Collection: collection,
+			Err:        err,
+		}
+	case mgo.IsDup(err):
+		dup := &DuplicateKeyError{
+			Collection: collection,
+			Err:        err,
+		}
+
+		if m := dupKeyPattern.FindStringSubmatch(err.Error()); m != nil {
+			// Old servers name indexes as <db>.<collection>.$<index>.
+			dup.Index = m[1][strings.LastIndex(m[1], "$")+1:]
+			dup.Key = m[2]
+		}
+
+		out = dup
+	case isTimeout(err):
+		out = &TimeoutError{
+			Collection: collection,
+			Err:        err,
+		}
+	default:
+		out = err
+	}
+	return
+}
+
+// isTimeout checks if err was caused by an operation taking too long.
+func isTimeout(err error) (r bool) {
+	var netErr net.Error
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		r = e.Code == 50
+	case *mgo.LastError:
+		r = e.Code == 50
+	default:
+		r = errors.As(err, &netErr) && netErr.Timeout() ||
+			strings.HasSuffix(err.Error(), "i/o timeout")
+	}
+	return
+}
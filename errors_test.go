@@ -0,0 +1,132 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// netTimeout it's a net.Error timing out.
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "read tcp: i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+// Feature Tell errors apart with errors.Is and errors.As
+// - As a developer,
+// - I want Handle errors to have types,
+// - So that I don't need to match strings to tell them apart.
+func Test_Tell_errors_apart_with_errors_Is_and_As(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a mgo error '%[1]v'", func(when bdd.When, args ...interface{}) {
+		cause := args[0].(error)
+
+		when("it's wrapped by wrapErr() on products collection", func(it bdd.It) {
+			err := wrapErr("products", cause)
+
+			it("should match %[2]v with errors.Is", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, args[1].(error)))
+			})
+			it("should match the cause with errors.Is", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, cause))
+			})
+			it("should have message '%[3]v'", func(assert bdd.Assert) {
+				assert.EqualError(err, args[2].(string))
+			})
+		})
+	}, like(
+		s(mgo.ErrNotFound, ErrNotFound, "document not found on products"),
+		s(&mgo.LastError{
+			Code: 11000,
+			Err:  `E11000 duplicate key error collection: testing.products index: name_1 dup key: { name: "bread" }`,
+		}, ErrDuplicateKey, `duplicate key { name: "bread" } on index name_1 of products`),
+		s(&mgo.QueryError{
+			Code:    11000,
+			Message: `E11000 duplicate key error index: testing.products.$_id_  dup key: { : "id" }`,
+		}, ErrDuplicateKey, `duplicate key { : "id" } on index _id_ of products`),
+		s(&mgo.QueryError{
+			Code:    50,
+			Message: "operation exceeded time limit",
+		}, ErrTimeout, "timeout on products: operation exceeded time limit"),
+		s(netTimeout{}, ErrTimeout, "timeout on products: read tcp: i/o timeout"),
+	))
+
+	given(t, "a DuplicateKeyError received from wrapErr()", func(when bdd.When, args ...interface{}) {
+		err := wrapErr("products", &mgo.LastError{
+			Code: 11000,
+			Err:  `E11000 duplicate key error collection: testing.products index: name_1 dup key: { name: "bread" }`,
+		})
+
+		when("errors.As(err, &dup) is called", func(it bdd.It) {
+			var dup *DuplicateKeyError
+			ok := errors.As(err, &dup)
+
+			it("should return true", func(assert bdd.Assert) {
+				assert.True(ok)
+			})
+			it("dup should have index and key violated", func(assert bdd.Assert) {
+				assert.Equal("name_1", dup.Index)
+				assert.Equal(`{ name: "bread" }`, dup.Key)
+			})
+		})
+	})
+
+	given(t, "an unknown error, a no reachable servers error and a ValidationError", func(when bdd.When, args ...interface{}) {
+		unknown := errors.New("unknown")
+		unreachable := errors.New("no reachable servers")
+		verr := &ValidationError{
+			Fields: []FieldError{{Field: "name", Rule: "required"}},
+		}
+
+		when("wrapErr() receives them", func(it bdd.It) {
+			it("should return them untouched", func(assert bdd.Assert) {
+				assert.Equal(unknown, wrapErr("products", unknown))
+				assert.Equal(unreachable, wrapErr("products", unreachable))
+				assert.Equal(verr, wrapErr("products", verr))
+			})
+			it("the ValidationError should match ErrValidation", func(assert bdd.Assert) {
+				assert.True(errors.Is(verr, ErrValidation))
+			})
+		})
+	})
+}
+
+// Feature Receive typed errors from Handle
+// - As a developer,
+// - I want Handle operations to return typed errors,
+// - So that I can react differently to each problem.
+func Test_Receive_typed_errors_from_Handle(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a linked ProductHandle p and products collection with documents "+colFixtures, func(when bdd.When, args ...interface{}) {
+		p := newProductHandle()
+
+		when("p.Insert() is called with a product with id1", func(it bdd.It) {
+			err := p.SetDocument(newProductWithID(id1)).Insert()
+
+			var dup *DuplicateKeyError
+			ok := errors.As(err, &dup)
+
+			it("should return a DuplicateKeyError on index _id_", func(assert bdd.Assert) {
+				assert.True(ok)
+				assert.Equal("_id_", dup.Index)
+			})
+		})
+
+		when("p.Find() is called with a product with a new id", func(it bdd.It) {
+			_, err := p.SetDocument(newProductWithID(NewID().Hex())).Find()
+
+			it("should return an error matching ErrNotFound", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrNotFound))
+				assert.True(errors.Is(err, mgo.ErrNotFound))
+			})
+		})
+	})
+}
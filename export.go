@@ -0,0 +1,250 @@
+package mongo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ExportFormat it's the file format of documents exported and imported
+// by Handle.
+type ExportFormat int
+
+const (
+	// BSONDump writes documents as BSON prefixed by their length, like
+	// the .bson files of mongodump.
+	BSONDump ExportFormat = iota + 1
+	// JSONLines writes each document as Extended JSON on its own line.
+	JSONLines
+	// CSV writes the fields of documents as comma-separated values,
+	// with a header naming them. Strings are written as they are, and
+	// other values as relaxed Extended JSON, so they're read back with
+	// their types.
+	CSV
+)
+
+// defaultBatchSize it's the number of documents on each batch of
+// exports and imports without one.
+const defaultBatchSize = 1000
+
+var (
+	// ErrUnknownFormat it's an error received exporting or importing
+	// with a format other than BSONDump, JSONLines and CSV.
+	ErrUnknownFormat = errors.New("unknown export format")
+	// ErrNoFields it's an error received exporting to CSV without the
+	// fields to be written.
+	ErrNoFields = errors.New("CSV format needs the fields exported")
+)
+
+// ExportOptions enumerates the options of documents exported by Handle.
+type ExportOptions struct {
+	// Format it's the format of documents written.
+	Format ExportFormat
+	// Fields are the fields exported, in order, with nested fields
+	// separated by dots. Every field it's exported if empty, except on
+	// CSV, that needs them.
+	Fields []string
+	// Mode it's the mode of Extended JSON written by JSONLines.
+	Mode ExtJSONMode
+	// BatchSize it's the number of documents read on each batch, and
+	// between calls of Progress. It's 1000 if zero.
+	BatchSize int
+	// Progress it's called with the number of documents exported,
+	// after each batch and on the end.
+	Progress func(n int)
+}
+
+// Export writes the documents on collection connected to Handle,
+// matching the document data, to w on the format of opts. It returns
+// the number of documents exported.
+func (h *Handle) Export(w io.Writer, opts ExportOptions) (n int, err error) {
+	var out documentWriter
+	if out, err = newDocumentWriter(w, opts); err != nil {
+		return
+	}
+
+	var mapped M
+	if mapped, err = h.mapped(); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		batch := batchSize(opts.BatchSize)
+		qry := c.Find(mapped).Batch(batch)
+		if len(opts.Fields) > 0 {
+			qry = qry.Select(projection(opts.Fields))
+		}
+
+		iter := qry.Iter()
+		var raw bson.Raw
+		for err == nil && iter.Next(&raw) {
+			if err = out.write(raw.Data); err == nil {
+				if n++; n%batch == 0 {
+					report(opts.Progress, n)
+				}
+			}
+		}
+
+		if errIter := iter.Close(); err == nil {
+			err = wrapErr(h.collectionName, errIter)
+		}
+		if errFlush := out.flush(); err == nil {
+			err = errFlush
+		}
+		if err == nil && n%batch != 0 {
+			report(opts.Progress, n)
+		}
+	}
+	return
+}
+
+// documentWriter writes documents on a format.
+type documentWriter interface {
+	write(d RawDocument) error
+	flush() error
+}
+
+// newDocumentWriter returns the documentWriter of format on opts,
+// writing on w.
+func newDocumentWriter(w io.Writer, opts ExportOptions) (dw documentWriter, err error) {
+	buf := bufio.NewWriter(w)
+
+	switch opts.Format {
+	case BSONDump:
+		dw = &dumpDocumentWriter{buf: buf, w: NewDumpWriter(buf)}
+	case JSONLines:
+		dw = &jsonDocumentWriter{buf: buf, mode: opts.Mode}
+	case CSV:
+		if len(opts.Fields) == 0 {
+			err = ErrNoFields
+			return
+		}
+		cw := &csvDocumentWriter{w: csv.NewWriter(buf), buf: buf, fields: opts.Fields}
+		err = cw.w.Write(opts.Fields)
+		dw = cw
+	default:
+		err = ErrUnknownFormat
+	}
+	return
+}
+
+// dumpDocumentWriter writes documents as BSONDump.
+type dumpDocumentWriter struct {
+	buf *bufio.Writer
+	w   *DumpWriter
+}
+
+// write writes d on dump.
+func (dw *dumpDocumentWriter) write(d RawDocument) (err error) {
+	err = dw.w.WriteRaw(d)
+	return
+}
+
+// flush writes the documents buffered.
+func (dw *dumpDocumentWriter) flush() (err error) {
+	err = dw.buf.Flush()
+	return
+}
+
+// jsonDocumentWriter writes documents as JSONLines.
+type jsonDocumentWriter struct {
+	buf  *bufio.Writer
+	mode ExtJSONMode
+}
+
+// write writes d as Extended JSON, on its own line.
+func (dw *jsonDocumentWriter) write(d RawDocument) (err error) {
+	var line []byte
+	if line, err = d.ExtJSON(dw.mode); err == nil {
+		_, _ = dw.buf.Write(line)
+		err = dw.buf.WriteByte('\n')
+	}
+	return
+}
+
+// flush writes the documents buffered.
+func (dw *jsonDocumentWriter) flush() (err error) {
+	err = dw.buf.Flush()
+	return
+}
+
+// csvDocumentWriter writes fields of documents as CSV.
+type csvDocumentWriter struct {
+	w      *csv.Writer
+	buf    *bufio.Writer
+	fields []string
+}
+
+// write writes the fields of d as a CSV record, with empty cells for
+// the ones missing.
+func (dw *csvDocumentWriter) write(d RawDocument) (err error) {
+	record := make([]string, len(dw.fields))
+	for i := 0; i < len(record) && err == nil; i++ {
+		if v, found := d.Lookup(dw.fields[i]); found {
+			record[i], err = csvCell(v)
+		}
+	}
+
+	if err == nil {
+		err = dw.w.Write(record)
+	}
+	return
+}
+
+// flush writes the records buffered.
+func (dw *csvDocumentWriter) flush() (err error) {
+	if dw.w.Flush(); dw.w.Error() != nil {
+		err = dw.w.Error()
+	} else {
+		err = dw.buf.Flush()
+	}
+	return
+}
+
+// csvCell returns v as a CSV cell. Strings are returned as they are,
+// unless they could be read as JSON, or empty, being written as JSON
+// strings instead. Other values are returned as relaxed Extended JSON.
+func csvCell(v RawValue) (cell string, err error) {
+	if s, ok := v.StringValue(); ok && s != "" && !json.Valid([]byte(s)) {
+		cell = s
+		return
+	}
+
+	var out []byte
+	if out, err = v.ExtJSON(Relaxed); err == nil {
+		cell = string(out)
+	}
+	return
+}
+
+// projection returns the projection selecting fields.
+func projection(fields []string) (p M) {
+	p = make(M, len(fields))
+	for _, f := range fields {
+		p[f] = 1
+	}
+	return
+}
+
+// batchSize returns n, or defaultBatchSize if it isn't positive.
+func batchSize(n int) (size int) {
+	if size = n; size <= 0 {
+		size = defaultBatchSize
+	}
+	return
+}
+
+// report calls progress with n, if defined.
+func report(progress func(int), n int) {
+	if progress != nil {
+		progress(n)
+	}
+}
@@ -0,0 +1,215 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo/bson"
+)
+
+// exportedDocuments returns documents with values of many types, to be
+// exported and imported.
+func exportedDocuments() (docs []RawDocument) {
+	for _, d := range []bson.D{
+		{
+			{Name: "_id", Value: ObjectIdHex(id1)},
+			{Name: "name", Value: "soap, bar"},
+			{Name: "code", Value: "12"},
+			{Name: "price", Value: decimal("1.50")},
+			{Name: "on", Value: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{Name: "stock", Value: bson.D{{Name: "qty", Value: 3}}},
+		},
+		{
+			{Name: "_id", Value: ObjectIdHex(id2)},
+			{Name: "name", Value: "towel"},
+			{Name: "stock", Value: bson.D{{Name: "qty", Value: int64(1) << 40}}},
+		},
+	} {
+		raw, _ := documenterEncoder.Marshal(d)
+		docs = append(docs, raw)
+	}
+	return
+}
+
+// transfer writes docs on format with fields, and reads them back.
+func transfer(docs []RawDocument, format ExportFormat, fields ...string) (out []M, text string, err error) {
+	var buf bytes.Buffer
+
+	var w documentWriter
+	if w, err = newDocumentWriter(&buf, ExportOptions{Format: format, Fields: fields}); err != nil {
+		return
+	}
+	for i := 0; i < len(docs) && err == nil; i++ {
+		err = w.write(docs[i])
+	}
+	if err == nil {
+		err = w.flush()
+	}
+	text = buf.String()
+
+	var r documentReader
+	if r, err = newDocumentReader(&buf, format); err != nil {
+		return
+	}
+
+	var d RawDocument
+	for err == nil {
+		if d, err = r.read(); err == nil {
+			var m M
+			m, err = UnmarshalToM(d)
+			out = append(out, m)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// Feature Write and read documents of exports
+// - As a developer,
+// - I want documents written and read on dump, JSON lines and CSV files,
+// - So that I can export and import collections keeping their values.
+func Test_Write_and_read_documents_of_exports(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "documents written and read on format %[1]v", func(when bdd.When, args ...interface{}) {
+		docs := exportedDocuments()
+
+		when("every field is transferred", func(it bdd.It) {
+			out, _, err := transfer(docs, args[0].(ExportFormat))
+
+			it("should read the same documents", func(assert bdd.Assert) {
+				assert.NoError(err)
+				if assert.Len(out, 2) {
+					for i := range docs {
+						expected, _ := UnmarshalToM(docs[i])
+						assert.Equal(expected, out[i])
+					}
+				}
+			})
+		})
+	}, like(
+		s(BSONDump), s(JSONLines),
+	))
+
+	given(t, "documents written and read as CSV with some fields", func(when bdd.When, args ...interface{}) {
+		docs := exportedDocuments()
+
+		when("the fields are transferred", func(it bdd.It) {
+			out, text, err := transfer(docs, CSV, "_id", "name", "code", "price", "stock.qty")
+
+			it("should write strings as they are and the other values as JSON", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(`_id,name,code,price,stock.qty`+"\n"+
+					`"{""$oid"":""`+id1+`""}","soap, bar","""12""","{""$numberDecimal"":""1.50""}",3`+"\n"+
+					`"{""$oid"":""`+id2+`""}",towel,,,1099511627776`+"\n", text)
+			})
+			it("should read the fields with their types", func(assert bdd.Assert) {
+				if assert.Len(out, 2) {
+					assert.Equal(M{
+						"_id":   ObjectIdHex(id1),
+						"name":  "soap, bar",
+						"code":  "12",
+						"price": decimal("1.50"),
+						"stock": M{"qty": 3},
+					}, out[0])
+					assert.Equal(M{
+						"_id":   ObjectIdHex(id2),
+						"name":  "towel",
+						"stock": M{"qty": int64(1) << 40},
+					}, out[1])
+				}
+			})
+		})
+
+		when("no fields are given", func(it bdd.It) {
+			_, _, err := transfer(docs, CSV)
+
+			it("should return ErrNoFields", func(assert bdd.Assert) {
+				assert.Equal(ErrNoFields, err)
+			})
+		})
+	})
+
+	given(t, "a JSON lines file with an invalid line", func(when bdd.When, args ...interface{}) {
+		in := strings.NewReader("{\"name\": \"soap\"}\n\n{\"name\": }\n")
+
+		when("its documents are read", func(it bdd.It) {
+			r, _ := newDocumentReader(in, JSONLines)
+			_, errFirst := r.read()
+			_, errSecond := r.read()
+
+			it("should return an error with the line of document", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.Error(errSecond)
+				assert.Contains(errSecond.Error(), "line 3")
+			})
+		})
+	})
+}
+
+// Feature Export and import collections with Handle
+// - As a developer,
+// - I want to export a collection to a file and import it back,
+// - So that I can move documents between databases.
+func Test_Export_and_import_collections_with_Handle(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a linked ProductHandle p with products collection with documents "+colFixtures, func(when bdd.When, args ...interface{}) {
+		p := newProductHandle()
+
+		when("p.Export() is called on JSON lines, and imported on copies twice", func(it bdd.It) {
+			var buf bytes.Buffer
+			var progress []int
+			n, errExport := p.Safely().Export(&buf, ExportOptions{
+				Format:    JSONLines,
+				BatchSize: 2,
+				Progress:  func(n int) { progress = append(progress, n) },
+			})
+			file := buf.String()
+
+			copies := NewHandle("copies", newProduct())
+			copies.Safely()
+			nFirst, errFirst := copies.Import(strings.NewReader(file), ImportOptions{Format: JSONLines})
+			nSecond, errSecond := copies.Import(strings.NewReader(file), ImportOptions{Format: JSONLines})
+			nUpsert, errUpsert := copies.Import(strings.NewReader(file), ImportOptions{Format: JSONLines, Upsert: true})
+			count, _ := copies.Count()
+
+			it("should export every document, reporting progress", func(assert bdd.Assert) {
+				assert.NoError(errExport)
+				assert.Equal(3, n)
+				assert.Equal([]int{2, 3}, progress)
+			})
+			it("should import every document the first time", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.Equal(3, nFirst)
+			})
+			it("should fail with ErrDuplicateKey the second time", func(assert bdd.Assert) {
+				assert.True(errors.Is(errSecond, ErrDuplicateKey))
+				assert.Equal(0, nSecond)
+			})
+			it("should replace the documents on upsert", func(assert bdd.Assert) {
+				assert.NoError(errUpsert)
+				assert.Equal(3, nUpsert)
+				assert.Equal(3, count)
+			})
+		})
+
+		when("p.Export() is called with an unknown format", func(it bdd.It) {
+			_, err := p.Safely().Export(&bytes.Buffer{}, ExportOptions{})
+
+			it("should return ErrUnknownFormat", func(assert bdd.Assert) {
+				assert.Equal(ErrUnknownFormat, err)
+			})
+		})
+	})
+}
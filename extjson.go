@@ -0,0 +1,136 @@
+package mongo
+
+import (
+	"reflect"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// ExtJSONMode it's the mode of MongoDB Extended JSON v2, Relaxed or
+// Canonical.
+type ExtJSONMode = bsonutils.ExtJSONMode
+
+const (
+	// Relaxed writes numbers as JSON numbers and dates as ISO-8601
+	// strings, when it doesn't lose information. It's the one meant
+	// for API responses.
+	Relaxed = bsonutils.Relaxed
+	// Canonical writes every number and date with its BSON type,
+	// preserving them exactly. It's the one meant for fixtures.
+	Canonical = bsonutils.Canonical
+)
+
+var (
+	// ErrInvalidExtJSON it's an error received when unmarshaling JSON
+	// that isn't valid MongoDB Extended JSON.
+	ErrInvalidExtJSON = bsonutils.ErrInvalidExtJSON
+
+	// documenterType it's the type of Documenter, whose values are
+	// mapped before written.
+	documenterType = reflect.TypeOf((*Documenter)(nil)).Elem()
+)
+
+// MarshalExtJSON returns in as MongoDB Extended JSON v2, on mode,
+// keeping ObjectId, dates, Decimal128 and binary values. The in value
+// can be a M, a Documenter, or a slice of them, written as a JSON
+// array. Documenters are mapped as done by MapDocumenter, omitting
+// empty fields and encrypting the ones tagged with mongo:"encrypt".
+func MarshalExtJSON(in interface{}, mode ExtJSONMode) (out []byte, err error) {
+	if in, err = mappedDocuments(in); err == nil {
+		out, err = documenterEncoder.MarshalExtJSON(in, mode)
+	}
+	return
+}
+
+// mappedDocuments returns in with each Documenter, alone or on a
+// slice, replaced by its document mapped as done by MapDocumenter.
+func mappedDocuments(in interface{}) (out interface{}, err error) {
+	if d, ok := in.(Documenter); ok {
+		out, err = documenterRaw(encoderOf(d), d)
+		return
+	}
+
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Slice || !mayHoldDocumenter(v.Type().Elem()) {
+		out = in
+		return
+	}
+
+	list := make([]interface{}, v.Len())
+	for i := 0; i < len(list) && err == nil; i++ {
+		list[i], err = mappedDocuments(v.Index(i).Interface())
+	}
+	out = list
+	return
+}
+
+// UnmarshalExtJSON reads MongoDB Extended JSON, canonical or relaxed,
+// into out, a pointer to M, to a Documenter, or to a slice of them if
+// in it's a JSON array. Documenters are read as done by
+// InitDocumenterWith, with the keys of their Encoder, decrypting the
+// fields tagged with mongo:"encrypt".
+func UnmarshalExtJSON(in []byte, out interface{}) (err error) {
+	if d, ok := out.(Documenter); ok {
+		var m M
+		if err = bsonutils.UnmarshalExtJSON(in, &m); err == nil {
+			err = initDocumenter(decoderOf(d), m, d)
+		}
+		return
+	}
+
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice || !newsDocumenter(v.Elem().Type().Elem()) {
+		err = bsonutils.UnmarshalExtJSON(in, out)
+		return
+	}
+
+	var list []M
+	if err = bsonutils.UnmarshalExtJSON(in, &list); err != nil {
+		return
+	}
+
+	docs := reflect.MakeSlice(v.Elem().Type(), len(list), len(list))
+	for i := 0; i < len(list) && err == nil; i++ {
+		elem := docs.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		} else {
+			elem = elem.Addr()
+		}
+
+		d := elem.Interface().(Documenter)
+		err = initDocumenter(decoderOf(d), list[i], d)
+	}
+
+	if err == nil {
+		v.Elem().Set(docs)
+	}
+	return
+}
+
+// initDocumenter fills d with in, as done by InitDocumenterWith with
+// dec, binding it to its Document.
+func initDocumenter(dec Decoder, in M, d Documenter) (err error) {
+	if err = InitDocumenterWith(dec, in, &d); err == nil {
+		Bind(d)
+	}
+	return
+}
+
+// newsDocumenter reports if elements of slices of type t can be
+// created as Documenters, being pointers to them, or structs whose
+// pointers are.
+func newsDocumenter(t reflect.Type) (r bool) {
+	if t.Kind() == reflect.Ptr {
+		r = t.Elem().Kind() == reflect.Struct && t.Implements(documenterType)
+	} else {
+		r = t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(documenterType)
+	}
+	return
+}
+
+// mayHoldDocumenter reports if values of type t can be Documenters.
+func mayHoldDocumenter(t reflect.Type) (r bool) {
+	r = t.Kind() == reflect.Interface || t.Implements(documenterType)
+	return
+}
@@ -0,0 +1,176 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Feature Write documents as Extended JSON
+// - As a developer,
+// - I want documents written as MongoDB Extended JSON,
+// - So that API responses keep ObjectId, dates and decimals.
+func Test_Write_documents_as_Extended_JSON(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a document d with values of many BSON types", func(when bdd.When, args ...interface{}) {
+		d := bson.D{
+			{Name: "_id", Value: ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b")},
+			{Name: "n", Value: 1},
+			{Name: "big", Value: int64(1) << 40},
+			{Name: "f", Value: 1.5},
+			{Name: "whole", Value: 2.0},
+			{Name: "on", Value: time.Date(2018, 1, 2, 3, 4, 5, 6e6, time.UTC)},
+			{Name: "price", Value: decimal("19.90")},
+			{Name: "data", Value: []byte{1, 2, 3}},
+			{Name: "tags", Value: []string{"a", "b"}},
+			{Name: "nested", Value: bson.D{{Name: "ok", Value: true}, {Name: "none", Value: nil}}},
+		}
+
+		when("MarshalExtJSON(d, Canonical) is called", func(it bdd.It) {
+			out, err := MarshalExtJSON(d, Canonical)
+
+			it("should write every value with its type", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(`{"_id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"},"n":{"$numberInt":"1"},`+
+					`"big":{"$numberLong":"1099511627776"},"f":{"$numberDouble":"1.5"},`+
+					`"whole":{"$numberDouble":"2.0"},"on":{"$date":{"$numberLong":"1514862245006"}},`+
+					`"price":{"$numberDecimal":"19.90"},"data":{"$binary":{"base64":"AQID","subType":"00"}},`+
+					`"tags":["a","b"],"nested":{"ok":true,"none":null}}`, string(out))
+			})
+		})
+
+		when("MarshalExtJSON(d, Relaxed) is called", func(it bdd.It) {
+			out, err := MarshalExtJSON(d, Relaxed)
+
+			it("should write numbers and dates as plain JSON", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(`{"_id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"},"n":1,"big":1099511627776,`+
+					`"f":1.5,"whole":2.0,"on":{"$date":"2018-01-02T03:04:05.006Z"},`+
+					`"price":{"$numberDecimal":"19.90"},"data":{"$binary":{"base64":"AQID","subType":"00"}},`+
+					`"tags":["a","b"],"nested":{"ok":true,"none":null}}`, string(out))
+			})
+		})
+	})
+
+	given(t, "a slice of invoices", func(when bdd.When, args ...interface{}) {
+		invoices := []*invoice{{Total: decimal("10.50")}, {Total: decimal("3")}}
+		invoices[0].IDV = ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b")
+
+		when("MarshalExtJSON(invoices, Relaxed) is called", func(it bdd.It) {
+			out, err := MarshalExtJSON(invoices, Relaxed)
+
+			it("should write an array, omitting empty fields", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(`[{"_id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"},"total":{"$numberDecimal":"10.50"}},`+
+					`{"total":{"$numberDecimal":"3"}}]`, string(out))
+			})
+		})
+	})
+}
+
+// Feature Read documents from Extended JSON
+// - As a developer,
+// - I want MongoDB Extended JSON read into documents,
+// - So that I could load fixtures and requests without losing types.
+func Test_Read_documents_from_Extended_JSON(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "the canonical Extended JSON %[1]v", func(when bdd.When, args ...interface{}) {
+		in := args[0].(string)
+
+		when("read into a bson.D and written again", func(it bdd.It) {
+			var d bson.D
+			errRead := UnmarshalExtJSON([]byte(in), &d)
+			out, errWrite := MarshalExtJSON(d, Canonical)
+
+			it("should be the same", func(assert bdd.Assert) {
+				assert.NoError(errRead)
+				assert.NoError(errWrite)
+				assert.Equal(in, string(out))
+			})
+		})
+	}, like(
+		s(`{"a":{"$date":{"$numberLong":"-1000"}}}`),
+		s(`{"a":{"$timestamp":{"t":123,"i":4}}}`),
+		s(`{"a":{"$regularExpression":{"pattern":"^a","options":"i"}}}`),
+		s(`{"a":{"$binary":{"base64":"AAECAwQFBgcICQoLDA0ODw==","subType":"04"}}}`),
+		s(`{"a":{"$numberDouble":"-Infinity"},"b":{"$numberDouble":"NaN"}}`),
+		s(`{"a":{"$minKey":1},"b":{"$maxKey":1},"c":{"$undefined":true}}`),
+		s(`{"a":{"$code":"f()"},"b":{"$symbol":"s"}}`),
+		s(`{"a":{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"}}}}`),
+		s(`{"a":{"$numberDecimal":"-1.5E+10"},"b":[{"$numberLong":"9"},{"$numberInt":"-1"}]}`),
+		s(`{"$ref":"c","$id":{"$numberInt":"1"}}`),
+	))
+
+	given(t, "relaxed and legacy forms of Extended JSON", func(when bdd.When, args ...interface{}) {
+		in := `{"_id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"},"n":1,"big":1099511627776,"f":2.0,` +
+			`"on":{"$date":"2018-01-02T03:04:05.006Z"},"uuid":{"$uuid":"00112233-4455-6677-8899-aabbccddeeff"},` +
+			`"old":{"$binary":"AQID","$type":"00"},"re":{"$regex":"^a","$options":"i"}}`
+
+		when("read into a M", func(it bdd.It) {
+			var m M
+			err := UnmarshalExtJSON([]byte(in), &m)
+
+			it("should have the values of BSON types", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b"), m["_id"])
+				assert.Equal(1, m["n"])
+				assert.Equal(int64(1099511627776), m["big"])
+				assert.Equal(2.0, m["f"])
+				assert.True(time.Date(2018, 1, 2, 3, 4, 5, 6e6, time.UTC).Equal(m["on"].(time.Time)))
+				assert.Equal(bson.Binary{Kind: 4, Data: []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77,
+					0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}}, m["uuid"])
+				assert.Equal([]byte{1, 2, 3}, m["old"])
+				assert.Equal(bson.RegEx{Pattern: "^a", Options: "i"}, m["re"])
+			})
+		})
+	})
+
+	given(t, "a fixture with an array of invoices", func(when bdd.When, args ...interface{}) {
+		in := `[{"_id":{"$oid":"5a1c2f0e9d1b2c3d4e5f6a7b"},"created_on":{"$numberLong":"10"},"total":{"$numberDecimal":"10.50"}},` +
+			`{"total":"3"}]`
+
+		when("read into a []*invoice", func(it bdd.It) {
+			var invoices []*invoice
+			err := UnmarshalExtJSON([]byte(in), &invoices)
+
+			it("should read each invoice", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Len(invoices, 2)
+				assert.Equal(ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b"), invoices[0].ID())
+				assert.Equal(int64(10), invoices[0].CreatedOn())
+				assert.Equal("10.50", invoices[0].Total.String())
+				assert.Equal("3", invoices[1].Total.String())
+			})
+		})
+
+		when("read into a M", func(it bdd.It) {
+			var m M
+			err := UnmarshalExtJSON([]byte(in), &m)
+
+			it("should return an error", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+	})
+
+	given(t, "the invalid Extended JSON %[1]v", func(when bdd.When, args ...interface{}) {
+		when("read into a M", func(it bdd.It) {
+			var m M
+			err := UnmarshalExtJSON([]byte(args[0].(string)), &m)
+
+			it("should return ErrInvalidExtJSON", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrInvalidExtJSON))
+			})
+		})
+	}, like(
+		s(`{"a":{"$oid":"xyz"}}`), s(`{"a":{"$numberInt":"1.5"}}`), s(`{"a":{"$date":true}}`),
+		s(`{"a":{"$binary":{"base64":"AQID"}}}`), s(`{"a":1} {}`), s(`{"a":`),
+	))
+}
@@ -0,0 +1,351 @@
+package mongo
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+var (
+	// ErrInvalidGeoJSON it's an error received when a Point or Polygon
+	// don't have the shape required by GeoJSON.
+	ErrInvalidGeoJSON = errors.New("invalid GeoJSON")
+	// ErrNoGeoIndex it's an error received on geospatial queries over a
+	// collection without a 2dsphere index declared.
+	ErrNoGeoIndex = errors.New("no 2dsphere index declared")
+)
+
+// distanceKey it's the key receiving the distance of documents found
+// by Near.
+const distanceKey = "_distance"
+
+// geoJSON it's the BSON shape of GeoJSON objects.
+type geoJSON struct {
+	Type        string      `bson:"type"`
+	Coordinates interface{} `bson:"coordinates"`
+}
+
+// Point it's a GeoJSON point, with longitude and latitude in degrees.
+// It's stored as {type: "Point", coordinates: [lng, lat]}.
+type Point struct {
+	Lng float64
+	Lat float64
+}
+
+// NewPoint returns the Point on longitude lng and latitude lat.
+func NewPoint(lng, lat float64) (p Point) {
+	p = Point{Lng: lng, Lat: lat}
+	return
+}
+
+// GetBSON implements bson.Getter, returning Point as GeoJSON.
+func (p Point) GetBSON() (v interface{}, err error) {
+	v = geoJSON{
+		Type:        "Point",
+		Coordinates: []float64{p.Lng, p.Lat},
+	}
+	return
+}
+
+// SetBSON implements bson.Setter, reading Point from GeoJSON.
+func (p *Point) SetBSON(raw bson.Raw) (err error) {
+	var g struct {
+		Type        string    `bson:"type"`
+		Coordinates []float64 `bson:"coordinates"`
+	}
+
+	if err = raw.Unmarshal(&g); err == nil {
+		if g.Type != "Point" || len(g.Coordinates) != 2 {
+			err = ErrInvalidGeoJSON
+		} else {
+			p.Lng, p.Lat = g.Coordinates[0], g.Coordinates[1]
+		}
+	}
+	return
+}
+
+// Polygon it's a GeoJSON polygon. The first ring it's the exterior
+// one, and the others are holes inside it. Each ring must be closed,
+// with at least four points, the last equal to the first.
+type Polygon struct {
+	Rings [][]Point
+}
+
+// NewPolygon returns a Polygon with a single ring over points, closing
+// it if the last point isn't equal to the first.
+func NewPolygon(points ...Point) (p Polygon) {
+	ring := append([]Point{}, points...)
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+
+	p = Polygon{Rings: [][]Point{ring}}
+	return
+}
+
+// GetBSON implements bson.Getter, returning Polygon as GeoJSON. It
+// returns ErrInvalidGeoJSON if a ring isn't closed or is too short.
+func (p Polygon) GetBSON() (v interface{}, err error) {
+	if len(p.Rings) == 0 {
+		err = ErrInvalidGeoJSON
+		return
+	}
+
+	coordinates := make([][][]float64, len(p.Rings))
+	for i, ring := range p.Rings {
+		if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+			err = ErrInvalidGeoJSON
+			return
+		}
+
+		coordinates[i] = make([][]float64, len(ring))
+		for k, pt := range ring {
+			coordinates[i][k] = []float64{pt.Lng, pt.Lat}
+		}
+	}
+
+	v = geoJSON{
+		Type:        "Polygon",
+		Coordinates: coordinates,
+	}
+	return
+}
+
+// SetBSON implements bson.Setter, reading Polygon from GeoJSON.
+func (p *Polygon) SetBSON(raw bson.Raw) (err error) {
+	var g struct {
+		Type        string        `bson:"type"`
+		Coordinates [][][]float64 `bson:"coordinates"`
+	}
+
+	if err = raw.Unmarshal(&g); err != nil {
+		return
+	}
+
+	if g.Type != "Polygon" {
+		err = ErrInvalidGeoJSON
+		return
+	}
+
+	p.Rings = make([][]Point, len(g.Coordinates))
+	for i, ring := range g.Coordinates {
+		p.Rings[i] = make([]Point, len(ring))
+		for k, pt := range ring {
+			if len(pt) != 2 {
+				err = ErrInvalidGeoJSON
+				return
+			}
+			p.Rings[i][k] = NewPoint(pt[0], pt[1])
+		}
+	}
+	return
+}
+
+// GeoResult it's a document found by Near, with its distance in meters
+// to the point searched.
+type GeoResult struct {
+	Document Documenter
+	Distance float64
+}
+
+// GeoIndex returns a 2dsphere index on field, holding a Point or
+// Polygon. The index can be passed to NewHandle or NewRepository, and
+// it's needed by Near and Within.
+func GeoIndex(field string) (i mgo.Index) {
+	i = mgo.Index{
+		Key: []string{"$2dsphere:" + field},
+	}
+	return
+}
+
+// Near finds documents on collection connected to Handle, with the
+// field of its 2dsphere index at most maxDistance meters from point,
+// and matching the search map if defined. The results are sorted by
+// distance, with the distance of each document.
+func (h *Handle) Near(point Point, maxDistance float64) (out []GeoResult, err error) {
+	var d Documenter
+	if d, err = h.current(); err != nil {
+		return
+	}
+
+	var stage, filter M
+	if filter, err = h.filter(d); err != nil {
+		return
+	}
+	if stage, err = nearStage(h.collectionIndexes, point, maxDistance, filter); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		var result []bson.Raw
+		if err = wrapErr(h.collectionName, c.Pipe([]M{stage}).All(&result)); err == nil {
+			out = make([]GeoResult, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				var doc RawDocument
+				if out[i].Distance, doc, err = popDistance(result[i].Data); err == nil {
+					out[i].Document = h.newDocument()
+					err = h.initRaw(out[i].Document, doc)
+				}
+			}
+		}
+	}
+	return
+}
+
+// Within finds documents on collection connected to Handle, with the
+// field of its 2dsphere index inside polygon, and matching the search
+// map if defined.
+func (h *Handle) Within(polygon Polygon) (out []Documenter, err error) {
+	var d Documenter
+	if d, err = h.current(); err != nil {
+		return
+	}
+
+	var filter M
+	if filter, err = h.filter(d); err != nil {
+		return
+	}
+	if filter, err = withinFilter(h.collectionIndexes, polygon, filter); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		var result []bson.Raw
+		if err = wrapErr(h.collectionName, c.Find(filter).All(&result)); err == nil {
+			out = make([]Documenter, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				out[i] = h.newDocument()
+				err = h.initRaw(out[i], result[i].Data)
+			}
+		}
+	}
+	return
+}
+
+// Near finds documents on collection, with the field of its 2dsphere
+// index at most maxDistance meters from point, and matching filter if
+// not nil. The results are sorted by distance, with the distance of
+// each document.
+func (r *Repository) Near(point Point, maxDistance float64, filter M) (out []GeoResult, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	var stage M
+	if stage, err = nearStage(r.indexes, point, maxDistance, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		var result []bson.Raw
+		if err = c.Pipe([]M{stage}).All(&result); err == nil {
+			out = make([]GeoResult, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				var doc RawDocument
+				if out[i].Distance, doc, err = popDistance(result[i].Data); err == nil {
+					out[i].Document, err = r.initRaw(doc)
+				}
+			}
+		}
+		return
+	})
+	return
+}
+
+// Within finds documents on collection, with the field of its 2dsphere
+// index inside polygon, and matching filter if not nil.
+func (r *Repository) Within(polygon Polygon, filter M) (out []Documenter, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+	if filter, err = withinFilter(r.indexes, polygon, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		var result []bson.Raw
+		if err = c.Find(filter).All(&result); err == nil {
+			out = make([]Documenter, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				out[i], err = r.initRaw(result[i].Data)
+			}
+		}
+		return
+	})
+	return
+}
+
+// geoField returns the field of the first 2dsphere index on indexes,
+// or ErrNoGeoIndex if there's none.
+func geoField(indexes []mgo.Index) (field string, err error) {
+	for _, i := range indexes {
+		for _, k := range i.Key {
+			if strings.HasPrefix(k, "$2dsphere:") {
+				field = strings.TrimPrefix(k, "$2dsphere:")
+				return
+			}
+		}
+	}
+
+	err = ErrNoGeoIndex
+	return
+}
+
+// nearStage returns the $geoNear stage finding documents near point,
+// on the field of the 2dsphere index on indexes.
+func nearStage(indexes []mgo.Index, point Point, maxDistance float64, filter M) (stage M, err error) {
+	var field string
+	if field, err = geoField(indexes); err != nil {
+		return
+	}
+
+	near := M{
+		"near":          point,
+		"key":           field,
+		"distanceField": distanceKey,
+		"maxDistance":   maxDistance,
+		"spherical":     true,
+	}
+
+	if len(filter) > 0 {
+		near["query"] = filter
+	}
+
+	stage = M{"$geoNear": near}
+	return
+}
+
+// withinFilter returns filter added of the condition finding documents
+// inside polygon, on the field of the 2dsphere index on indexes.
+func withinFilter(indexes []mgo.Index, polygon Polygon, filter M) (m M, err error) {
+	var field string
+	if field, err = geoField(indexes); err != nil {
+		return
+	}
+
+	if _, err = polygon.GetBSON(); err != nil {
+		return
+	}
+
+	m = make(M, len(filter)+1)
+	for k, v := range filter {
+		m[k] = v
+	}
+	m[field] = M{"$geoWithin": M{"$geometry": polygon}}
+	return
+}
+
+// popDistance returns the distance of document raw, and raw without
+// it.
+func popDistance(raw RawDocument) (distance float64, doc RawDocument, err error) {
+	distance, doc, err = popRaw(raw, distanceKey)
+	return
+}
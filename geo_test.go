@@ -0,0 +1,145 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// place it's a type embedding the Document struct, with a location.
+type place struct {
+	Document `bson:",inline"`
+	NameV    string `bson:"name"`
+	LocV     Point  `bson:"loc"`
+}
+
+// New creates a new place bound to its Document.
+func (p *place) New() (doc Documenter) {
+	doc = Bind(&place{})
+	return
+}
+
+// Validate checks for problems on place.
+func (p *place) Validate() (err error) {
+	return
+}
+
+// Feature Store GeoJSON shapes on documents
+// - As a developer,
+// - I want Point and Polygon types stored as GeoJSON,
+// - So that MongoDB can index and query them.
+func Test_Store_GeoJSON_shapes_on_documents(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a place p on Point(-35.2, -5.8)", func(when bdd.When, args ...interface{}) {
+		p := Bind(&place{NameV: "Natal", LocV: NewPoint(-35.2, -5.8)})
+
+		when("p is mapped and read into a new place q", func(it bdd.It) {
+			m, errMap := p.Map()
+
+			q := p.New()
+			errInit := q.Init(m)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errMap)
+				assert.NoError(errInit)
+			})
+			it("loc should be a GeoJSON Point", func(assert bdd.Assert) {
+				assert.Equal(M{
+					"type":        "Point",
+					"coordinates": []interface{}{-35.2, -5.8},
+				}, m["loc"])
+			})
+			it("q should have the same location", func(assert bdd.Assert) {
+				assert.Equal(NewPoint(-35.2, -5.8), q.(*place).LocV)
+			})
+		})
+	})
+
+	given(t, "the points (0, 0), (1, 0) and (1, 1)", func(when bdd.When, args ...interface{}) {
+		a, b, c := NewPoint(0, 0), NewPoint(1, 0), NewPoint(1, 1)
+
+		when("NewPolygon() is called with them", func(it bdd.It) {
+			p := NewPolygon(a, b, c)
+			_, err := p.GetBSON()
+
+			it("should close the ring", func(assert bdd.Assert) {
+				assert.Equal([][]Point{{a, b, c, a}}, p.Rings)
+			})
+			it("should be a valid GeoJSON", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+		})
+
+		when("a Polygon with a ring not closed is stored", func(it bdd.It) {
+			_, err := Polygon{Rings: [][]Point{{a, b, c}}}.GetBSON()
+
+			it("should return ErrInvalidGeoJSON", func(assert bdd.Assert) {
+				assert.Equal(ErrInvalidGeoJSON, err)
+			})
+		})
+	})
+
+	given(t, "a Handle h of places without a 2dsphere index", func(when bdd.When, args ...interface{}) {
+		h := &Handle{}
+		h.SetDocument(&place{})
+
+		when("h.Near() and h.Within() are called", func(it bdd.It) {
+			_, errNear := h.Near(NewPoint(0, 0), 100)
+			_, errWithin := h.Within(NewPolygon(NewPoint(0, 0), NewPoint(1, 0), NewPoint(1, 1)))
+
+			it("should return ErrNoGeoIndex", func(assert bdd.Assert) {
+				assert.Equal(ErrNoGeoIndex, errNear)
+				assert.Equal(ErrNoGeoIndex, errWithin)
+			})
+		})
+	})
+}
+
+// Feature Query documents by location
+// - As a developer,
+// - I want to find documents near a point or inside a polygon,
+// - So that I can serve deliveries by location.
+func Test_Query_documents_by_location(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a Repository r of places, with a 2dsphere index on loc", func(when bdd.When, args ...interface{}) {
+		r := NewRepository("places", &place{}, GeoIndex("loc"))
+
+		_ = r.Insert(&place{NameV: "Natal", LocV: NewPoint(-35.21, -5.79)})
+		_ = r.Insert(&place{NameV: "Parnamirim", LocV: NewPoint(-35.26, -5.91)})
+		_ = r.Insert(&place{NameV: "Recife", LocV: NewPoint(-34.88, -8.05)})
+
+		when("r.Near() is called on Natal, with max distance of 20km", func(it bdd.It) {
+			out, err := r.Near(NewPoint(-35.21, -5.79), 20000, nil)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should return Natal and Parnamirim, the closest first", func(assert bdd.Assert) {
+				assert.Len(out, 2)
+				assert.Equal("Natal", out[0].Document.(*place).NameV)
+				assert.Equal("Parnamirim", out[1].Document.(*place).NameV)
+				assert.True(out[0].Distance < out[1].Distance)
+			})
+		})
+
+		when("r.Within() is called with a polygon around Recife", func(it bdd.It) {
+			out, err := r.Within(NewPolygon(
+				NewPoint(-35, -8.2), NewPoint(-34.7, -8.2),
+				NewPoint(-34.7, -7.9), NewPoint(-35, -7.9),
+			), nil)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should return only Recife", func(assert bdd.Assert) {
+				assert.Len(out, 1)
+				assert.Equal("Recife", out[0].(*place).NameV)
+			})
+		})
+	})
+}
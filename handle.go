@@ -3,8 +3,10 @@ package mongo
 import (
 	"errors"
 	"reflect"
+	"sync"
 
 	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 )
 
 var (
@@ -16,67 +18,125 @@ var (
 )
 
 // Handle it's a type implementing the Handler interface, responsible
-// of taking documents and using them to manipulate collections.
+// of taking documents and using them to manipulate collections. It's
+// safe for concurrent use by multiple goroutines, each operation
+// working with the document and search map defined when it starts.
 type Handle struct {
+	mu                sync.RWMutex
 	safely            bool
+	closing           bool
+	inFlight          int
 	socket            *DatabaseSocket
 	collection        *mgo.Collection
 	collectionName    string
 	collectionIndexes []mgo.Index
-	DocumentV         Documenter
-	InternalErr       error
-	SearchMapV        M
+	indexErr          error
+	schemaErr         error
+	clock             Clock
+	ids               IDGenerator
+	timeFormat        TimeFormat
+	document          Documenter
+	searchMap         M
 }
 
 // NewHandle creates a new Handle to be embedded onto handle for other
 // types. It needs the name for collection to link, and a document not
 // nil to perform some operations. It also accept optional indexes to
-// be loaded onto collection.
+// be loaded onto collection, with any error reported by IndexErr. The
+// schema of document it's applied as validator of collection, when
+// enabled by SetSchemaValidation, with any error reported by SchemaErr.
 func NewHandle(name string, doc Documenter, indexes ...mgo.Index) (h *Handle) {
-	sk := NewSocket()
-
 	h = &Handle{
 		safely:            false,
-		socket:            sk,
-		collection:        sk.DB().C(name),
 		collectionName:    name,
 		collectionIndexes: indexes,
 	}
 
 	h.SetDocument(doc)
 	h.ensureIndexes()
+	h.ensureSchema()
 	return
 }
 
 // Close ends connection with the MongoDB collection for this handle.
-// Resets socket to be used again after relinked with Link. If no
-// Socket is defined, do nothing to avoid errors.
+// Operations in progress finish before the connection ends, and the
+// next operation connects again. If no connection is open, do nothing
+// to avoid errors.
 func (h *Handle) Close() {
-	if h.socket != nil {
-		h.socket.Close()
-		h.socket = nil
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.inFlight > 0 {
+		h.closing = true
+	} else {
+		h.closeSocket()
 	}
 }
 
 // Safely sets Handle to close after any operation.
 func (h *Handle) Safely() {
+	h.mu.Lock()
 	h.safely = true
+	h.mu.Unlock()
+}
+
+// SetClock defines a Clock to calculate created_on and updated_on of
+// documents on this Handle, instead of the one used by connection. It
+// requires the Documenter to implement Stamper, otherwise the
+// Documenter calculate methods are used. Receiving nil, it returns to
+// use the Clock of connection.
+func (h *Handle) SetClock(c Clock) {
+	h.mu.Lock()
+	h.clock = c
+	h.mu.Unlock()
+}
+
+// SetIDGenerator defines an IDGenerator to create ids of documents
+// inserted with this Handle, instead of the one used by connection. It
+// requires the Documenter to implement Stamper, otherwise the
+// Documenter GenerateID method is used. Receiving nil, it returns to
+// use the IDGenerator of connection.
+func (h *Handle) SetIDGenerator(g IDGenerator) {
+	h.mu.Lock()
+	h.ids = g
+	h.mu.Unlock()
+}
+
+// SetTimeFormat defines the TimeFormat used to store created_on and
+// updated_on values with this Handle, instead of the one used by
+// connection. Receiving an invalid format, it returns to use the
+// TimeFormat of connection.
+func (h *Handle) SetTimeFormat(f TimeFormat) {
+	h.mu.Lock()
+	h.timeFormat = f
+	h.mu.Unlock()
+}
+
+// TimeFormat returns the TimeFormat used by Handle.
+func (h *Handle) TimeFormat() (f TimeFormat) {
+	h.mu.RLock()
+	f = h.format()
+	h.mu.RUnlock()
+	return
 }
 
 // Clean resets handler values.
 func (h *Handle) Clean() {
-	h.SearchMapV = make(map[string]interface{})
+	h.mu.Lock()
+	h.searchMap = make(map[string]interface{})
+
+	if h.document != nil {
+		h.document = Bind(h.document.New())
+	}
 
-	if h.Document() != nil {
-		h.SetDocument(h.Document().New())
+	if h.inFlight > 0 {
+		h.closing = true
+	} else {
+		h.closeSocket()
 	}
 
-	h.Close()
-	sk := NewSocket()
-	h.socket = sk
 	h.safely = false
-	h.collection = sk.DB().C(h.Name())
-	h.ensureIndexes()
+	h.mu.Unlock()
 }
 
 // Name returns the name of connection that Handle can connect.
@@ -92,13 +152,29 @@ func (h *Handle) IsSearchEmpty() (result bool) {
 	return
 }
 
+// IndexErr returns the error received loading the indexes of Handle
+// onto collection, on NewHandle. Indexes differing from the ones on
+// collection are reported with an *IndexDriftError.
+func (h *Handle) IndexErr() (err error) {
+	h.mu.RLock()
+	err = h.indexErr
+	h.mu.RUnlock()
+	return
+}
+
 // Count returns the number of documents on collection connected to
 // Handle.
 func (h *Handle) Count() (n int, err error) {
-	defer h.ifSafelyClose()
+	if _, err = h.current(); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
 
-	if err = h.InternalErr; err == nil {
-		n, err = h.collection.Count()
+		n, err = c.Count()
+		err = wrapErr(h.collectionName, err)
 	}
 
 	return
@@ -107,17 +183,20 @@ func (h *Handle) Count() (n int, err error) {
 // Find search for a document matching the doc data on collection
 // connected to Handle.
 func (h *Handle) Find() (out Documenter, err error) {
-	defer h.ifSafelyClose()
+	out = h.newDocument()
 
-	if err = h.InternalErr; err == nil {
-		out = h.Document().New()
+	var mapped M
+	if mapped, err = h.mapped(); err != nil {
+		return
+	}
 
-		var mapped M
-		if mapped, err = h.mapped(); err == nil {
-			var result interface{}
-			if err = h.collection.Find(mapped).One(&result); err == nil {
-				err = out.Init(result.(M))
-			}
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		var raw bson.Raw
+		if err = wrapErr(h.collectionName, c.Find(mapped).One(&raw)); err == nil {
+			err = h.initRaw(out, raw.Data)
 		}
 	}
 	return
@@ -131,26 +210,29 @@ type QueryOptions struct {
 // FindAll search for all documents matching the document data on
 // collection connected to Handle. Accepts options to alter result.
 func (h *Handle) FindAll(opts ...QueryOptions) (out []Documenter, err error) {
-	defer h.ifSafelyClose()
-
-	if err = h.InternalErr; err == nil {
-		var mapped M
-		if mapped, err = h.mapped(); err == nil {
-			var result []interface{}
-			qry := h.collection.Find(mapped)
-
-			if len(opts) == 1 {
-				if opts[0].Sort != nil {
-					qry = qry.Sort(opts[0].Sort...)
-				}
+	var mapped M
+	if mapped, err = h.mapped(); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		var result []bson.Raw
+		qry := c.Find(mapped)
+
+		if len(opts) == 1 {
+			if opts[0].Sort != nil {
+				qry = qry.Sort(opts[0].Sort...)
 			}
+		}
 
-			if err = qry.All(&result); err == nil {
-				out = make([]Documenter, len(result))
-				for i := 0; i < len(result) && err == nil; i++ {
-					out[i] = h.Document().New()
-					err = out[i].Init(result[i].(M))
-				}
+		if err = wrapErr(h.collectionName, qry.All(&result)); err == nil {
+			out = make([]Documenter, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				out[i] = h.newDocument()
+				err = h.initRaw(out[i], result[i].Data)
 			}
 		}
 	}
@@ -159,26 +241,19 @@ func (h *Handle) FindAll(opts ...QueryOptions) (out []Documenter, err error) {
 }
 
 // Insert puts a new document on collection connected to Handle, using
-// document data.
+// document data. The document it's checked by ValidateStruct and its
+// Validate method before.
 func (h *Handle) Insert() (err error) {
-	defer h.ifSafelyClose()
-
-	if err = h.InternalErr; err == nil {
-		if h.Document().ID() == "" {
-			h.Document().GenerateID()
-		}
+	var mapped M
+	if mapped, err = h.prepareInsert(); err != nil {
+		return
+	}
 
-		h.Document().CalculateCreatedOn()
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
 
-		var mapped M
-		if mapped, err = h.mapped(); err == nil {
-			// Even if the new document were made with SearchFor, it
-			// add these attributes, since they're important.
-			mapped["_id"] = h.Document().ID()
-			mapped["created_on"] = h.Document().CreatedOn()
-
-			err = h.collection.Insert(mapped)
-		}
+		err = wrapErr(h.collectionName, c.Insert(mapped))
 	}
 
 	return
@@ -187,14 +262,20 @@ func (h *Handle) Insert() (err error) {
 // Remove delete a document on collection connected to Handle, matching
 // id received.
 func (h *Handle) Remove(id ObjectId) (err error) {
-	defer h.ifSafelyClose()
+	if _, err = h.current(); err != nil {
+		return
+	}
 
-	if err = h.InternalErr; err == nil {
-		if id == "" {
-			err = ErrIDNotDefined
-		} else {
-			err = h.collection.RemoveId(id)
-		}
+	if id == "" {
+		err = ErrIDNotDefined
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		err = wrapErr(h.collectionName, c.RemoveId(id))
 	}
 
 	return
@@ -203,97 +284,334 @@ func (h *Handle) Remove(id ObjectId) (err error) {
 // RemoveAll delete all documents on collection connected to Handle,
 // matching the document data.
 func (h *Handle) RemoveAll() (info *mgo.ChangeInfo, err error) {
-	defer h.ifSafelyClose()
+	var mapped M
+	if mapped, err = h.mapped(); err != nil {
+		return
+	}
 
-	if err = h.InternalErr; err == nil {
-		var mapped M
-		if mapped, err = h.mapped(); err == nil {
-			info, err = h.collection.RemoveAll(mapped)
-		}
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		info, err = c.RemoveAll(mapped)
+		err = wrapErr(h.collectionName, err)
 	}
 
 	return
 }
 
 // Update updates a document on collection connected to Handle,
-// matching id received, updating with the information on doc.
+// matching id received, updating with the information on doc. The
+// document it's checked by ValidateStruct and its Validate method
+// before.
 func (h *Handle) Update(id ObjectId) (err error) {
-	defer h.ifSafelyClose()
+	if _, err = h.current(); err != nil {
+		return
+	}
 
-	if err = h.InternalErr; err == nil {
-		if id == "" {
-			err = ErrIDNotDefined
-		} else {
-			h.Document().CalculateUpdatedOn()
+	if id == "" {
+		err = ErrIDNotDefined
+		return
+	}
 
-			var mapped M
-			if mapped, err = h.mapped(); err == nil {
-				delete(mapped, "_id")
-				mapped["updated_on"] = h.Document().UpdatedOn()
+	var mapped M
+	if mapped, err = h.prepareUpdate(); err != nil {
+		return
+	}
 
-				idSelector := M{
-					"_id": id,
-				}
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
 
-				err = h.collection.Update(idSelector, mapped)
-			}
+		idSelector := M{
+			"_id": id,
 		}
+
+		err = wrapErr(h.collectionName, c.Update(idSelector, mapped))
 	}
 
 	return
 }
 
-// SetDocument sets product on Handle.
+// SetDocument sets product on Handle. The document it's checked by
+// ValidateStruct and its Validate method on Insert and Update.
 func (h *Handle) SetDocument(d Documenter) {
-	if reflect.ValueOf(d).IsNil() {
-		h.InternalErr = DocNotDefined
-	} else {
-		h.InternalErr = d.Validate()
+	if d != nil && reflect.ValueOf(d).IsNil() {
+		d = nil
 	}
 
-	h.DocumentV = d
+	h.mu.Lock()
+	h.document = Bind(d)
+	h.mu.Unlock()
+}
+
+// newDocument creates a new document of the type used by Handle,
+// bound when embedding Document.
+func (h *Handle) newDocument() (d Documenter) {
+	if doc := h.Document(); doc != nil {
+		d = Bind(doc.New())
+	}
+	return
 }
 
 // Document returns the Document of Handle.
 func (h *Handle) Document() (d Documenter) {
-	d = h.DocumentV
+	h.mu.RLock()
+	d = h.document
+	h.mu.RUnlock()
 	return
 }
 
 // Set search map value for Handle and returns Handle for chaining
-// purposes.
+// purposes. Values compared with encrypted fields of Document are
+// encrypted on each search, as done by Where.
 func (h *Handle) SearchFor(s M) {
-	h.SearchMapV = s
+	h.mu.Lock()
+	h.searchMap = s
+	h.mu.Unlock()
+}
+
+// Where sets the search map of Handle built from query q, checking its
+// fields against the bson tags of Document. On errors, the search map
+// it's left unchanged.
+func (h *Handle) Where(q Query) (err error) {
+	var s M
+	if s, err = q.MFor(h.Document()); err == nil {
+		h.SearchFor(s)
+	}
+	return
 }
 
 // SearchMap return the search map value of Handle.
 func (h *Handle) SearchMap() (s M) {
-	s = h.SearchMapV
+	h.mu.RLock()
+	s = h.searchMap
+	h.mu.RUnlock()
+	return
+}
+
+// current returns the document of Handle, or DocNotDefined if there
+// isn't one.
+func (h *Handle) current() (d Documenter, err error) {
+	if d = h.Document(); d == nil {
+		err = DocNotDefined
+	}
 	return
 }
 
-// ensureIndexes search for any loaded index on Handle, and set it on
-// collection.
+// acquire returns the collection connected to Handle, connecting if
+// needed, and counts an operation in progress until release is called.
+func (h *Handle) acquire() (c *mgo.Collection, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.socket == nil {
+		sk := NewSocket()
+		if db := sk.DB(); db != nil {
+			h.socket = sk
+			h.collection = db.C(h.collectionName)
+		} else {
+			sk.Close()
+			err = ErrNotConnected
+			return
+		}
+	}
+
+	h.inFlight++
+	c = h.collection
+	return
+}
+
+// release ends an operation started with acquire, closing the
+// connection when requested and no other operation is in progress.
+func (h *Handle) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.inFlight--; h.inFlight == 0 && (h.safely || h.closing) {
+		h.closeSocket()
+	}
+}
+
+// closeSocket ends connection with the MongoDB collection. It must be
+// called with Handle locked.
+func (h *Handle) closeSocket() {
+	if h.socket != nil {
+		h.socket.Close()
+		h.socket = nil
+		h.collection = nil
+	}
+
+	h.closing = false
+}
+
+// ensureIndexes declares the indexes of Handle on the IndexManager
+// returned by Indexes, and syncs them with collection. The error
+// received is reported by IndexErr.
 func (h *Handle) ensureIndexes() {
-	for i := 0; i < len(h.collectionIndexes) && h.InternalErr == nil; i++ {
-		h.InternalErr = h.collection.EnsureIndex(h.collectionIndexes[i])
+	if len(h.collectionIndexes) == 0 {
+		return
 	}
+
+	defaultIndexes.Declare(h.collectionName, h.collectionIndexes...)
+	err := defaultIndexes.Sync(h.collectionName)
+
+	h.mu.Lock()
+	h.indexErr = err
+	h.mu.Unlock()
 }
 
-// mapped returns SearchMap if it isn't empty, or the Document mapped.
-func (h *Handle) mapped() (m M, err error) {
-	if h.IsSearchEmpty() {
-		m, err = h.Document().Map()
+// prepareInsert checks the document of Handle, defines its id and
+// created_on, and returns it mapped to be inserted.
+func (h *Handle) prepareInsert() (m M, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d := h.document
+	if d == nil {
+		err = DocNotDefined
+	} else if err = validateDocument(d); err == nil {
+		if d.ID() == "" {
+			h.generateID(d)
+		}
+
+		h.calculateCreatedOn(d)
+
+		if m, err = h.mappedLocked(); err == nil {
+			// Even if the new document were made with SearchFor, it
+			// add these attributes, since they're important.
+			m["_id"] = d.ID()
+			m["created_on"] = h.format().Value(d.CreatedOn())
+		}
+	}
+	return
+}
+
+// prepareUpdate checks the document of Handle, defines its updated_on,
+// and returns it mapped to update a document.
+func (h *Handle) prepareUpdate() (m M, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d := h.document
+	if d == nil {
+		err = DocNotDefined
+	} else if err = validateDocument(d); err == nil {
+		h.calculateUpdatedOn(d)
+
+		if m, err = h.mappedLocked(); err == nil {
+			delete(m, "_id")
+			m["updated_on"] = h.format().Value(d.UpdatedOn())
+		}
+	}
+	return
+}
+
+// generateID creates a new id for document d, with the IDGenerator of
+// Handle if possible.
+func (h *Handle) generateID(d Documenter) {
+	if s, ok := d.(Stamper); ok && h.ids != nil {
+		s.SetID(h.ids.NewID())
 	} else {
-		m = h.SearchMap()
+		d.GenerateID()
 	}
+}
 
+// calculateCreatedOn updates created_on of document d, with the Clock
+// of Handle if possible.
+func (h *Handle) calculateCreatedOn(d Documenter) {
+	if s, ok := d.(Stamper); ok && h.clock != nil {
+		s.SetCreatedOn(inMilli(h.clock.Now()))
+	} else {
+		d.CalculateCreatedOn()
+	}
+}
+
+// calculateUpdatedOn updates updated_on of document d, with the Clock
+// of Handle if possible.
+func (h *Handle) calculateUpdatedOn(d Documenter) {
+	if s, ok := d.(Stamper); ok && h.clock != nil {
+		s.SetUpdatedOn(inMilli(h.clock.Now()))
+	} else {
+		d.CalculateUpdatedOn()
+	}
+}
+
+// format returns the TimeFormat used by Handle. It must be called with
+// Handle locked.
+func (h *Handle) format() (f TimeFormat) {
+	if f = h.timeFormat; !f.valid() {
+		f = currentTimeFormat()
+	}
+	return
+}
+
+// init fills document d with values on m, read from collection.
+func (h *Handle) init(d Documenter, m M) (err error) {
+	h.TimeFormat().loadTimes(m)
+	err = d.Init(m)
 	return
 }
 
-// ifSafelyClose checks if safely was activated to close socket.
-func (h *Handle) ifSafelyClose() {
-	if h.safely {
-		h.Close()
+// initRaw fills document d with the document raw, read from
+// collection, straight when d supports it, or through init.
+func (h *Handle) initRaw(d Documenter, raw RawDocument) (err error) {
+	var decoded bool
+	if decoded, err = decodeDocument(d, raw, h.TimeFormat()); !decoded {
+		var m M
+		if m, err = UnmarshalToM(raw); err == nil {
+			err = h.init(d, m)
+		}
 	}
+	return
+}
+
+// mapped returns SearchMap if it isn't empty, or the Document mapped,
+// with its times on the TimeFormat of Handle, to search documents. The
+// values of SearchMap compared with encrypted fields are encrypted, and
+// the fields of Document encrypted randomly are omitted, since they
+// never match the ones stored.
+func (h *Handle) mapped() (m M, err error) {
+	h.mu.RLock()
+	m, err = h.mappedLocked()
+	d, searching := h.document, len(h.searchMap) > 0
+	h.mu.RUnlock()
+
+	var fields map[string]encryptedField
+	if err == nil {
+		if fields, err = encryptedFields(reflect.TypeOf(d), encoderOf(d)); err == nil {
+			if searching {
+				m, err = encryptFilter(m, fields)
+			} else {
+				omitRandomized(m, fields)
+			}
+		}
+	}
+	return
+}
+
+// filter returns SearchMap, with the values compared with encrypted
+// fields of d encrypted.
+func (h *Handle) filter(d Documenter) (filter M, err error) {
+	filter, err = filterFor(d, h.SearchMap())
+	return
+}
+
+// mappedLocked works as mapped, and must be called with Handle locked.
+func (h *Handle) mappedLocked() (m M, err error) {
+	switch {
+	case h.document == nil:
+		err = DocNotDefined
+	case len(h.searchMap) == 0:
+		if m, err = h.document.Map(); err == nil {
+			h.format().storeTimes(m)
+		}
+	default:
+		m = make(M, len(h.searchMap))
+		for k, v := range h.searchMap {
+			m[k] = v
+		}
+	}
+
+	return
 }
@@ -4,6 +4,7 @@ package mongo
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -255,10 +256,7 @@ func Test_Insert_documents_with_Handle(t *testing.T) {
 		}
 
 		when("p.Insert() is called", func(it bdd.It) {
-			now = func() (t time.Time) {
-				t = args[1].(time.Time)
-				return
-			}
+			SetClock(FrozenClock(args[1].(time.Time)))
 			defer resetUtils()
 			err := p.Safely().Insert()
 
@@ -382,10 +380,7 @@ func Test_Update_documents_with_Handle(t *testing.T) {
 		p := newProductHandle()
 
 		when("p.Update('%[1]v') is called", func(it bdd.It) {
-			now = func() (t time.Time) {
-				t = args[1].(time.Time)
-				return
-			}
+			SetClock(FrozenClock(args[1].(time.Time)))
 			defer resetUtils()
 
 			err := p.Safely().Update(args[0].(ObjectId))
@@ -411,3 +406,61 @@ func Test_Update_documents_with_Handle(t *testing.T) {
 	))
 
 }
+
+// Feature Share Handle between goroutines
+// - As a developer,
+// - I want to use the same Handle on many goroutines,
+// - So that I don't need a Handle for each request.
+func Test_Share_Handle_between_goroutines(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a linked ProductHandle p used safely and products collection with documents "+colFixtures, func(when bdd.When, args ...interface{}) {
+		p := newProductHandle().Safely()
+
+		when("p.Count() and p.Find() are called by 10 goroutines each", func(it bdd.It) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+
+			for i := 0; i < 10; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					_, err := p.Count()
+					errs <- err
+				}()
+				go func() {
+					defer wg.Done()
+					_, err := p.Handle.Find()
+					errs <- err
+				}()
+			}
+
+			wg.Wait()
+			close(errs)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				for err := range errs {
+					assert.NoError(err)
+				}
+			})
+		})
+	})
+
+	given(t, "a ProductHandle p with an invalid customer document", func(when bdd.When, args ...interface{}) {
+		p := newProductHandle()
+		p.Handle.SetDocument(&customer{})
+
+		when("p.Insert() is called, and then p.Count() with a product", func(it bdd.It) {
+			errInsert := p.Handle.Insert()
+			n, err := p.SetDocument(newProduct()).Count()
+
+			it("should refuse the invalid customer", func(assert bdd.Assert) {
+				assert.Error(errInsert)
+			})
+			it("should count with no errors after", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(len(fixtures), n)
+			})
+		})
+	})
+}
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
 )
 
 const (
@@ -35,9 +34,11 @@ func fixture(i int) (p *product) {
 	return
 }
 
-// cleanChanges call resetDB ignoring its error.
+// cleanChanges call resetDB ignoring its error, and makes indexes be
+// synced again.
 func cleanChanges() {
 	_ = resetDB()
+	Indexes().Reset()
 }
 
 // PrepareTestMongoAndRun setup test to run with a temporary database
@@ -144,6 +145,21 @@ func (p *product) CalculateUpdatedOn() {
 	p.UpdatedOnV = NowInMilli()
 }
 
+// SetID defines the _id attribute of a Document.
+func (p *product) SetID(id ObjectId) {
+	p.IDV = id
+}
+
+// SetCreatedOn defines the created_on attribute of a Document.
+func (p *product) SetCreatedOn(t int64) {
+	p.CreatedOnV = t
+}
+
+// SetUpdatedOn defines the updated_on attribute of a Document.
+func (p *product) SetUpdatedOn(t int64) {
+	p.UpdatedOnV = t
+}
+
 // productHandle it's a type embedding the Handle struct, it's capable
 // of storing Products.
 type productHandle struct {
@@ -233,8 +249,8 @@ func expectedNowInMilli(t time.Time) (r int64) {
 	return
 }
 
-// resetUtils reset the functions named now and newID.
+// resetUtils reset the Clock and IDGenerator used by connection.
 func resetUtils() {
-	now = time.Now
-	newID = bson.NewObjectId
+	SetClock(nil)
+	SetIDGenerator(nil)
 }
@@ -0,0 +1,235 @@
+package mongo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ImportOptions enumerates the options of documents imported by Handle.
+type ImportOptions struct {
+	// Format it's the format of documents read. CSV files must start
+	// with a header naming the fields of each column, with nested
+	// fields separated by dots.
+	Format ExportFormat
+	// BatchSize it's the number of documents written on each request,
+	// and between calls of Progress. It's 1000 if zero.
+	BatchSize int
+	// Upsert replaces the documents on collection with the same _id of
+	// the ones imported, instead of failing with ErrDuplicateKey.
+	Upsert bool
+	// Progress it's called with the number of documents imported,
+	// after each batch.
+	Progress func(n int)
+}
+
+// Import reads the documents on r, on the format of opts, and writes
+// them on collection connected to Handle, in batches. The documents
+// are stored as they are read, without being checked by Validate. It
+// returns the number of documents imported, counting the ones of
+// batches written before an error.
+func (h *Handle) Import(r io.Reader, opts ImportOptions) (n int, err error) {
+	var in documentReader
+	if in, err = newDocumentReader(r, opts.Format); err != nil {
+		return
+	}
+
+	if _, err = h.current(); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		batch := make([]RawDocument, 0, batchSize(opts.BatchSize))
+		for err == nil {
+			var d RawDocument
+			if d, err = in.read(); err == nil {
+				batch = append(batch, d)
+			}
+
+			if full := len(batch) == cap(batch); len(batch) > 0 && (full || err == io.EOF) {
+				if errBatch := h.importBatch(c, batch, opts.Upsert); errBatch != nil {
+					err = errBatch
+				} else {
+					n += len(batch)
+					batch = batch[:0]
+					report(opts.Progress, n)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	return
+}
+
+// importBatch writes the documents of batch on collection c, replacing
+// the ones with the same _id if upsert.
+func (h *Handle) importBatch(c *mgo.Collection, batch []RawDocument, upsert bool) (err error) {
+	b := c.Bulk()
+	for _, d := range batch {
+		doc := bson.Raw{Kind: bson.ElementDocument, Data: d}
+
+		var id interface{}
+		if v, found := d.Lookup("_id"); upsert && found && v.Unmarshal(&id) == nil {
+			b.Upsert(M{"_id": id}, doc)
+		} else {
+			b.Insert(doc)
+		}
+	}
+
+	_, err = b.Run()
+	err = wrapErr(h.collectionName, err)
+	return
+}
+
+// documentReader reads documents on a format, returning io.EOF after
+// the last one.
+type documentReader interface {
+	read() (RawDocument, error)
+}
+
+// newDocumentReader returns the documentReader of format, reading r.
+func newDocumentReader(r io.Reader, format ExportFormat) (dr documentReader, err error) {
+	switch format {
+	case BSONDump:
+		dr = &dumpDocumentReader{r: NewDumpReader(r)}
+	case JSONLines:
+		dr = &jsonDocumentReader{r: bufio.NewReader(r)}
+	case CSV:
+		dr = &csvDocumentReader{r: csv.NewReader(r)}
+	default:
+		err = ErrUnknownFormat
+	}
+	return
+}
+
+// dumpDocumentReader reads documents of BSONDump.
+type dumpDocumentReader struct {
+	r *DumpReader
+}
+
+// read returns a copy of the next document on dump.
+func (dr *dumpDocumentReader) read() (d RawDocument, err error) {
+	if d, err = dr.r.ReadRaw(); err == nil {
+		d = append(RawDocument(nil), d...)
+	}
+	return
+}
+
+// jsonDocumentReader reads documents of JSONLines, skipping empty
+// lines.
+type jsonDocumentReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// read returns the document on the next line.
+func (dr *jsonDocumentReader) read() (d RawDocument, err error) {
+	for d == nil && err == nil {
+		var line []byte
+		if line, err = dr.r.ReadBytes('\n'); err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		dr.line++
+
+		if line = bytes.TrimSpace(line); err == nil && len(line) > 0 {
+			var raw bson.Raw
+			if err = bsonutils.UnmarshalExtJSON(line, &raw); err == nil {
+				d = raw.Data
+			} else {
+				err = fmt.Errorf("line %d: %w", dr.line, err)
+			}
+		}
+	}
+	return
+}
+
+// csvDocumentReader reads documents of CSV, with the fields named on
+// its header.
+type csvDocumentReader struct {
+	r      *csv.Reader
+	fields []string
+	record int
+}
+
+// read returns the document on the next record. Empty cells are left
+// out of document, and the others are read as Extended JSON, or as
+// strings if they aren't valid JSON.
+func (dr *csvDocumentReader) read() (d RawDocument, err error) {
+	if dr.fields == nil {
+		if dr.fields, err = dr.r.Read(); err != nil {
+			return
+		}
+	}
+
+	var record []string
+	if record, err = dr.r.Read(); err != nil {
+		return
+	}
+	dr.record++
+
+	var doc bson.D
+	for i := 0; i < len(record) && err == nil; i++ {
+		if record[i] == "" {
+			continue
+		}
+
+		var v interface{}
+		if v, err = csvValue(record[i]); err == nil {
+			doc = setPath(doc, strings.Split(dr.fields[i], "."), v)
+		}
+	}
+
+	if err == nil {
+		d, err = bsonutils.Marshal(doc)
+	} else {
+		err = fmt.Errorf("record %d: %w", dr.record, err)
+	}
+	return
+}
+
+// csvValue returns the value of cell, as written by csvCell.
+func csvValue(cell string) (v interface{}, err error) {
+	if !json.Valid([]byte(cell)) {
+		v = cell
+		return
+	}
+
+	var m bson.M
+	if err = bsonutils.UnmarshalExtJSON([]byte(`{"v":`+cell+`}`), &m); err == nil {
+		v = m["v"]
+	}
+	return
+}
+
+// setPath sets v on doc, at the nested field on path, returning doc.
+func setPath(doc bson.D, path []string, v interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Name == path[0] {
+			if len(path) == 1 {
+				doc[i].Value = v
+			} else if nested, ok := doc[i].Value.(bson.D); ok {
+				doc[i].Value = setPath(nested, path[1:], v)
+			}
+			return doc
+		}
+	}
+
+	if len(path) > 1 {
+		v = setPath(nil, path[1:], v)
+	}
+	return append(doc, bson.DocElem{Name: path[0], Value: v})
+}
@@ -0,0 +1,511 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/globalsign/mgo"
+)
+
+// ErrIndexDrift it's an error received when indexes declared differ
+// from the ones found on collection.
+var ErrIndexDrift = errors.New("index drift")
+
+// IndexDriftError it's the error received when indexes declared for
+// collection differ from the ones found on it. It matches ErrIndexDrift
+// with errors.Is.
+type IndexDriftError struct {
+	Collection string
+	Drift      []IndexDrift
+}
+
+// Error returns the indexes changed on collection.
+func (e *IndexDriftError) Error() (s string) {
+	changes := make([]string, len(e.Drift))
+	for i, d := range e.Drift {
+		changes[i] = d.String()
+	}
+
+	s = fmt.Sprintf("index drift on %s: %s", e.Collection, strings.Join(changes, "; "))
+	return
+}
+
+// Is reports if target is ErrIndexDrift.
+func (e *IndexDriftError) Is(target error) (r bool) {
+	r = target == ErrIndexDrift
+	return
+}
+
+// IndexDrift it's an index declared with options different from the
+// index with same name found on collection.
+type IndexDrift struct {
+	Name     string
+	Declared mgo.Index
+	Existing mgo.Index
+	Changes  []string
+}
+
+// String returns the name of index and the options changed.
+func (d IndexDrift) String() (s string) {
+	s = fmt.Sprintf("%s (%s)", d.Name, strings.Join(d.Changes, ", "))
+	return
+}
+
+// IndexPlan it's the list of changes needed to make the indexes of a
+// collection match the ones declared. Indexes changed are dropped and
+// created again, since MongoDB can't alter them.
+type IndexPlan struct {
+	Collection string
+	Create     []mgo.Index
+	Drop       []string
+	Drift      []IndexDrift
+}
+
+// Empty returns true if there's nothing to change on collection.
+func (p IndexPlan) Empty() (r bool) {
+	r = len(p.Create) == 0 && len(p.Drop) == 0
+	return
+}
+
+// String describes the changes of IndexPlan, one per line.
+func (p IndexPlan) String() (s string) {
+	var lines []string
+	for _, name := range p.Drop {
+		lines = append(lines, fmt.Sprintf("drop %s.%s", p.Collection, name))
+	}
+
+	for _, i := range p.Create {
+		lines = append(lines, fmt.Sprintf("create %s.%s", p.Collection, IndexName(i)))
+	}
+
+	for _, d := range p.Drift {
+		lines = append(lines, fmt.Sprintf("changed %s.%s", p.Collection, d))
+	}
+
+	s = strings.Join(lines, "\n")
+	return
+}
+
+// IndexManager keeps the indexes declared for each collection, and
+// compares them with the ones on database, creating and dropping
+// indexes to make them equal. It's safe for concurrent use.
+type IndexManager struct {
+	mu       sync.Mutex
+	declared map[string][]mgo.Index
+	synced   map[string]error
+	// versions counts the changes on indexes declared for each
+	// collection, so Sync doesn't keep a result of indexes replaced.
+	versions map[string]int
+	// syncing holds a lock for each collection, so only one Sync of
+	// a collection reaches database at a time, without blocking the
+	// other collections.
+	syncing map[string]*sync.Mutex
+}
+
+// defaultIndexes it's the IndexManager used by Handle and Repository.
+var defaultIndexes = NewIndexManager()
+
+// NewIndexManager creates an IndexManager without indexes declared.
+func NewIndexManager() (m *IndexManager) {
+	m = &IndexManager{
+		declared: make(map[string][]mgo.Index),
+		synced:   make(map[string]error),
+		versions: make(map[string]int),
+		syncing:  make(map[string]*sync.Mutex),
+	}
+	return
+}
+
+// Indexes returns the IndexManager used by Handle and Repository,
+// holding the indexes declared with them.
+func Indexes() (m *IndexManager) {
+	m = defaultIndexes
+	return
+}
+
+// Declare adds indexes to the ones declared for collection. An index
+// with the name of one already declared replaces it.
+func (m *IndexManager) Declare(collection string, indexes ...mgo.Index) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range indexes {
+		m.declareLocked(collection, i)
+	}
+}
+
+// Declared returns the indexes declared for collection.
+func (m *IndexManager) Declared(collection string) (indexes []mgo.Index) {
+	m.mu.Lock()
+	indexes = append(indexes, m.declared[collection]...)
+	m.mu.Unlock()
+	return
+}
+
+// Reset forgets which collections were synced, so Sync checks them
+// again. Useful after dropping the database.
+func (m *IndexManager) Reset() {
+	m.mu.Lock()
+	for collection := range m.declared {
+		m.changed(collection)
+	}
+	m.mu.Unlock()
+}
+
+// Plan compares the indexes declared with the ones on database, for
+// each collection declared, returning the changes needed.
+func (m *IndexManager) Plan() (plans []IndexPlan, err error) {
+	m.mu.Lock()
+	collections := make([]string, 0, len(m.declared))
+	for c := range m.declared {
+		collections = append(collections, c)
+	}
+	m.mu.Unlock()
+
+	sort.Strings(collections)
+
+	consumeDatabase(func(db *mgo.Database) {
+		for i := 0; i < len(collections) && err == nil; i++ {
+			var p IndexPlan
+			if p, err = m.plan(db, collections[i]); err == nil {
+				plans = append(plans, p)
+			}
+		}
+	}, &err)
+	return
+}
+
+// Apply makes the changes of plans on database, dropping indexes
+// before creating the new ones. The collections on plans are checked
+// again on the next Sync.
+func (m *IndexManager) Apply(plans ...IndexPlan) (err error) {
+	consumeDatabase(func(db *mgo.Database) {
+		for i := 0; i < len(plans) && err == nil; i++ {
+			err = m.apply(db, plans[i])
+		}
+	}, &err)
+
+	m.mu.Lock()
+	for _, p := range plans {
+		m.changed(p.Collection)
+	}
+	m.mu.Unlock()
+	return
+}
+
+// Sync creates the indexes declared for collection missing on database,
+// only once per process, until it succeeds. Indexes declared differing
+// from the ones on database aren't changed, being reported with an
+// *IndexDriftError, on every call. Indexes not declared are kept, and
+// can be dropped with Plan and Apply. Calls for the same collection
+// wait each other, while calls for other collections run at once.
+func (m *IndexManager) Sync(collection string) (err error) {
+	lock := m.syncLock(collection)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.mu.Lock()
+	err, synced := m.synced[collection]
+	declared := append([]mgo.Index(nil), m.declared[collection]...)
+	version := m.versions[collection]
+	m.mu.Unlock()
+
+	if synced || len(declared) == 0 {
+		return
+	}
+
+	consumeDatabase(func(db *mgo.Database) {
+		var p IndexPlan
+		if p, err = planIndexes(db, collection, declared); err == nil {
+			err = m.apply(db, IndexPlan{Collection: collection, Create: missing(p)})
+		}
+
+		if err == nil && len(p.Drift) > 0 {
+			err = &IndexDriftError{Collection: collection, Drift: p.Drift}
+		}
+	}, &err)
+
+	if err == nil || errors.Is(err, ErrIndexDrift) {
+		m.mu.Lock()
+		if m.versions[collection] == version {
+			m.synced[collection] = err
+		}
+		m.mu.Unlock()
+	}
+	return
+}
+
+// syncLock returns the lock of Sync for collection.
+func (m *IndexManager) syncLock(collection string) (lock *sync.Mutex) {
+	m.mu.Lock()
+	if lock = m.syncing[collection]; lock == nil {
+		lock = &sync.Mutex{}
+		m.syncing[collection] = lock
+	}
+	m.mu.Unlock()
+	return
+}
+
+// declareLocked adds index i to collection, and must be called with
+// IndexManager locked.
+func (m *IndexManager) declareLocked(collection string, i mgo.Index) {
+	name := IndexName(i)
+	for k, d := range m.declared[collection] {
+		if IndexName(d) == name {
+			m.declared[collection][k] = i
+			m.changed(collection)
+			return
+		}
+	}
+
+	m.declared[collection] = append(m.declared[collection], i)
+	m.changed(collection)
+}
+
+// changed makes collection be checked again on the next Sync, and must
+// be called with IndexManager locked.
+func (m *IndexManager) changed(collection string) {
+	delete(m.synced, collection)
+	m.versions[collection]++
+}
+
+// plan returns the IndexPlan of collection, on db.
+func (m *IndexManager) plan(db *mgo.Database, collection string) (p IndexPlan, err error) {
+	p, err = planIndexes(db, collection, m.Declared(collection))
+	return
+}
+
+// planIndexes returns the IndexPlan making the indexes of collection,
+// on db, equal to declared.
+func planIndexes(db *mgo.Database, collection string, declared []mgo.Index) (p IndexPlan, err error) {
+	var existing []mgo.Index
+	if existing, err = db.C(collection).Indexes(); isNamespaceNotFound(err) {
+		existing, err = nil, nil
+	}
+
+	if err == nil {
+		p = diffIndexes(collection, declared, existing)
+	}
+	err = wrapErr(collection, err)
+	return
+}
+
+// apply makes the changes of plan p on db.
+func (m *IndexManager) apply(db *mgo.Database, p IndexPlan) (err error) {
+	c := db.C(p.Collection)
+	for i := 0; i < len(p.Drop) && err == nil; i++ {
+		err = c.DropIndexName(p.Drop[i])
+	}
+
+	if len(p.Drop) > 0 {
+		// The indexes dropped may still be on cache of EnsureIndex.
+		db.Session.ResetIndexCache()
+	}
+
+	for i := 0; i < len(p.Create) && err == nil; i++ {
+		err = c.EnsureIndex(p.Create[i])
+	}
+
+	err = wrapErr(p.Collection, err)
+	return
+}
+
+// IndexName returns the name of index i on database, the one defined
+// or the one generated by MongoDB from its keys.
+func IndexName(i mgo.Index) (name string) {
+	if i.Name != "" {
+		name = i.Name
+		return
+	}
+
+	parts := make([]string, len(i.Key))
+	for k, key := range i.Key {
+		switch {
+		case strings.HasPrefix(key, "$") && strings.Contains(key, ":"):
+			c := strings.Index(key, ":")
+			parts[k] = key[c+1:] + "_" + key[1:c]
+		case strings.HasPrefix(key, "@"):
+			parts[k] = key[1:] + "_2d"
+		case strings.HasPrefix(key, "-"):
+			parts[k] = key[1:] + "_-1"
+		default:
+			parts[k] = strings.TrimPrefix(key, "+") + "_1"
+		}
+	}
+
+	name = strings.Join(parts, "_")
+	return
+}
+
+// diffIndexes returns the IndexPlan making existing indexes equal to
+// the declared ones. The _id index it's never changed.
+func diffIndexes(collection string, declared, existing []mgo.Index) (p IndexPlan) {
+	p = IndexPlan{Collection: collection}
+
+	found := make(map[string]mgo.Index, len(existing))
+	for _, i := range existing {
+		found[IndexName(i)] = i
+	}
+
+	wanted := make(map[string]bool, len(declared))
+	for _, d := range declared {
+		name := IndexName(d)
+		wanted[name] = true
+
+		e, ok := found[name]
+		if !ok {
+			p.Create = append(p.Create, d)
+			continue
+		}
+
+		if changes := indexChanges(d, e); len(changes) > 0 {
+			p.Drift = append(p.Drift, IndexDrift{
+				Name:     name,
+				Declared: d,
+				Existing: e,
+				Changes:  changes,
+			})
+			p.Drop = append(p.Drop, name)
+			p.Create = append(p.Create, d)
+		}
+	}
+
+	for _, e := range existing {
+		if name := IndexName(e); !wanted[name] && name != "_id_" {
+			p.Drop = append(p.Drop, name)
+		}
+	}
+	return
+}
+
+// indexChanges returns the options of declared index d that differ
+// from existing index e.
+func indexChanges(d, e mgo.Index) (changes []string) {
+	if !sameKeys(d.Key, e.Key) {
+		changes = append(changes, fmt.Sprintf("key %v, found %v", d.Key, e.Key))
+	}
+
+	if d.Unique != e.Unique {
+		changes = append(changes, fmt.Sprintf("unique %v, found %v", d.Unique, e.Unique))
+	}
+
+	if d.Sparse != e.Sparse {
+		changes = append(changes, fmt.Sprintf("sparse %v, found %v", d.Sparse, e.Sparse))
+	}
+
+	if d.ExpireAfter != e.ExpireAfter {
+		changes = append(changes, fmt.Sprintf("expireAfter %v, found %v", d.ExpireAfter, e.ExpireAfter))
+	}
+
+	if !reflect.DeepEqual(normalize(d.PartialFilter), normalize(e.PartialFilter)) {
+		changes = append(changes, fmt.Sprintf("partialFilter %v, found %v", d.PartialFilter, e.PartialFilter))
+	}
+
+	if d.DefaultLanguage != "" && d.DefaultLanguage != e.DefaultLanguage {
+		changes = append(changes, fmt.Sprintf("defaultLanguage %v, found %v", d.DefaultLanguage, e.DefaultLanguage))
+	}
+
+	for field, w := range d.Weights {
+		if e.Weights[field] != w {
+			changes = append(changes, fmt.Sprintf("weight of %s %v, found %v", field, w, e.Weights[field]))
+		}
+	}
+	return
+}
+
+// sameKeys returns true if keys a and b are equal. Text keys are
+// compared in any order, since MongoDB doesn't keep it.
+func sameKeys(a, b []string) (r bool) {
+	if r = len(a) == len(b); !r {
+		return
+	}
+
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	for k := range a {
+		a[k], b[k] = strings.TrimPrefix(a[k], "+"), strings.TrimPrefix(b[k], "+")
+	}
+
+	if len(a) > 0 && strings.HasPrefix(a[0], "$text:") {
+		sort.Strings(a)
+		sort.Strings(b)
+	}
+
+	r = reflect.DeepEqual(a, b)
+	return
+}
+
+// normalize returns v with all numbers as float64, and empty maps as
+// nil, so values read from database compare equal to the declared.
+func normalize(v interface{}) (n interface{}) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Len() == 0 {
+			return
+		}
+
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = normalize(rv.MapIndex(k).Interface())
+		}
+		n = m
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = normalize(rv.Index(i).Interface())
+		}
+		n = s
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = rv.Float()
+	default:
+		n = v
+	}
+	return
+}
+
+// missing returns the indexes of p to be created that aren't on
+// database yet, ignoring the ones changed.
+func missing(p IndexPlan) (create []mgo.Index) {
+	changed := make(map[string]bool, len(p.Drift))
+	for _, d := range p.Drift {
+		changed[d.Name] = true
+	}
+
+	for _, i := range p.Create {
+		if !changed[IndexName(i)] {
+			create = append(create, i)
+		}
+	}
+	return
+}
+
+// consumeDatabase runs f with the database of a cloned session,
+// setting err to ErrNotConnected if there's no connection.
+func consumeDatabase(f func(*mgo.Database), err *error) {
+	ConsumeDatabaseOnSession(func(db *mgo.Database) {
+		if db == nil {
+			*err = ErrNotConnected
+			return
+		}
+
+		f(db)
+	})
+}
+
+// isNamespaceNotFound returns true if err tells the collection doesn't
+// exist.
+func isNamespaceNotFound(err error) (r bool) {
+	var qe *mgo.QueryError
+	if errors.As(err, &qe) {
+		r = qe.Code == 26 || strings.Contains(qe.Message, "ns does not exist")
+	}
+	return
+}
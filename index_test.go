@@ -0,0 +1,189 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// Feature Compare declared indexes with the ones on database
+// - As a developer,
+// - I want to see how indexes on database differ from the declared,
+// - So that I can review changes before applying them.
+func Test_Compare_declared_indexes_with_the_ones_on_database(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "an index with key %[1]v", func(when bdd.When, args ...interface{}) {
+		i := mgo.Index{Key: args[0].([]string)}
+
+		when("IndexName() is called", func(it bdd.It) {
+			it("should return '%[2]v'", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), IndexName(i))
+			})
+		})
+	}, like(
+		s([]string{"name"}, "name_1"),
+		s([]string{"name", "-price"}, "name_1_price_-1"),
+		s([]string{"$text:name", "$text:email"}, "name_text_email_text"),
+		s([]string{"$2dsphere:loc"}, "loc_2dsphere"),
+		s([]string{"@loc"}, "loc_2d"),
+	))
+
+	given(t, "declared indexes on name (unique), price and kind, and database with _id, name, kind (sparse) and old", func(when bdd.When, args ...interface{}) {
+		declared := []mgo.Index{
+			{Key: []string{"name"}, Unique: true},
+			{Key: []string{"price"}, PartialFilter: M{"price": M{"$gt": 0}}},
+			{Key: []string{"kind"}},
+		}
+		existing := []mgo.Index{
+			{Name: "_id_", Key: []string{"_id"}},
+			{Name: "name_1", Key: []string{"name"}, Unique: true},
+			{Name: "kind_1", Key: []string{"kind"}, Sparse: true},
+			{Name: "old_1", Key: []string{"old"}},
+		}
+
+		when("diffIndexes() is called", func(it bdd.It) {
+			p := diffIndexes("products", declared, existing)
+
+			it("should create price and kind again", func(assert bdd.Assert) {
+				assert.Equal([]mgo.Index{declared[1], declared[2]}, p.Create)
+			})
+			it("should drop kind and old", func(assert bdd.Assert) {
+				assert.Equal([]string{"kind_1", "old_1"}, p.Drop)
+			})
+			it("should report drift on sparse of kind", func(assert bdd.Assert) {
+				assert.Len(p.Drift, 1)
+				assert.Equal("kind_1 (sparse false, found true)", p.Drift[0].String())
+			})
+			it("missing(p) should create only price", func(assert bdd.Assert) {
+				assert.Equal([]mgo.Index{declared[1]}, missing(p))
+			})
+		})
+	})
+
+	given(t, "declared indexes equal to the ones on database, with values read as other types", func(when bdd.When, args ...interface{}) {
+		declared := []mgo.Index{
+			TextIndex("", map[string]int{"name": 2, "email": 1}),
+			{Key: []string{"price"}, PartialFilter: M{"price": M{"$gt": 0}}},
+			{Key: []string{"+created_on"}, ExpireAfter: time.Hour},
+		}
+		existing := []mgo.Index{
+			{Name: "email_text_name_text", Key: []string{"$text:name", "$text:email"}, Weights: map[string]int{"name": 2, "email": 1}, DefaultLanguage: "english"},
+			{Name: "price_1", Key: []string{"price"}, PartialFilter: M{"price": M{"$gt": int64(0)}}},
+			{Name: "created_on_1", Key: []string{"created_on"}, ExpireAfter: time.Hour},
+		}
+
+		when("diffIndexes() is called", func(it bdd.It) {
+			p := diffIndexes("products", declared, existing)
+
+			it("should return an empty plan", func(assert bdd.Assert) {
+				assert.True(p.Empty())
+				assert.Empty(p.Drift)
+			})
+		})
+	})
+
+	given(t, "an IndexManager m with index name declared", func(when bdd.When, args ...interface{}) {
+		m := NewIndexManager()
+		m.Declare("products", mgo.Index{Key: []string{"name"}})
+
+		when("m.Declare() is called with name unique and price", func(it bdd.It) {
+			m.Declare("products", mgo.Index{Key: []string{"name"}, Unique: true}, mgo.Index{Key: []string{"price"}})
+
+			it("should replace name and add price", func(assert bdd.Assert) {
+				assert.Equal([]mgo.Index{
+					{Key: []string{"name"}, Unique: true},
+					{Key: []string{"price"}},
+				}, m.Declared("products"))
+			})
+		})
+
+		when("a Sync of products is running, and items are synced and products declared", func(it bdd.It) {
+			m.Declare("items", mgo.Index{Key: []string{"sku"}})
+
+			running := m.syncLock("products")
+			running.Lock()
+			defer running.Unlock()
+
+			done := make(chan bool)
+			go func() {
+				_ = m.Sync("items")
+				m.Declare("products", mgo.Index{Key: []string{"price"}})
+				done <- true
+			}()
+
+			var finished bool
+			select {
+			case finished = <-done:
+			case <-time.After(5 * time.Second):
+			}
+
+			it("should not wait the Sync of products", func(assert bdd.Assert) {
+				assert.True(finished)
+			})
+		})
+	})
+
+	given(t, "an IndexDriftError", func(when bdd.When, args ...interface{}) {
+		var err error = &IndexDriftError{Collection: "products", Drift: []IndexDrift{
+			{Name: "name_1", Changes: []string{"unique true, found false"}},
+		}}
+
+		when("it's checked", func(it bdd.It) {
+			it("should match ErrIndexDrift", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrIndexDrift))
+			})
+			it("should have the changes on message", func(assert bdd.Assert) {
+				assert.EqualError(err, "index drift on products: name_1 (unique true, found false)")
+			})
+		})
+	})
+}
+
+// Feature Apply declared indexes on database
+// - As a developer,
+// - I want to plan and apply index changes,
+// - So that database indexes follow the code.
+func Test_Apply_declared_indexes_on_database(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "an IndexManager m with a sparse index on updated_on of products", func(when bdd.When, args ...interface{}) {
+		m := NewIndexManager()
+		m.Declare("products", mgo.Index{Key: []string{"updated_on"}, Sparse: true})
+
+		when("m.Sync() is called, and then a manager n declares it not sparse", func(it bdd.It) {
+			errSync := m.Sync("products")
+
+			n := NewIndexManager()
+			n.Declare("products", mgo.Index{Key: []string{"updated_on"}}, mgo.Index{Key: []string{"created_on"}})
+			errDrift := n.Sync("products")
+
+			plans, errPlan := n.Plan()
+			errApply := n.Apply(plans...)
+			after, _ := n.Plan()
+
+			it("m.Sync() should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errSync)
+			})
+			it("n.Sync() should report the drift", func(assert bdd.Assert) {
+				assert.True(errors.Is(errDrift, ErrIndexDrift))
+			})
+			it("n.Plan() should drop and create updated_on_1", func(assert bdd.Assert) {
+				assert.NoError(errPlan)
+				assert.Len(plans, 1)
+				assert.Equal([]string{"updated_on_1"}, plans[0].Drop)
+			})
+			it("after n.Apply(), n.Plan() should be empty", func(assert bdd.Assert) {
+				assert.NoError(errApply)
+				assert.True(after[0].Empty())
+				assert.NoError(n.Sync("products"))
+			})
+		})
+	})
+}
@@ -103,19 +103,122 @@ func handleErr(err *error) {
 //     }
 //
 func Marshal(in interface{}) (out []byte, err error) {
-	return MarshalBuffer(in, make([]byte, 0, initialBufferSize))
+	return Encoder{}.Marshal(in)
 }
 
 // MarshalBuffer behaves the same way as Marshal, except that instead of
 // allocating a new byte slice it tries to use the received byte slice and
 // only allocates more memory if necessary to fit the marshaled value.
 func MarshalBuffer(in interface{}, buf []byte) (out []byte, err error) {
+	return Encoder{}.MarshalBuffer(in, buf)
+}
+
+// Encoder holds the options used to marshal values. Since each call
+// receives its own options, different Encoders can be used at the same
+// time by many goroutines. The zero Encoder behaves like Marshal.
+type Encoder struct {
+	// OmitEmptyDefault makes all struct fields behave as if tagged
+	// with omitempty.
+	OmitEmptyDefault bool
+	// TagName it's the struct tag naming fields, bson if empty.
+	TagName string
+	// FallbackTagName it's the struct tag naming fields without
+	// TagName, like json. Flags unknown on it are ignored.
+	FallbackTagName string
+	// Naming defines the keys of fields without tags.
+	Naming NamingStrategy
+	// InlineConflict defines what happens when a key of an inline map
+	// it's also the key of a struct field.
+	InlineConflict InlineConflict
+	// Registry holds the encoders of types, DefaultRegistry if nil.
+	Registry *Registry
+}
+
+// Marshal serializes the in value, as done by Marshal function, using
+// the options of Encoder.
+func (enc Encoder) Marshal(in interface{}) (out []byte, err error) {
+	return enc.MarshalBuffer(in, make([]byte, 0, initialBufferSize))
+}
+
+// MarshalBuffer behaves the same way as Marshal method, except that
+// instead of allocating a new byte slice it tries to use the received
+// byte slice and only allocates more memory if necessary to fit the
+// marshaled value.
+func (enc Encoder) MarshalBuffer(in interface{}, buf []byte) (out []byte, err error) {
 	defer handleErr(&err)
-	e := &encoder{buf}
+	e := &encoder{out: buf, opts: enc}
 	e.addDoc(reflect.ValueOf(in))
 	return e.out, nil
 }
 
+// FieldKey returns the key of struct field, as marshalled by Encoder,
+// and if it's inline. Fields skipped have key "-".
+func (enc Encoder) FieldKey(field reflect.StructField) (key string, inline bool) {
+	return enc.layout().fieldKey(field)
+}
+
+// layout returns the options of Encoder defining struct keys.
+func (enc Encoder) layout() structOptions {
+	return structOptions{enc.TagName, enc.FallbackTagName, enc.Naming}
+}
+
+// Decoder holds the options used to unmarshal values. Since each call
+// receives its own options, different Decoders can be used at the same
+// time by many goroutines. The zero Decoder behaves like Unmarshal.
+type Decoder struct {
+	// TagName it's the struct tag naming fields, bson if empty.
+	TagName string
+	// FallbackTagName it's the struct tag naming fields without
+	// TagName, like json. Flags unknown on it are ignored.
+	FallbackTagName string
+	// Naming defines the keys of fields without tags.
+	Naming NamingStrategy
+	// Strict makes Unmarshal fail on keys without a struct field to
+	// receive them, instead of discarding them.
+	Strict bool
+	// Registry holds the decoders of types, DefaultRegistry if nil.
+	Registry *Registry
+}
+
+// Unmarshal deserializes data from in into the out value, as done by
+// Unmarshal function, using the options of Decoder.
+func (dec Decoder) Unmarshal(in []byte, out interface{}) (err error) {
+	if raw, ok := out.(*bson.Raw); ok {
+		raw.Kind = 3
+		raw.Data = in
+		return nil
+	}
+	defer handleErr(&err)
+	v := reflect.ValueOf(out)
+	switch v.Kind() {
+	case reflect.Ptr:
+		fallthrough
+	case reflect.Map:
+		d := newDecoder(in)
+		d.opts = dec
+		d.readDocTo(v)
+		if d.i < len(d.in) {
+			return errors.New("document is corrupted")
+		}
+	case reflect.Struct:
+		return errors.New("unmarshal can't deal with struct values. Use a pointer")
+	default:
+		return errors.New("unmarshal needs a map or a pointer to a struct")
+	}
+	return nil
+}
+
+// FieldKey returns the key of struct field, as unmarshalled by
+// Decoder, and if it's inline. Fields skipped have key "-".
+func (dec Decoder) FieldKey(field reflect.StructField) (key string, inline bool) {
+	return dec.layout().fieldKey(field)
+}
+
+// layout returns the options of Decoder defining struct keys.
+func (dec Decoder) layout() structOptions {
+	return structOptions{dec.TagName, dec.FallbackTagName, dec.Naming}
+}
+
 // Unmarshal deserializes data from in into the out value.  The out value
 // must be a map, a pointer to a struct, or a pointer to a bsonutils.D value.
 // In the case of struct values, only exported fields will be deserialized.
@@ -152,28 +255,7 @@ func MarshalBuffer(in interface{}, buf []byte) (out []byte, err error) {
 //
 // Pointer values are initialized when necessary.
 func Unmarshal(in []byte, out interface{}) (err error) {
-	if raw, ok := out.(*bson.Raw); ok {
-		raw.Kind = 3
-		raw.Data = in
-		return nil
-	}
-	defer handleErr(&err)
-	v := reflect.ValueOf(out)
-	switch v.Kind() {
-	case reflect.Ptr:
-		fallthrough
-	case reflect.Map:
-		d := newDecoder(in)
-		d.readDocTo(v)
-		if d.i < len(d.in) {
-			return errors.New("document is corrupted")
-		}
-	case reflect.Struct:
-		return errors.New("unmarshal can't deal with struct values. Use a pointer")
-	default:
-		return errors.New("unmarshal needs a map or a pointer to a struct")
-	}
-	return nil
+	return Decoder{}.Unmarshal(in, out)
 }
 
 // --------------------------------------------------------------------------
@@ -194,7 +276,14 @@ type fieldInfo struct {
 	Inline    []int
 }
 
-var structMap = make(map[reflect.Type]*structInfo)
+// structKey identifies the structInfo of a type, with the options
+// defining its keys.
+type structKey struct {
+	t    reflect.Type
+	opts structOptions
+}
+
+var structMap = make(map[structKey]*structInfo)
 var structMapMutex sync.RWMutex
 
 type externalPanic string
@@ -203,9 +292,10 @@ func (e externalPanic) String() string {
 	return string(e)
 }
 
-func getStructInfo(st reflect.Type) (*structInfo, error) {
+func getStructInfo(st reflect.Type, opts structOptions) (*structInfo, error) {
+	key := structKey{st, opts}
 	structMapMutex.RLock()
-	sinfo, found := structMap[st]
+	sinfo, found := structMap[key]
 	structMapMutex.RUnlock()
 	if found {
 		return sinfo, nil
@@ -222,16 +312,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 
 		info := fieldInfo{Num: i}
 
-		tag := field.Tag.Get("bson")
-
-		// If there's no bsonutils/json tag available.
-		if tag == "" {
-			// If there's no tag, and also no tag: value splits (i.e. no colon)
-			// then assume the entire tag is the value
-			if !strings.Contains(string(field.Tag), ":") {
-				tag = string(field.Tag)
-			}
-		}
+		tag, fallback := opts.tag(field)
 
 		if tag == "-" {
 			continue
@@ -249,6 +330,9 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 				case "inline":
 					inline = true
 				default:
+					if fallback {
+						continue
+					}
 					msg := fmt.Sprintf("Unsupported flag %q in tag %q of type %s", flag, tag, st)
 					panic(externalPanic(msg))
 				}
@@ -275,7 +359,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 				field.Type = field.Type.Elem()
 				fallthrough
 			case reflect.Struct:
-				sinfo, err := getStructInfo(field.Type)
+				sinfo, err := getStructInfo(field.Type, opts)
 				if err != nil {
 					return nil, err
 				}
@@ -301,7 +385,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		if tag != "" {
 			info.Key = tag
 		} else {
-			info.Key = strings.ToLower(field.Name)
+			info.Key = opts.naming.Key(field.Name)
 		}
 
 		if _, found = fieldsMap[info.Key]; found {
@@ -319,20 +403,7 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		reflect.New(st).Elem(),
 	}
 	structMapMutex.Lock()
-	structMap[st] = sinfo
+	structMap[key] = sinfo
 	structMapMutex.Unlock()
 	return sinfo, nil
 }
-
-// useOmitEmptyAsDefault defines if OmitEmpty should be used on all fields.
-var useOmitEmptyAsDefault = false
-
-// SetOmitEmptyAsDefault enable or disables tag omitempty for all fields.
-func SetOmitEmptyAsDefault(state bool) {
-	useOmitEmptyAsDefault = state
-}
-
-// IsOmitEmptyAsDefault check if omitempty is enable for all fields.
-func IsOmitEmptyAsDefault() bool {
-	return useOmitEmptyAsDefault
-}
@@ -0,0 +1,133 @@
+package bsonutils
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// EncodeFunc returns the value to be marshaled in place of v, as done
+// by GetBSON method of bson.Getter.
+type EncodeFunc func(v reflect.Value) (interface{}, error)
+
+// DecodeFunc sets out with the value on raw, as done by SetBSON method
+// of bson.Setter. Returning bson.ErrSetZero sets out to its zero value,
+// and a *bson.TypeError leaves it untouched.
+type DecodeFunc func(raw bson.Raw, out reflect.Value) error
+
+// Registry holds the functions marshaling and unmarshaling values of
+// types that can't implement bson.Getter and bson.Setter, like the ones
+// from other packages. It's safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	encoders map[reflect.Type]EncodeFunc
+	decoders map[reflect.Type]DecodeFunc
+	// The interfaces are checked in the order registered.
+	encoderIfaces []reflect.Type
+	decoderIfaces []reflect.Type
+}
+
+// DefaultRegistry it's the Registry used by Encoders and Decoders
+// without one, and by Marshal and Unmarshal functions.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		encoders: make(map[reflect.Type]EncodeFunc),
+		decoders: make(map[reflect.Type]DecodeFunc),
+	}
+}
+
+// RegisterEncoder sets f to marshal values of type t. If t it's an
+// interface, f marshals values of any type implementing it, without
+// an encoder of its own. A nil f removes the encoder of t.
+func (r *Registry) RegisterEncoder(t reflect.Type, f EncodeFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.encoders[t]; !found && f != nil && t.Kind() == reflect.Interface {
+		r.encoderIfaces = append(r.encoderIfaces, t)
+	}
+	if f == nil {
+		delete(r.encoders, t)
+		r.encoderIfaces = removeType(r.encoderIfaces, t)
+		return
+	}
+	r.encoders[t] = f
+}
+
+// RegisterDecoder sets f to unmarshal values into type t. If t it's an
+// interface, f unmarshals into any type implementing it, or whose
+// pointer implements it, without a decoder of its own. A nil f removes
+// the decoder of t.
+func (r *Registry) RegisterDecoder(t reflect.Type, f DecodeFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.decoders[t]; !found && f != nil && t.Kind() == reflect.Interface {
+		r.decoderIfaces = append(r.decoderIfaces, t)
+	}
+	if f == nil {
+		delete(r.decoders, t)
+		r.decoderIfaces = removeType(r.decoderIfaces, t)
+		return
+	}
+	r.decoders[t] = f
+}
+
+// encoder returns the EncodeFunc of values of type t, if any. Values
+// of interface types are checked by the type they hold.
+func (r *Registry) encoder(t reflect.Type) (f EncodeFunc, found bool) {
+	if t.Kind() == reflect.Interface {
+		return
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if f, found = r.encoders[t]; found {
+		return
+	}
+	for _, iface := range r.encoderIfaces {
+		if t.Implements(iface) {
+			return r.encoders[iface], true
+		}
+	}
+	return
+}
+
+// decoder returns the DecodeFunc of values of type t, if any.
+func (r *Registry) decoder(t reflect.Type) (f DecodeFunc, found bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if f, found = r.decoders[t]; found {
+		return
+	}
+	for _, iface := range r.decoderIfaces {
+		if t.Kind() != reflect.Interface && (t.Implements(iface) || reflect.PtrTo(t).Implements(iface)) {
+			return r.decoders[iface], true
+		}
+	}
+	return
+}
+
+// registryOrDefault returns r, or DefaultRegistry if it's nil.
+func registryOrDefault(r *Registry) *Registry {
+	if r == nil {
+		return DefaultRegistry
+	}
+	return r
+}
+
+// removeType returns types without t.
+func removeType(types []reflect.Type, t reflect.Type) []reflect.Type {
+	for i := range types {
+		if types[i] == t {
+			return append(types[:i:i], types[i+1:]...)
+		}
+	}
+	return types
+}
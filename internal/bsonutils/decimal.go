@@ -27,42 +27,598 @@
 package bsonutils
 
 import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"reflect"
 	"strconv"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// maxDigits it's the number of digits of Decimal128 coefficients.
+	maxDigits = 34
+	// minExp and maxExp are the limits of Decimal128 exponents.
+	minExp, maxExp = -6176, 6111
+	// expBias it's added to exponents when stored.
+	expBias = 6176
+)
+
+var (
+	// ErrInvalidDecimal it's an error received when parsing a string
+	// that isn't a decimal number.
+	ErrInvalidDecimal = errors.New("invalid decimal128 syntax")
+	// ErrDecimalRange it's an error received when a number it's too
+	// large to be held by a Decimal128.
+	ErrDecimalRange = errors.New("decimal128 value out of range")
+	// ErrDecimalNotFinite it's an error received when converting NaN
+	// or infinite Decimal128 values to types that can't hold them.
+	ErrDecimalNotFinite = errors.New("decimal128 value isn't finite")
+)
+
+// zeroBits it's the high bits of 0, flipped on Decimal128 so its zero
+// value it's 0 instead of 0E-6176.
+const zeroBits = uint64(expBias) << 49
+
+// RoundingMode defines how a Decimal128 it's rounded when digits must
+// be discarded.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to nearest, ties to the even digit. It's
+	// the default, also used by arithmetic.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to nearest, ties away from zero.
+	RoundHalfUp
+	// RoundDown rounds toward zero, truncating.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+	// RoundFloor rounds toward negative infinity.
+	RoundFloor
+	// RoundCeiling rounds toward positive infinity.
+	RoundCeiling
+)
+
+// form tells if a Decimal128 it's finite, infinite or NaN.
+type form uint8
+
+const (
+	finite form = iota
+	infinite
+	nan
 )
 
-// decimal128 holds decimal128 BSON values.
-type decimal128 struct {
+var (
+	big10     = big.NewInt(10)
+	decNaN    = decimalFromBits(0x1F<<58, 0)
+	decInf    = decimalFromBits(0x1E<<58, 0)
+	decNegInf = decimalFromBits(0x3E<<58, 0)
+)
+
+// Decimal128 holds decimal128 BSON values: a coefficient of up to 34
+// decimal digits, scaled by a power of 10. It's meant for values like
+// money, that must be exact on base 10. Its zero value it's 0.
+//
+// Decimal128 values are immutable, arithmetic methods return new ones.
+type Decimal128 struct {
+	// h holds the high bits, with the ones of zeroBits flipped.
 	h, l uint64
 }
 
-func (d decimal128) String() string {
+// ParseDecimal128 returns the Decimal128 of s, a decimal number like
+// "-12.50" or "1.5E+3", also accepting "NaN", "Inf" and "Infinity".
+// Numbers with more than 34 digits are rounded half to even.
+func ParseDecimal128(s string) (Decimal128, error) {
+	t, neg := s, false
+	if t != "" && (t[0] == '+' || t[0] == '-') {
+		t, neg = t[1:], t[0] == '-'
+	}
+
+	switch strings.ToLower(t) {
+	case "nan":
+		return decNaN, nil
+	case "inf", "infinity":
+		if neg {
+			return decNegInf, nil
+		}
+		return decInf, nil
+	}
+
+	mant, exp := t, 0
+	if i := strings.IndexAny(t, "eE"); i >= 0 {
+		var err error
+		if mant = t[:i]; mant == "" {
+			return Decimal128{}, ErrInvalidDecimal
+		}
+		if exp, err = strconv.Atoi(t[i+1:]); err != nil {
+			return Decimal128{}, ErrInvalidDecimal
+		}
+	}
+
+	frac := ""
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		mant, frac = mant[:i], mant[i+1:]
+	}
+
+	coef, ok := new(big.Int).SetString(mant+frac, 10)
+	if !ok || strings.ContainsAny(mant+frac, "+-_") {
+		return Decimal128{}, ErrInvalidDecimal
+	}
+
+	return checkRange(newDecimal(neg, coef, exp-len(frac), RoundHalfEven))
+}
+
+// NewDecimal128 returns the Decimal128 of coef×10^exp. Coefficients
+// with more than 34 digits are rounded half to even.
+func NewDecimal128(coef *big.Int, exp int) (Decimal128, error) {
+	return checkRange(newDecimal(coef.Sign() < 0, new(big.Int).Abs(coef), exp, RoundHalfEven))
+}
+
+// Decimal128FromBigFloat returns the Decimal128 with the shortest
+// decimal representation of f, rounded to 34 digits if needed.
+func Decimal128FromBigFloat(f *big.Float) (Decimal128, error) {
+	if f.IsInf() {
+		if f.Signbit() {
+			return decNegInf, nil
+		}
+		return decInf, nil
+	}
+	return ParseDecimal128(f.Text('g', -1))
+}
+
+// checkRange returns d, or ErrDecimalRange if it's infinite.
+func checkRange(d Decimal128) (Decimal128, error) {
+	if d.IsInf(0) {
+		return Decimal128{}, ErrDecimalRange
+	}
+	return d, nil
+}
+
+// BigInt returns the coefficient and exponent of d, so it's equal to
+// coef×10^exp. It returns ErrDecimalNotFinite if d it's NaN or Inf.
+func (d Decimal128) BigInt() (coef *big.Int, exp int, err error) {
+	neg, coef, exp, f := d.parts()
+	if f != finite {
+		return nil, 0, ErrDecimalNotFinite
+	}
+	if neg {
+		coef.Neg(coef)
+	}
+	return coef, exp, nil
+}
+
+// BigFloat returns the big.Float nearest to d, with 113 bits of
+// precision. It returns ErrDecimalNotFinite if d it's NaN.
+func (d Decimal128) BigFloat() (*big.Float, error) {
+	switch neg, _, _, f := d.parts(); f {
+	case nan:
+		return nil, ErrDecimalNotFinite
+	case infinite:
+		return new(big.Float).SetInf(neg), nil
+	}
+	f, _, err := big.ParseFloat(d.String(), 10, 113, big.ToNearestEven)
+	return f, err
+}
+
+// IsNaN reports whether d it's NaN.
+func (d Decimal128) IsNaN() bool {
+	_, _, _, f := d.parts()
+	return f == nan
+}
+
+// IsInf reports whether d it's an infinity, according to sign: positive
+// if sign > 0, negative if sign < 0, and either if sign == 0.
+func (d Decimal128) IsInf(sign int) bool {
+	neg, _, _, f := d.parts()
+	return f == infinite && (sign == 0 || sign > 0 && !neg || sign < 0 && neg)
+}
+
+// Sign returns -1 if d < 0, 0 if d it's 0 or NaN, and 1 if d > 0.
+func (d Decimal128) Sign() int {
+	neg, coef, _, f := d.parts()
+	switch {
+	case f == nan || f == finite && coef.Sign() == 0:
+		return 0
+	case neg:
+		return -1
+	}
+	return 1
+}
+
+// Cmp compares d and e, returning -1 if d < e, 0 if d == e and 1 if
+// d > e. Values with different exponents, like 1.0 and 1.00, are equal.
+// NaN it's equal to itself and less than any other value, so Cmp can
+// sort any Decimal128.
+func (d Decimal128) Cmp(e Decimal128) int {
+	if d.IsNaN() || e.IsNaN() {
+		return boolInt(e.IsNaN()) - boolInt(d.IsNaN())
+	}
+
+	ds, es := d.Sign(), e.Sign()
+	if ds != es {
+		return compareInts(ds, es)
+	}
+
+	dneg, dc, dexp, df := d.parts()
+	_, ec, eexp, ef := e.parts()
+	var r int
+	switch {
+	case df == infinite || ef == infinite:
+		r = int(df) - int(ef)
+	default:
+		dc, ec = align(dc, dexp, ec, eexp)
+		r = dc.Cmp(ec)
+	}
+
+	if dneg {
+		r = -r
+	}
+	return r
+}
+
+// Neg returns -d.
+func (d Decimal128) Neg() Decimal128 {
+	return Decimal128{d.h ^ 1<<63, d.l}
+}
+
+// Abs returns |d|.
+func (d Decimal128) Abs() Decimal128 {
+	return Decimal128{d.h &^ (1 << 63), d.l}
+}
+
+// Add returns d + e, rounded half to even to 34 digits.
+func (d Decimal128) Add(e Decimal128) Decimal128 {
+	dneg, dc, dexp, df := d.parts()
+	eneg, ec, eexp, ef := e.parts()
+
+	switch {
+	case df == nan || ef == nan:
+		return decNaN
+	case df == infinite && ef == infinite && dneg != eneg:
+		return decNaN
+	case df == infinite:
+		return d
+	case ef == infinite:
+		return e
+	}
+
+	exp := dexp
+	if eexp < exp {
+		exp = eexp
+	}
+	dc, ec = align(dc, dexp, ec, eexp)
+	if dneg {
+		dc.Neg(dc)
+	}
+	if eneg {
+		ec.Neg(ec)
+	}
+
+	sum := dc.Add(dc, ec)
+	return newDecimal(sum.Sign() < 0, sum.Abs(sum), exp, RoundHalfEven)
+}
+
+// Sub returns d - e, rounded half to even to 34 digits.
+func (d Decimal128) Sub(e Decimal128) Decimal128 {
+	return d.Add(e.Neg())
+}
+
+// Mul returns d × e, rounded half to even to 34 digits.
+func (d Decimal128) Mul(e Decimal128) Decimal128 {
+	dneg, dc, dexp, df := d.parts()
+	eneg, ec, eexp, ef := e.parts()
+	neg := dneg != eneg
+
+	switch {
+	case df == nan || ef == nan:
+		return decNaN
+	case df == infinite || ef == infinite:
+		if df == finite && dc.Sign() == 0 || ef == finite && ec.Sign() == 0 {
+			return decNaN
+		}
+		return infinity(neg)
+	}
+
+	return newDecimal(neg, dc.Mul(dc, ec), dexp+eexp, RoundHalfEven)
+}
+
+// Quo returns d / e, rounded half to even to 34 digits. Dividing by 0
+// returns an infinity, or NaN if d it's also 0.
+func (d Decimal128) Quo(e Decimal128) Decimal128 {
+	dneg, dc, dexp, df := d.parts()
+	eneg, ec, eexp, ef := e.parts()
+	neg := dneg != eneg
+
+	switch {
+	case df == nan || ef == nan || df == infinite && ef == infinite:
+		return decNaN
+	case df == infinite:
+		return infinity(neg)
+	case ef == infinite:
+		return newDecimal(neg, new(big.Int), 0, RoundHalfEven)
+	case ec.Sign() == 0:
+		if dc.Sign() == 0 {
+			return decNaN
+		}
+		return infinity(neg)
+	}
+
+	// Scales the dividend so the quotient has more than 34 digits,
+	// then appends a digit telling if it was exact, so the rounding
+	// of ties it's right.
+	exp := dexp - eexp
+	shift := maxDigits + 1 + digits(ec) - digits(dc)
+	if shift > 0 {
+		dc.Mul(dc, pow10(shift))
+		exp -= shift
+	}
+
+	q, r := dc.QuoRem(dc, ec, new(big.Int))
+	if q.Sign() == 0 {
+		exp = dexp - eexp
+	} else if r.Sign() == 0 {
+		// Exact quotients keep the exponent nearest to dexp-eexp.
+		for exp < dexp-eexp && new(big.Int).Rem(q, big10).Sign() == 0 {
+			q.Quo(q, big10)
+			exp++
+		}
+	} else {
+		q.Mul(q, big10).Add(q, big.NewInt(1))
+		exp--
+	}
+	return newDecimal(neg, q, exp, RoundHalfEven)
+}
+
+// Round returns d rounded with mode to places digits after the
+// decimal point. Negative places round to tens, hundreds and so on.
+// Values with fewer digits are returned as they are.
+func (d Decimal128) Round(places int, mode RoundingMode) Decimal128 {
+	neg, coef, exp, f := d.parts()
+	if f != finite || exp >= -places {
+		return d
+	}
+	return newDecimal(neg, roundDigits(neg, coef, -places-exp, mode), -places, mode)
+}
+
+// GetBSON returns d as BSON decimal128 value, so it's stored by mgo
+// and bsonutils.
+func (d Decimal128) GetBSON() (interface{}, error) {
+	h, l := d.bits()
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data, l)
+	binary.LittleEndian.PutUint64(data[8:], h)
+	return bson.Raw{Kind: bson.ElementDecimal128, Data: data}, nil
+}
+
+// SetBSON sets d with a BSON decimal128 value. Doubles, strings and
+// integers are also converted, so values stored with other types can
+// be read.
+func (d *Decimal128) SetBSON(raw bson.Raw) (err error) {
+	var v interface{}
+
+	switch raw.Kind {
+	case bson.ElementDecimal128:
+		if len(raw.Data) != 16 {
+			return errors.New("Document is corrupted")
+		}
+		*d = decimalFromBits(binary.LittleEndian.Uint64(raw.Data[8:]), binary.LittleEndian.Uint64(raw.Data))
+		return nil
+	case bson.ElementNil:
+		return bson.ErrSetZero
+	case bson.ElementFloat64, bson.ElementString, bson.ElementInt32, bson.ElementInt64:
+		if err = raw.Unmarshal(&v); err != nil {
+			return err
+		}
+	default:
+		return &bson.TypeError{Type: reflect.TypeOf(d).Elem(), Kind: raw.Kind}
+	}
+
+	switch v := v.(type) {
+	case float64:
+		*d, err = ParseDecimal128(strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		*d, err = ParseDecimal128(v)
+	case int:
+		*d = newDecimal(v < 0, new(big.Int).Abs(big.NewInt(int64(v))), 0, RoundHalfEven)
+	case int64:
+		*d = newDecimal(v < 0, new(big.Int).Abs(big.NewInt(v)), 0, RoundHalfEven)
+	}
+	return err
+}
+
+// decimalFromBits returns the Decimal128 stored as h and l bits.
+func decimalFromBits(h, l uint64) Decimal128 {
+	return Decimal128{h ^ zeroBits, l}
+}
+
+// bits returns the bits of d, as stored.
+func (d Decimal128) bits() (h, l uint64) {
+	return d.h ^ zeroBits, d.l
+}
+
+// parts returns the sign, coefficient and exponent of d, with its form.
+// The coefficient and exponent are only set on finite values.
+func (d Decimal128) parts() (neg bool, coef *big.Int, exp int, f form) {
+	h, l := d.bits()
+	neg = h>>63 == 1
+
+	switch h >> 58 & 0x1F {
+	case 0x1F:
+		return neg, nil, 0, nan
+	case 0x1E:
+		return neg, nil, 0, infinite
+	}
+
+	coef = new(big.Int)
+	if h>>61&3 == 3 {
+		// Spec says all coefficients of this form are out of range,
+		// being read as 0.
+		return neg, coef, int(h>>47&(1<<14-1)) - expBias, finite
+	}
+
+	coef.SetUint64(h&(1<<49-1)).Lsh(coef, 64).Or(coef, new(big.Int).SetUint64(l))
+	return neg, coef, int(h>>49&(1<<14-1)) - expBias, finite
+}
+
+// newDecimal returns the Decimal128 of the positive coef×10^exp, with
+// sign neg, rounded with mode to 34 digits. It returns an infinity if
+// it's too large.
+func newDecimal(neg bool, coef *big.Int, exp int, mode RoundingMode) Decimal128 {
+	if n := digits(coef) - maxDigits; n > 0 {
+		coef = roundDigits(neg, coef, n, mode)
+		exp += n
+	}
+	if n := minExp - exp; n > 0 {
+		coef = roundDigits(neg, coef, n, mode)
+		exp = minExp
+	}
+	if digits(coef) > maxDigits {
+		// Rounding carried to 10^34.
+		coef.Quo(coef, big10)
+		exp++
+	}
+
+	// Large exponents are lowered padding the coefficient.
+	for exp > maxExp && coef.Sign() != 0 && digits(coef) < maxDigits {
+		coef.Mul(coef, big10)
+		exp--
+	}
+	if exp > maxExp {
+		if coef.Sign() != 0 {
+			return infinity(neg)
+		}
+		exp = maxExp
+	}
+
+	var hi, lo big.Int
+	hi.Rsh(coef, 64)
+	lo.And(coef, new(big.Int).SetUint64(1<<64-1))
+
+	h := uint64(exp+expBias)<<49 | hi.Uint64()
+	if neg {
+		h |= 1 << 63
+	}
+	return decimalFromBits(h, lo.Uint64())
+}
+
+// roundDigits returns the positive coef, with sign neg, without its n
+// last digits, rounded with mode.
+func roundDigits(neg bool, coef *big.Int, n int, mode RoundingMode) *big.Int {
+	// Discarding more digits than coef has, gives the same rounding.
+	if m := digits(coef) + 1; n > m {
+		n = m
+	}
+
+	div := pow10(n)
+	q, r := new(big.Int).QuoRem(coef, div, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	var up bool
+	switch half := r.Mul(r, big.NewInt(2)).Cmp(div); mode {
+	case RoundHalfEven:
+		up = half > 0 || half == 0 && q.Bit(0) == 1
+	case RoundHalfUp:
+		up = half >= 0
+	case RoundUp:
+		up = true
+	case RoundFloor:
+		up = neg
+	case RoundCeiling:
+		up = !neg
+	}
+
+	if up {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// align returns the coefficients of x×10^xexp and y×10^yexp, scaled to
+// the smallest exponent. The received ones are changed.
+func align(x *big.Int, xexp int, y *big.Int, yexp int) (*big.Int, *big.Int) {
+	switch {
+	case xexp > yexp:
+		x.Mul(x, pow10(xexp-yexp))
+	case yexp > xexp:
+		y.Mul(y, pow10(yexp-xexp))
+	}
+	return x, y
+}
+
+// infinity returns the Decimal128 infinity with sign neg.
+func infinity(neg bool) Decimal128 {
+	if neg {
+		return decNegInf
+	}
+	return decInf
+}
+
+// digits returns the number of decimal digits of positive x.
+func digits(x *big.Int) int {
+	return len(x.Text(10))
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big10, big.NewInt(int64(n)), nil)
+}
+
+// boolInt returns 1 if b, or 0.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compareInts returns -1, 0 or 1 as a it's less, equal or greater
+// than b.
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// String returns d in scientific notation, like the mongo shell.
+func (d Decimal128) String() string {
+	dh, dl := d.bits()
+
 	var pos int     // positive sign
 	var e int       // exponent
 	var h, l uint64 // significand high/low
 
-	if d.h>>63&1 == 0 {
+	if dh>>63&1 == 0 {
 		pos = 1
 	}
 
-	switch d.h >> 58 & (1<<5 - 1) {
+	switch dh >> 58 & (1<<5 - 1) {
 	case 0x1F:
 		return "NaN"
 	case 0x1E:
 		return "-Inf"[pos:]
 	}
 
-	l = d.l
-	if d.h>>61&3 == 3 {
+	l = dl
+	if dh>>61&3 == 3 {
 		// Bits: 1*sign 2*ignored 14*exponent 111*significand.
 		// Implicit 0b100 prefix in significand.
-		e = int(d.h>>47&(1<<14-1)) - 6176
-		//h = 4<<47 | d.h&(1<<47-1)
+		e = int(dh>>47&(1<<14-1)) - 6176
+		//h = 4<<47 | dh&(1<<47-1)
 		// Spec says all of these values are out of range.
 		h, l = 0, 0
 	} else {
 		// Bits: 1*sign 14*exponent 113*significand
-		e = int(d.h>>49&(1<<14-1)) - 6176
-		h = d.h & (1<<49 - 1)
+		e = int(dh>>49&(1<<14-1)) - 6176
+		h = dh & (1<<49 - 1)
 	}
 
 	// Would be handled by the logic below, but that's trivial and common.
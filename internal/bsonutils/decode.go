@@ -43,12 +43,13 @@ type decoder struct {
 	in      []byte
 	i       int
 	docType reflect.Type
+	opts    Decoder
 }
 
 var typeM = reflect.TypeOf(bson.M{})
 
 func newDecoder(in []byte) *decoder {
-	return &decoder{in, 0, typeM}
+	return &decoder{in: in, docType: typeM}
 }
 
 // --------------------------------------------------------------------------
@@ -189,7 +190,7 @@ func (d *decoder) readDocTo(out reflect.Value) {
 			clearMap(out)
 		}
 	case reflect.Struct:
-		sinfo, err := getStructInfo(out.Type())
+		sinfo, err := getStructInfo(out.Type(), d.opts.layout())
 		if err != nil {
 			panic(err)
 		}
@@ -291,6 +292,8 @@ func (d *decoder) readDocTo(out reflect.Value) {
 				if d.readElemTo(e, kind) {
 					inlineMap.SetMapIndex(reflect.ValueOf(name), e)
 				}
+			} else if d.opts.Strict {
+				panic(fmt.Sprintf("Unknown key %q for struct %s", name, outt))
 			} else {
 				d.dropElem(kind)
 			}
@@ -530,6 +533,21 @@ func (d *decoder) readElemTo(out reflect.Value, kind byte) (good bool) {
 		return true
 	}
 
+	if decode, found := registryOrDefault(d.opts.Registry).decoder(outt); found {
+		err := decode(d.readRaw(kind), out)
+		if err == bson.ErrSetZero {
+			out.Set(reflect.Zero(outt))
+			return true
+		}
+		if err == nil {
+			return true
+		}
+		if _, ok := err.(*bson.TypeError); !ok {
+			panic(err)
+		}
+		return false
+	}
+
 	if kind == bson.ElementDocument {
 		// Delegate unmarshaling of documents.
 		outt := out.Type()
@@ -653,10 +671,8 @@ func (d *decoder) readElemTo(out reflect.Value, kind byte) (good bool) {
 			in = d.readInt64()
 		}
 	case bson.ElementDecimal128:
-		in = decimal128{
-			l: uint64(d.readInt64()),
-			h: uint64(d.readInt64()),
-		}
+		l := uint64(d.readInt64())
+		in = decimalFromBits(uint64(d.readInt64()), l)
 	case bson.ElementMaxKey:
 		in = bson.MaxKey
 	case bson.ElementMinKey:
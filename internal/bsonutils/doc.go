@@ -6,8 +6,32 @@
 Package bsonutils reimplement BSON Marshal and Unmarshal from mgo package.
 
 I've created this package to implement my needed version of Marshal and
-Unmarshal functions: one that allows to set OmitEmpty tag as default.
+Unmarshal functions: one that allows to set OmitEmpty tag as default,
+through the options of an Encoder, given on each call.
 Since it's code exclusive for use on this package, it was put as a
 internal package.
+
+Encoder and Decoder can also read keys from other tags, like json, name
+fields without tags in snake or camel case, and choose what happens on
+conflicts of inline maps. A strict Decoder fails on unknown fields,
+instead of discarding them.
+
+Types that can't implement bson.Getter and bson.Setter, like the ones
+from other packages, can have functions marshaling and unmarshaling
+them on a Registry, by type or by interface implemented.
+
+Decimal128 holds BSON decimal128 values, with arithmetic, rounding and
+conversions to math/big types. It's also stored by mgo, through
+bson.Getter and bson.Setter.
+
+MarshalExtJSON and UnmarshalExtJSON convert values from and to MongoDB
+Extended JSON v2, on canonical or relaxed mode.
+
+RawDocument validates a BSON buffer and reads its fields by dotted
+paths, or iterating its elements, without decoding it. Its values can
+be decoded later, straight into structs.
+
+Reader and Writer stream documents prefixed by their length, like the
+.bson files of mongodump, with size limits and corruption detection.
 */
 package bsonutils
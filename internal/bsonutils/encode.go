@@ -59,6 +59,8 @@ var (
 	typeString         = reflect.TypeOf("")
 	typeJSONNumber     = reflect.TypeOf(json.Number(""))
 	typeTimeDuration   = reflect.TypeOf(time.Duration(0))
+	typeDecimal128     = reflect.TypeOf(Decimal128{})
+	typeUndefined      = reflect.TypeOf(bson.Undefined)
 )
 
 var (
@@ -153,7 +155,8 @@ func getGetter(outt reflect.Type, out reflect.Value) bson.Getter {
 // Marshaling of the document value itself.
 
 type encoder struct {
-	out []byte
+	out  []byte
+	opts Encoder
 }
 
 func (e *encoder) addDoc(v reflect.Value) {
@@ -209,24 +212,36 @@ func (e *encoder) addMap(v reflect.Value) {
 }
 
 func (e *encoder) addStruct(v reflect.Value) {
-	sinfo, err := getStructInfo(v.Type())
+	sinfo, err := getStructInfo(v.Type(), e.opts.layout())
 	if err != nil {
 		panic(err)
 	}
 	var value reflect.Value
+	var inlined reflect.Value
 	if sinfo.InlineMap >= 0 {
 		m := v.Field(sinfo.InlineMap)
 		if m.Len() > 0 {
+			inlined = m
 			for _, k := range m.MapKeys() {
 				ks := k.String()
 				if _, found := sinfo.FieldsMap[ks]; found {
-					panic(fmt.Sprintf("Can't have key %q in inlined map; conflicts with struct field", ks))
+					switch e.opts.InlineConflict {
+					case InlineConflictFieldWins:
+						continue
+					case InlineConflictError:
+						panic(fmt.Sprintf("Can't have key %q in inlined map; conflicts with struct field", ks))
+					}
 				}
 				e.addElem(ks, m.MapIndex(k), false)
 			}
 		}
 	}
 	for _, info := range sinfo.FieldsList {
+		if inlined.IsValid() && e.opts.InlineConflict == InlineConflictMapWins {
+			if inlined.MapIndex(reflect.ValueOf(info.Key).Convert(inlined.Type().Key())).IsValid() {
+				continue
+			}
+		}
 		if info.Inline == nil {
 			value = v.Field(info.Num)
 		} else {
@@ -243,7 +258,7 @@ func (e *encoder) addStruct(v reflect.Value) {
 
 			value = field
 		}
-		if (info.OmitEmpty || IsOmitEmptyAsDefault()) && isZero(value) {
+		if (info.OmitEmpty || e.opts.OmitEmptyDefault) && e.isZero(value) {
 			continue
 		}
 		e.addElem(info.Key, value, info.MinSize)
@@ -266,6 +281,18 @@ func safeFieldByIndex(v reflect.Value, index []int) (result reflect.Value, err e
 	return
 }
 
+// isZero returns if v it's empty, as done by isZero function. Structs
+// with an encoder registered are empty only if equal to their zero
+// value, since all their fields may be private.
+func (e *encoder) isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Struct {
+		if _, found := registryOrDefault(e.opts.Registry).encoder(v.Type()); found {
+			return v.IsZero()
+		}
+	}
+	return isZero(v)
+}
+
 func isZero(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.String:
@@ -289,6 +316,9 @@ func isZero(v reflect.Value) bool {
 		if vt == typeTime {
 			return v.Interface().(time.Time).IsZero()
 		}
+		if vt == typeDecimal128 {
+			return v.IsZero()
+		}
 		for i := 0; i < v.NumField(); i++ {
 			if vt.Field(i).PkgPath != "" && !vt.Field(i).Anonymous {
 				continue // Private field
@@ -353,6 +383,15 @@ func (e *encoder) addElem(name string, v reflect.Value, minSize bool) {
 		return
 	}
 
+	if encode, found := registryOrDefault(e.opts.Registry).encoder(v.Type()); found {
+		getv, err := encode(v)
+		if err != nil {
+			panic(err)
+		}
+		e.addElem(name, reflect.ValueOf(getv), minSize)
+		return
+	}
+
 	if getter := getGetter(v.Type(), v); getter != nil {
 		getv, err := getter.GetBSON()
 		if err != nil {
@@ -518,11 +557,6 @@ func (e *encoder) addElem(name string, v reflect.Value, minSize bool) {
 			e.addElemName(0x05, name)
 			e.addBinary(s.Kind, s.Data)
 
-		case decimal128:
-			e.addElemName(0x13, name)
-			e.addInt64(int64(s.l))
-			e.addInt64(int64(s.h))
-
 		case bson.DBPointer:
 			e.addElemName(0x0C, name)
 			e.addStr(s.Namespace)
@@ -560,10 +594,27 @@ func (e *encoder) addElem(name string, v reflect.Value, minSize bool) {
 			e.addElemName(0x02, name)
 			e.addStr(s.String())
 
+		case bson.Decimal128:
+			// The decimal128 of mgo, as read by its Unmarshal, has no
+			// exported bits, so it's converted by its string.
+			d, err := ParseDecimal128(s.String())
+			if err != nil {
+				panic(err)
+			}
+			h, l := d.bits()
+			e.addElemName(0x13, name)
+			e.addInt64(int64(l))
+			e.addInt64(int64(h))
+
 		case undefined:
 			e.addElemName(0x06, name)
 
 		default:
+			if v.Type() == typeUndefined {
+				// The undefined of mgo, as read by Unmarshal.
+				e.addElemName(0x06, name)
+				break
+			}
 			e.addElemName(0x03, name)
 			e.addDoc(v)
 		}
@@ -0,0 +1,644 @@
+package bsonutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// ExtJSONMode defines how MongoDB Extended JSON v2 represents numbers
+// and dates.
+type ExtJSONMode int
+
+const (
+	// Relaxed writes numbers as JSON numbers and dates as ISO-8601
+	// strings, when it doesn't lose information. It's the one meant
+	// for APIs.
+	Relaxed ExtJSONMode = iota
+	// Canonical writes every number and date with its BSON type,
+	// preserving them exactly.
+	Canonical
+)
+
+// ErrInvalidExtJSON it's an error received when unmarshaling JSON that
+// isn't valid MongoDB Extended JSON.
+var ErrInvalidExtJSON = errors.New("invalid extended JSON")
+
+// extJSONWrapper it's the key of the document wrapping values that
+// aren't documents.
+const extJSONWrapper = "v"
+
+// MarshalExtJSON returns in as MongoDB Extended JSON v2, on mode. The
+// in value can be anything Marshal accepts, or a slice of them,
+// written as a JSON array.
+func MarshalExtJSON(in interface{}, mode ExtJSONMode) ([]byte, error) {
+	return Encoder{}.MarshalExtJSON(in, mode)
+}
+
+// MarshalExtJSON returns in as MongoDB Extended JSON v2, as done by
+// MarshalExtJSON function, using the options of Encoder.
+func (enc Encoder) MarshalExtJSON(in interface{}, mode ExtJSONMode) (out []byte, err error) {
+	array := isArray(reflect.ValueOf(in))
+	if array {
+		in = bson.D{{Name: extJSONWrapper, Value: in}}
+	}
+
+	var doc []byte
+	if doc, err = enc.Marshal(in); err != nil {
+		return nil, err
+	}
+
+	defer handleErr(&err)
+	w := &extJSONWriter{mode: mode}
+	if array {
+		// Skips the length, kind and name of the wrapped array.
+		w.writeDoc(doc[4+1+len(extJSONWrapper)+1:], true)
+	} else {
+		w.writeDoc(doc, false)
+	}
+	return w.out.Bytes(), nil
+}
+
+// UnmarshalExtJSON reads MongoDB Extended JSON, canonical or relaxed,
+// from in into the out value, as done by Unmarshal. A JSON array can
+// be read into a pointer to slice.
+func UnmarshalExtJSON(in []byte, out interface{}) error {
+	return Decoder{}.UnmarshalExtJSON(in, out)
+}
+
+// UnmarshalExtJSON reads MongoDB Extended JSON into the out value, as
+// done by UnmarshalExtJSON function, using the options of Decoder.
+func (dec Decoder) UnmarshalExtJSON(in []byte, out interface{}) (err error) {
+	d := json.NewDecoder(bytes.NewReader(in))
+	d.UseNumber()
+
+	var v interface{}
+	if v, err = readExtJSON(d); err != nil {
+		return err
+	}
+	if _, err = d.Token(); err != io.EOF {
+		return ErrInvalidExtJSON
+	}
+
+	var doc []byte
+	switch v := v.(type) {
+	case bson.D:
+		if doc, err = Marshal(v); err == nil {
+			err = dec.Unmarshal(doc, out)
+		}
+	case []interface{}:
+		// Arrays are wrapped on a document, and read into a struct
+		// holding the type of out on its field.
+		rv := reflect.ValueOf(out)
+		if rv.Kind() != reflect.Ptr || !isArray(rv.Elem()) {
+			return errors.New("extended JSON array needs a pointer to slice")
+		}
+		if doc, err = Marshal(bson.D{{Name: extJSONWrapper, Value: v}}); err != nil {
+			return err
+		}
+		wrapper := reflect.New(reflect.StructOf([]reflect.StructField{{
+			Name: "V",
+			Type: rv.Elem().Type(),
+			Tag:  reflect.StructTag(`bson:"` + extJSONWrapper + `"`),
+		}}))
+		if err = dec.Unmarshal(doc, wrapper.Interface()); err == nil {
+			rv.Elem().Set(wrapper.Elem().Field(0))
+		}
+	default:
+		err = errors.New("extended JSON must be an object or an array")
+	}
+	return err
+}
+
+// isArray reports whether v it's a slice or array, other than bytes,
+// that's written as JSON array.
+func isArray(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8 && v.Type().Elem() != typeDocElem
+	}
+	return false
+}
+
+// --------------------------------------------------------------------------
+// Writing of Extended JSON from BSON documents.
+
+// extJSONWriter writes BSON documents as Extended JSON on out.
+type extJSONWriter struct {
+	out  bytes.Buffer
+	mode ExtJSONMode
+}
+
+// writeDoc writes the BSON document on doc as an object, or an array
+// if array.
+func (w *extJSONWriter) writeDoc(doc []byte, array bool) {
+	if len(doc) < 5 || int(binary.LittleEndian.Uint32(doc)) > len(doc) {
+		panic("Document is corrupted")
+	}
+	doc = doc[4:binary.LittleEndian.Uint32(doc)]
+
+	open, close := byte('{'), byte('}')
+	if array {
+		open, close = '[', ']'
+	}
+
+	w.out.WriteByte(open)
+	for i := 0; doc[0] != 0; i++ {
+		if i > 0 {
+			w.out.WriteByte(',')
+		}
+
+		kind := doc[0]
+		end := bytes.IndexByte(doc[1:], 0) + 1
+		if end <= 0 {
+			panic("Document is corrupted")
+		}
+		if !array {
+			w.writeString(string(doc[1:end]))
+			w.out.WriteByte(':')
+		}
+		n := w.writeElem(kind, doc[end+1:])
+		doc = doc[end+1+n:]
+	}
+	w.out.WriteByte(close)
+}
+
+// writeElem writes the BSON value of kind at start of data, returning
+// its length.
+func (w *extJSONWriter) writeElem(kind byte, data []byte) (n int) {
+	switch kind {
+	case 0x01:
+		w.writeDouble(math.Float64frombits(binary.LittleEndian.Uint64(data)))
+		return 8
+	case 0x02:
+		s, n := readString(data)
+		w.writeString(s)
+		return n
+	case 0x03, 0x04:
+		n = int(binary.LittleEndian.Uint32(data))
+		w.writeDoc(data[:n], kind == 0x04)
+		return n
+	case 0x05:
+		n = int(binary.LittleEndian.Uint32(data))
+		b := data[5 : 5+n]
+		if data[4] == 0x02 && n >= 4 {
+			// Old binary subtype holds its length again.
+			b = b[4:]
+		}
+		w.writeWrapper("$binary", func() {
+			w.out.WriteString(`{"base64":`)
+			w.writeString(base64.StdEncoding.EncodeToString(b))
+			w.out.WriteString(`,"subType":`)
+			w.writeString(fmt.Sprintf("%02x", data[4]))
+			w.out.WriteByte('}')
+		})
+		return 5 + n
+	case 0x06:
+		w.out.WriteString(`{"$undefined":true}`)
+		return 0
+	case 0x07:
+		w.writeWrapper("$oid", func() { w.writeString(hex.EncodeToString(data[:12])) })
+		return 12
+	case 0x08:
+		w.out.WriteString(strconv.FormatBool(data[0] == 1))
+		return 1
+	case 0x09:
+		w.writeDate(int64(binary.LittleEndian.Uint64(data)))
+		return 8
+	case 0x0A:
+		w.out.WriteString("null")
+		return 0
+	case 0x0B:
+		pattern, np := readCString(data)
+		options, no := readCString(data[np:])
+		w.writeWrapper("$regularExpression", func() {
+			w.out.WriteString(`{"pattern":`)
+			w.writeString(pattern)
+			w.out.WriteString(`,"options":`)
+			w.writeString(options)
+			w.out.WriteByte('}')
+		})
+		return np + no
+	case 0x0C:
+		ns, n := readString(data)
+		w.writeWrapper("$dbPointer", func() {
+			w.out.WriteString(`{"$ref":`)
+			w.writeString(ns)
+			w.out.WriteString(`,"$id":`)
+			w.writeElem(0x07, data[n:])
+			w.out.WriteByte('}')
+		})
+		return n + 12
+	case 0x0D:
+		code, n := readString(data)
+		w.writeWrapper("$code", func() { w.writeString(code) })
+		return n
+	case 0x0E:
+		symbol, n := readString(data)
+		w.writeWrapper("$symbol", func() { w.writeString(symbol) })
+		return n
+	case 0x0F:
+		n = int(binary.LittleEndian.Uint32(data))
+		code, nc := readString(data[4:])
+		w.out.WriteString(`{"$code":`)
+		w.writeString(code)
+		w.out.WriteString(`,"$scope":`)
+		w.writeDoc(data[4+nc:n], false)
+		w.out.WriteByte('}')
+		return n
+	case 0x10:
+		i := strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data))), 10)
+		w.writeNumber("$numberInt", i)
+		return 4
+	case 0x11:
+		w.out.WriteString(`{"$timestamp":{"t":`)
+		w.out.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data[4:])), 10))
+		w.out.WriteString(`,"i":`)
+		w.out.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10))
+		w.out.WriteString(`}}`)
+		return 8
+	case 0x12:
+		w.writeNumber("$numberLong", strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10))
+		return 8
+	case 0x13:
+		d := decimalFromBits(binary.LittleEndian.Uint64(data[8:]), binary.LittleEndian.Uint64(data))
+		w.writeWrapper("$numberDecimal", func() { w.writeString(d.String()) })
+		return 16
+	case 0x7F:
+		w.out.WriteString(`{"$maxKey":1}`)
+		return 0
+	case 0xFF:
+		w.out.WriteString(`{"$minKey":1}`)
+		return 0
+	}
+	panic(fmt.Sprintf("Unknown element kind (0x%02X)", kind))
+}
+
+// writeWrapper writes an object with key holding the value written by
+// f.
+func (w *extJSONWriter) writeWrapper(key string, f func()) {
+	w.out.WriteString(`{"` + key + `":`)
+	f()
+	w.out.WriteByte('}')
+}
+
+// writeNumber writes the integer n, wrapped on key if canonical.
+func (w *extJSONWriter) writeNumber(key, n string) {
+	if w.mode == Relaxed {
+		w.out.WriteString(n)
+		return
+	}
+	w.writeWrapper(key, func() { w.writeString(n) })
+}
+
+// writeDouble writes f, as a JSON number if relaxed and finite.
+func (w *extJSONWriter) writeDouble(f float64) {
+	var s string
+	switch {
+	case math.IsNaN(f):
+		s = "NaN"
+	case math.IsInf(f, 1):
+		s = "Infinity"
+	case math.IsInf(f, -1):
+		s = "-Infinity"
+	default:
+		s = strconv.FormatFloat(f, 'G', -1, 64)
+		if !strings.ContainsAny(s, ".E") {
+			// Keeps integral doubles read as doubles.
+			s += ".0"
+		}
+		if w.mode == Relaxed {
+			w.out.WriteString(s)
+			return
+		}
+	}
+	w.writeWrapper("$numberDouble", func() { w.writeString(s) })
+}
+
+// writeDate writes the datetime ms, in milliseconds since epoch, as an
+// ISO-8601 string if relaxed and between years 1970 and 9999.
+func (w *extJSONWriter) writeDate(ms int64) {
+	t := time.Unix(ms/1e3, ms%1e3*1e6).UTC()
+	w.writeWrapper("$date", func() {
+		if w.mode == Relaxed && ms >= 0 && t.Year() <= 9999 {
+			w.writeString(t.Format("2006-01-02T15:04:05.000Z07:00"))
+			return
+		}
+		// Dates out of range keep the canonical form.
+		w.writeWrapper("$numberLong", func() { w.writeString(strconv.FormatInt(ms, 10)) })
+	})
+}
+
+// writeString writes s as a JSON string.
+func (w *extJSONWriter) writeString(s string) {
+	b, _ := json.Marshal(s)
+	w.out.Write(b)
+}
+
+// readString returns the BSON string at start of data, with the length
+// read.
+func readString(data []byte) (string, int) {
+	n := int(binary.LittleEndian.Uint32(data))
+	if n < 1 || 4+n > len(data) {
+		panic("Document is corrupted")
+	}
+	return string(data[4 : 4+n-1]), 4 + n
+}
+
+// readCString returns the BSON cstring at start of data, with the
+// length read.
+func readCString(data []byte) (string, int) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		panic("Document is corrupted")
+	}
+	return string(data[:end]), end + 1
+}
+
+// --------------------------------------------------------------------------
+// Reading of Extended JSON into BSON values.
+
+// readExtJSON returns the next JSON value on d, with objects as bson.D
+// and Extended JSON wrappers as the values of their BSON types.
+func readExtJSON(d *json.Decoder) (v interface{}, err error) {
+	var t json.Token
+	if t, err = d.Token(); err != nil {
+		return nil, ErrInvalidExtJSON
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			var doc bson.D
+			for d.More() {
+				var key, value interface{}
+				if key, err = d.Token(); err != nil {
+					return nil, ErrInvalidExtJSON
+				}
+				if value, err = readExtJSON(d); err != nil {
+					return nil, err
+				}
+				doc = append(doc, bson.DocElem{Name: key.(string), Value: value})
+			}
+			if _, err = d.Token(); err != nil {
+				return nil, ErrInvalidExtJSON
+			}
+			return unwrapExtJSON(doc)
+		case '[':
+			array := []interface{}{}
+			for d.More() {
+				var value interface{}
+				if value, err = readExtJSON(d); err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+			if _, err = d.Token(); err != nil {
+				return nil, ErrInvalidExtJSON
+			}
+			return array, nil
+		}
+		return nil, ErrInvalidExtJSON
+	case json.Number:
+		return parseNumber(t)
+	}
+	return t, nil
+}
+
+// parseNumber returns the relaxed number n as int32 or int64 if it's
+// an integer fitting them, or float64.
+func parseNumber(n json.Number) (interface{}, error) {
+	if !strings.ContainsAny(string(n), ".eE") {
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			if i >= math.MinInt32 && i <= math.MaxInt32 {
+				return int32(i), nil
+			}
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, ErrInvalidExtJSON
+	}
+	return f, nil
+}
+
+// unwrapExtJSON returns the value of BSON type wrapped by doc, or doc
+// itself if it isn't a wrapper.
+func unwrapExtJSON(doc bson.D) (v interface{}, err error) {
+	if len(doc) == 0 || !strings.HasPrefix(doc[0].Name, "$") {
+		return doc, nil
+	}
+
+	m := doc.Map()
+	switch keys := extJSONKeys(doc); keys {
+	case "$oid":
+		if s, ok := m["$oid"].(string); ok && bson.IsObjectIdHex(s) {
+			return bson.ObjectIdHex(s), nil
+		}
+	case "$symbol":
+		if s, ok := m["$symbol"].(string); ok {
+			return bson.Symbol(s), nil
+		}
+	case "$numberInt":
+		if s, ok := m["$numberInt"].(string); ok {
+			if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+				return int32(i), nil
+			}
+		}
+	case "$numberLong":
+		if s, ok := m["$numberLong"].(string); ok {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case "$numberDouble":
+		if s, ok := m["$numberDouble"].(string); ok {
+			return parseDouble(s)
+		}
+	case "$numberDecimal":
+		if s, ok := m["$numberDecimal"].(string); ok {
+			return ParseDecimal128(s)
+		}
+	case "$binary":
+		if b, ok := m["$binary"].(bson.D); ok {
+			bm := b.Map()
+			return parseBinary(extJSONKeys(b) == "base64,subType", bm["base64"], bm["subType"])
+		}
+	case "$binary,$type":
+		// Legacy form, from Extended JSON v1.
+		return parseBinary(true, m["$binary"], m["$type"])
+	case "$uuid":
+		if s, ok := m["$uuid"].(string); ok {
+			if b, err := hex.DecodeString(strings.Replace(s, "-", "", -1)); err == nil && len(b) == 16 && len(s) == 36 {
+				return bson.Binary{Kind: 0x04, Data: b}, nil
+			}
+		}
+	case "$code":
+		if s, ok := m["$code"].(string); ok {
+			return bson.JavaScript{Code: s}, nil
+		}
+	case "$code,$scope":
+		s, ok := m["$code"].(string)
+		if scope, isDoc := m["$scope"].(bson.D); ok && isDoc {
+			return bson.JavaScript{Code: s, Scope: scope}, nil
+		}
+	case "$timestamp":
+		if ts, ok := m["$timestamp"].(bson.D); ok && extJSONKeys(ts) == "t,i" {
+			t, okT := uint32Value(ts.Map()["t"])
+			i, okI := uint32Value(ts.Map()["i"])
+			if okT && okI {
+				return bson.MongoTimestamp(int64(t)<<32 | int64(i)), nil
+			}
+		}
+	case "$regularExpression":
+		if re, ok := m["$regularExpression"].(bson.D); ok && extJSONKeys(re) == "pattern,options" {
+			pattern, okP := re.Map()["pattern"].(string)
+			options, okO := re.Map()["options"].(string)
+			if okP && okO {
+				return bson.RegEx{Pattern: pattern, Options: options}, nil
+			}
+		}
+	case "$regex,$options":
+		// Legacy form, from Extended JSON v1.
+		pattern, okP := m["$regex"].(string)
+		options, okO := m["$options"].(string)
+		if okP && okO {
+			return bson.RegEx{Pattern: pattern, Options: options}, nil
+		}
+	case "$dbPointer":
+		if p, ok := m["$dbPointer"].(bson.D); ok && extJSONKeys(p) == "$ref,$id" {
+			ns, okNs := p.Map()["$ref"].(string)
+			id, okID := p.Map()["$id"].(bson.ObjectId)
+			if okNs && okID {
+				return bson.DBPointer{Namespace: ns, Id: id}, nil
+			}
+		}
+	case "$date":
+		return parseDate(m["$date"])
+	case "$minKey":
+		if isOne(m["$minKey"]) {
+			return bson.MinKey, nil
+		}
+	case "$maxKey":
+		if isOne(m["$maxKey"]) {
+			return bson.MaxKey, nil
+		}
+	case "$undefined":
+		if m["$undefined"] == true {
+			return bson.Undefined, nil
+		}
+	default:
+		// Other keys starting with $, like the ones of DBRef and query
+		// operators, are plain documents.
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: bad value of %s", ErrInvalidExtJSON, doc[0].Name)
+}
+
+// extJSONKeys returns the keys of doc, sorted as expected for wrappers
+// with many keys.
+func extJSONKeys(doc bson.D) string {
+	names := make([]string, len(doc))
+	for i := range doc {
+		names[i] = doc[i].Name
+	}
+
+	// Keys of wrappers may come on any order.
+	switch s := strings.Join(names, ","); s {
+	case "subType,base64", "$type,$binary", "$scope,$code", "i,t",
+		"options,pattern", "$options,$regex", "$id,$ref":
+		return names[1] + "," + names[0]
+	default:
+		return s
+	}
+}
+
+// parseDouble returns the float64 of a $numberDouble string.
+func parseDouble(s string) (interface{}, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad value of $numberDouble", ErrInvalidExtJSON)
+	}
+	return f, nil
+}
+
+// parseBinary returns the bson.Binary of data in base64, with subtype
+// in hex.
+func parseBinary(ok bool, data, subtype interface{}) (interface{}, error) {
+	b64, okData := data.(string)
+	st, okType := subtype.(string)
+	if ok && okData && okType && len(st) <= 2 {
+		kind, errKind := strconv.ParseUint(st, 16, 8)
+		b, errData := base64.StdEncoding.DecodeString(b64)
+		if errKind == nil && errData == nil {
+			return bson.Binary{Kind: byte(kind), Data: b}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: bad value of $binary", ErrInvalidExtJSON)
+}
+
+// parseDate returns the time.Time of a $date value: an ISO-8601 string,
+// or milliseconds since epoch.
+func parseDate(v interface{}) (interface{}, error) {
+	var ms int64
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad value of $date", ErrInvalidExtJSON)
+		}
+		return t, nil
+	case int32:
+		ms = int64(v)
+	case int64:
+		ms = v
+	default:
+		return nil, fmt.Errorf("%w: bad value of $date", ErrInvalidExtJSON)
+	}
+	return time.Unix(ms/1e3, ms%1e3*1e6), nil
+}
+
+// uint32Value returns v as uint32, if it's an integer in range.
+func uint32Value(v interface{}) (uint32, bool) {
+	var i int64
+	switch v := v.(type) {
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	default:
+		return 0, false
+	}
+	return uint32(i), i >= 0 && i <= math.MaxUint32
+}
+
+// isOne reports whether v it's the integer 1.
+func isOne(v interface{}) bool {
+	i, ok := v.(int32)
+	return ok && i == 1
+}
@@ -0,0 +1,139 @@
+package bsonutils
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy defines the key of struct fields without tags, from
+// their names.
+type NamingStrategy int
+
+const (
+	// LowerCase uses the field name in lower case, like httpserver for
+	// HTTPServer. It's the default.
+	LowerCase NamingStrategy = iota
+	// SnakeCase uses the field name in snake case, like http_server for
+	// HTTPServer.
+	SnakeCase
+	// CamelCase uses the field name in camel case, like httpServer for
+	// HTTPServer.
+	CamelCase
+)
+
+// InlineConflict defines what Encoder does with keys of an inline map
+// that are also keys of struct fields.
+type InlineConflict int
+
+const (
+	// InlineConflictError fails the marshaling. It's the default.
+	InlineConflictError InlineConflict = iota
+	// InlineConflictFieldWins marshals the struct field, ignoring the
+	// key of inline map.
+	InlineConflictFieldWins
+	// InlineConflictMapWins marshals the key of inline map, ignoring
+	// the struct field.
+	InlineConflictMapWins
+)
+
+// structOptions are the options defining the keys of struct fields.
+// Each combination has its own structInfo cached.
+type structOptions struct {
+	tagName     string
+	fallbackTag string
+	naming      NamingStrategy
+}
+
+// tag returns the tag of field to be used, and if it's from the
+// fallback tag.
+func (o structOptions) tag(field reflect.StructField) (tag string, fallback bool) {
+	name := o.tagName
+	if name == "" {
+		name = "bson"
+	}
+
+	if tag = field.Tag.Get(name); tag != "" {
+		return tag, false
+	}
+
+	if o.fallbackTag != "" {
+		if tag = field.Tag.Get(o.fallbackTag); tag != "" {
+			return tag, true
+		}
+	}
+
+	// If there's no tag, and also no tag: value splits (i.e. no colon)
+	// then assume the entire tag is the value
+	if name == "bson" && !strings.Contains(string(field.Tag), ":") {
+		tag = string(field.Tag)
+	}
+	return tag, false
+}
+
+// Key returns the key of a field named name, without tags, like
+// http_log for HTTPLog with SnakeCase. Acronyms are kept together.
+func (n NamingStrategy) Key(name string) string {
+	switch n {
+	case SnakeCase:
+		return snakeCase(name)
+	case CamelCase:
+		return camelCase(name)
+	}
+	return strings.ToLower(name)
+}
+
+// fieldKey returns the key of struct field, and if it's inline. Fields
+// skipped have key "-".
+func (o structOptions) fieldKey(field reflect.StructField) (key string, inline bool) {
+	tag, _ := o.tag(field)
+	if tag == "-" {
+		return tag, false
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, flag := range parts[1:] {
+		inline = inline || flag == "inline"
+	}
+
+	if key = parts[0]; key == "" {
+		key = o.naming.Key(field.Name)
+	}
+	return key, inline
+}
+
+// snakeCase returns name in snake case, keeping acronyms together,
+// like http_log for HTTPLog.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Starts a word after a lower letter, or on the last upper
+			// letter of an acronym.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// camelCase returns name in camel case, turning lower the leading
+// acronym, like httpLog for HTTPLog and id for ID.
+func camelCase(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		// Keeps upper the first letter of the next word.
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
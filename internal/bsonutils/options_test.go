@@ -0,0 +1,214 @@
+// +build !acceptance
+
+package bsonutils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo/bson"
+)
+
+// account it's a type using json tags and fields without tags, to be
+// marshalled with Encoder and Decoder options.
+type account struct {
+	HTTPServer string
+	UserID     int
+	Email      string `json:"mail,omitempty"`
+	Extra      bson.M `bson:",inline"`
+}
+
+// profile it's a type with an id, to be decoded strictly.
+type profile struct {
+	ID   bson.ObjectId `bson:"_id"`
+	Name string        `bson:"name"`
+}
+
+// unmarshalToM unmarshals buf to a new bson.M.
+func unmarshalToM(buf []byte) (m bson.M, err error) {
+	m = bson.M{}
+	err = Unmarshal(buf, &m)
+	return
+}
+
+// Feature Configure keys of Encoder and Decoder
+// - As a developer,
+// - I want to choose the tags and naming strategy of struct fields,
+// - So that I could store types tagged for other formats.
+func Test_Configure_keys_of_Encoder_and_Decoder(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "an account a with json tags and fields without tags", func(when bdd.When, args ...interface{}) {
+		a := account{HTTPServer: "srv", UserID: 1, Email: "a@b.c"}
+
+		when("marshalled with the zero Encoder", func(it bdd.It) {
+			buf, errMarshal := Encoder{}.Marshal(a)
+			m, errM := unmarshalToM(buf)
+
+			it("should use lower case keys and ignore json tags", func(assert bdd.Assert) {
+				assert.NoError(errMarshal)
+				assert.NoError(errM)
+				assert.Equal(bson.M{"httpserver": "srv", "userid": 1, "email": "a@b.c"}, m)
+			})
+		})
+
+		when("marshalled with json as fallback tag and snake case", func(it bdd.It) {
+			enc := Encoder{FallbackTagName: "json", Naming: SnakeCase}
+			buf, errMarshal := enc.Marshal(a)
+			m, errM := unmarshalToM(buf)
+
+			it("should use json tags and snake case keys", func(assert bdd.Assert) {
+				assert.NoError(errMarshal)
+				assert.NoError(errM)
+				assert.Equal(bson.M{"http_server": "srv", "user_id": 1, "mail": "a@b.c"}, m)
+			})
+
+			var b account
+			errDecode := Decoder{FallbackTagName: "json", Naming: SnakeCase}.Unmarshal(buf, &b)
+
+			it("should be read back by a Decoder with the same options", func(assert bdd.Assert) {
+				assert.NoError(errDecode)
+				assert.Equal(a.HTTPServer, b.HTTPServer)
+				assert.Equal(a.UserID, b.UserID)
+				assert.Equal(a.Email, b.Email)
+			})
+		})
+
+		when("marshalled with json as tag and camel case", func(it bdd.It) {
+			enc := Encoder{TagName: "json", Naming: CamelCase}
+			buf, errMarshal := enc.Marshal(struct {
+				HTTPServer string
+				ID         int
+				Email      string `json:"mail"`
+			}{"srv", 2, "a@b.c"})
+			m, errM := unmarshalToM(buf)
+
+			it("should use json tags and camel case keys", func(assert bdd.Assert) {
+				assert.NoError(errMarshal)
+				assert.NoError(errM)
+				assert.Equal(bson.M{"httpServer": "srv", "id": 2, "mail": "a@b.c"}, m)
+			})
+		})
+	})
+}
+
+// Feature Decode strictly with Decoder
+// - As a developer,
+// - I want to fail decoding documents with unknown fields,
+// - So that I could detect documents not matching my types.
+func Test_Decode_strictly_with_Decoder(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a document with a field unknown by profile", func(when bdd.When, args ...interface{}) {
+		buf, _ := Marshal(bson.M{"_id": bson.NewObjectId(), "unknown": 1})
+
+		when("decoded by the zero Decoder", func(it bdd.It) {
+			err := Decoder{}.Unmarshal(buf, &profile{})
+
+			it("should discard the field", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+		})
+
+		when("decoded by a strict Decoder", func(it bdd.It) {
+			err := Decoder{Strict: true}.Unmarshal(buf, &profile{})
+
+			it("should return an error naming the field", func(assert bdd.Assert) {
+				assert.Error(err)
+				assert.Contains(err.Error(), `"unknown"`)
+			})
+		})
+
+		when("decoded by a strict Decoder into a type with inline map", func(it bdd.It) {
+			var a account
+			err := Decoder{Strict: true}.Unmarshal(buf, &a)
+
+			it("should keep the field on the map", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(1, a.Extra["unknown"])
+			})
+		})
+	})
+}
+
+// Feature Resolve conflicts of inline maps with Encoder
+// - As a developer,
+// - I want to choose what happens when inline maps repeat field keys,
+// - So that I could marshal types carrying extra fields.
+func Test_Resolve_conflicts_of_inline_maps_with_Encoder(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "an account a with 'email' also on its inline map", func(when bdd.When, args ...interface{}) {
+		a := account{Email: "field", Extra: bson.M{"email": "map"}}
+
+		when("marshalled with the zero Encoder", func(it bdd.It) {
+			_, err := Encoder{}.Marshal(a)
+
+			it("should return an error", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+
+		when("marshalled with InlineConflictFieldWins", func(it bdd.It) {
+			buf, err := Encoder{InlineConflict: InlineConflictFieldWins}.Marshal(a)
+			m, _ := unmarshalToM(buf)
+
+			it("should keep the struct field", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("field", m["email"])
+			})
+		})
+
+		when("marshalled with InlineConflictMapWins", func(it bdd.It) {
+			buf, err := Encoder{InlineConflict: InlineConflictMapWins}.Marshal(a)
+			m, _ := unmarshalToM(buf)
+
+			it("should keep the key of map", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal("map", m["email"])
+				assert.Len(m, 3)
+			})
+		})
+	})
+}
+
+// Feature Tell keys of struct fields
+// - As a developer,
+// - I want to know the key of each field with Encoder and Decoder options,
+// - So that I could find fields on documents they marshal.
+func Test_Tell_keys_of_struct_fields(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "the field %[1]v of account", func(when bdd.When, args ...interface{}) {
+		field, _ := reflect.TypeOf(account{}).FieldByName(args[0].(string))
+
+		when("FieldKey is called with json as fallback tag and snake case", func(it bdd.It) {
+			encKey, encInline := Encoder{FallbackTagName: "json", Naming: SnakeCase}.FieldKey(field)
+			decKey, decInline := Decoder{FallbackTagName: "json", Naming: SnakeCase}.FieldKey(field)
+
+			it("should return '%[2]v', inline %[3]v", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), encKey)
+				assert.Equal(args[2].(bool), encInline)
+				assert.Equal(encKey, decKey)
+				assert.Equal(encInline, decInline)
+			})
+		})
+	}, like(
+		s("HTTPServer", "http_server", false), s("UserID", "user_id", false),
+		s("Email", "mail", false), s("Extra", "extra", true),
+	))
+
+	given(t, "the name %[1]v of a field without tags", func(when bdd.When, args ...interface{}) {
+		when("Key is called on each NamingStrategy", func(it bdd.It) {
+			it("should return '%[2]v', '%[3]v' and '%[4]v'", func(assert bdd.Assert) {
+				assert.Equal(args[1].(string), LowerCase.Key(args[0].(string)))
+				assert.Equal(args[2].(string), SnakeCase.Key(args[0].(string)))
+				assert.Equal(args[3].(string), CamelCase.Key(args[0].(string)))
+			})
+		})
+	}, like(
+		s("HTTPLog", "httplog", "http_log", "httpLog"), s("UserID", "userid", "user_id", "userID"),
+		s("ID", "id", "id", "id"),
+	))
+}
@@ -0,0 +1,339 @@
+package bsonutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// ErrCorrupted it's an error received when a BSON buffer isn't a valid
+// document.
+var ErrCorrupted = errors.New("document is corrupted")
+
+// RawDocument it's a BSON document kept as the bytes received, read
+// only when its fields are looked up. It avoids decoding documents
+// whole, when only some fields are needed, or when they're decoded
+// straight into structs.
+//
+// The bytes are shared, not copied, so they must not be changed while
+// the RawDocument it's used.
+type RawDocument []byte
+
+// RawValue it's a BSON value of a RawDocument, with its kind. Its
+// typed accessors return false when the kind isn't the one expected.
+type RawValue struct {
+	Kind byte
+	Data []byte
+}
+
+// NewRawDocument returns data as a RawDocument, checking it's a valid
+// BSON document, with nested documents, arrays and strings inside it.
+func NewRawDocument(data []byte) (RawDocument, error) {
+	d := RawDocument(data)
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Validate checks that d it's a valid BSON document, returning an error
+// wrapping ErrCorrupted if it isn't.
+func (d RawDocument) Validate() error {
+	if err := validateDoc(d); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	return nil
+}
+
+// Lookup returns the value on path, with keys of nested documents and
+// indexes of arrays separated by dots, like "items.0.price". The
+// values are found scanning d, without decoding it.
+func (d RawDocument) Lookup(path string) (v RawValue, found bool) {
+	doc := d
+	for {
+		key := path
+		if i := strings.IndexByte(path, '.'); i >= 0 {
+			key, path = path[:i], path[i+1:]
+		} else {
+			path = ""
+		}
+
+		if v, found = doc.lookupKey(key); !found || path == "" {
+			return
+		}
+		if v.Kind != bson.ElementDocument && v.Kind != bson.ElementArray {
+			return RawValue{}, false
+		}
+		doc = RawDocument(v.Data)
+	}
+}
+
+// lookupKey returns the value of key on d.
+func (d RawDocument) lookupKey(key string) (v RawValue, found bool) {
+	d.Each(func(name []byte, value RawValue) bool {
+		if string(name) == key {
+			v, found = value, true
+		}
+		return !found
+	})
+	return
+}
+
+// Each calls f with each key and value of d, in order, until f returns
+// false. The key it's shared with d, so it must be copied if kept. It
+// returns ErrCorrupted if the elements can't be read.
+func (d RawDocument) Each(f func(key []byte, v RawValue) bool) error {
+	if len(d) < 5 || int(binary.LittleEndian.Uint32(d)) != len(d) {
+		return ErrCorrupted
+	}
+
+	for i := 4; i < len(d)-1; {
+		kind := d[i]
+		end := bytes.IndexByte(d[i+1:], 0)
+		if end < 0 {
+			return ErrCorrupted
+		}
+		name := d[i+1 : i+1+end]
+		i += end + 2
+
+		size, err := bson.BSONElementSize(kind, i, d)
+		if err != nil || i+size > len(d)-1 {
+			return ErrCorrupted
+		}
+		if !f(name, RawValue{Kind: kind, Data: d[i : i+size]}) {
+			return nil
+		}
+		i += size
+	}
+	return nil
+}
+
+// Keys returns the keys of d, in order.
+func (d RawDocument) Keys() (keys []string, err error) {
+	err = d.Each(func(key []byte, v RawValue) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	return keys, err
+}
+
+// Unmarshal decodes d into out, as done by Unmarshal function.
+func (d RawDocument) Unmarshal(out interface{}) error {
+	return Decoder{}.Unmarshal(d, out)
+}
+
+// GetBSON returns d as it is, so it's stored without being decoded.
+func (d RawDocument) GetBSON() (interface{}, error) {
+	return bson.Raw{Kind: bson.ElementDocument, Data: d}, nil
+}
+
+// SetBSON keeps the document on raw, without decoding it.
+func (d *RawDocument) SetBSON(raw bson.Raw) error {
+	if raw.Kind != bson.ElementDocument {
+		return &bson.TypeError{Type: reflect.TypeOf(d).Elem(), Kind: raw.Kind}
+	}
+	*d = RawDocument(raw.Data)
+	return nil
+}
+
+// ExtJSON returns d as MongoDB Extended JSON v2, on mode.
+func (d RawDocument) ExtJSON(mode ExtJSONMode) ([]byte, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	w := &extJSONWriter{mode: mode}
+	w.writeDoc(d, false)
+	return w.out.Bytes(), nil
+}
+
+// String returns d as relaxed Extended JSON.
+func (d RawDocument) String() string {
+	out, err := d.ExtJSON(Relaxed)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(out)
+}
+
+// Unmarshal decodes v into out, a pointer, as done by Unmarshal
+// function with the values of documents.
+func (v RawValue) Unmarshal(out interface{}) (err error) {
+	defer handleErr(&err)
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("unmarshal needs a non-nil pointer")
+	}
+
+	d := newDecoder(v.Data)
+	if !d.readElemTo(rv.Elem(), v.Kind) {
+		return &bson.TypeError{Type: rv.Elem().Type(), Kind: v.Kind}
+	}
+	return nil
+}
+
+// ExtJSON returns v as MongoDB Extended JSON v2, on mode.
+func (v RawValue) ExtJSON(mode ExtJSONMode) (out []byte, err error) {
+	defer handleErr(&err)
+	w := &extJSONWriter{mode: mode}
+	w.writeElem(v.Kind, v.Data)
+	return w.out.Bytes(), nil
+}
+
+// IsNull reports whether v it's null or undefined.
+func (v RawValue) IsNull() bool {
+	return v.Kind == bson.ElementNil || v.Kind == bson.Element06
+}
+
+// StringValue returns v as a string, if it's a BSON string or symbol.
+func (v RawValue) StringValue() (s string, ok bool) {
+	if v.Kind != bson.ElementString && v.Kind != bson.ElementSymbol {
+		return "", false
+	}
+	return string(v.Data[4 : len(v.Data)-1]), true
+}
+
+// Int64 returns v as int64, if it's a BSON int32 or int64.
+func (v RawValue) Int64() (i int64, ok bool) {
+	switch v.Kind {
+	case bson.ElementInt32:
+		return int64(int32(binary.LittleEndian.Uint32(v.Data))), true
+	case bson.ElementInt64:
+		return int64(binary.LittleEndian.Uint64(v.Data)), true
+	}
+	return 0, false
+}
+
+// Float64 returns v as float64, if it's a BSON double, int32 or int64.
+func (v RawValue) Float64() (f float64, ok bool) {
+	if v.Kind == bson.ElementFloat64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(v.Data)), true
+	}
+	i, ok := v.Int64()
+	return float64(i), ok
+}
+
+// Bool returns v as bool, if it's a BSON boolean.
+func (v RawValue) Bool() (b bool, ok bool) {
+	if v.Kind != bson.ElementBool {
+		return false, false
+	}
+	return v.Data[0] == 1, true
+}
+
+// ObjectId returns v as bson.ObjectId, if it's a BSON ObjectId.
+func (v RawValue) ObjectId() (id bson.ObjectId, ok bool) {
+	if v.Kind != bson.ElementObjectId {
+		return "", false
+	}
+	return bson.ObjectId(v.Data), true
+}
+
+// Time returns v as time.Time, if it's a BSON datetime.
+func (v RawValue) Time() (t time.Time, ok bool) {
+	if v.Kind != bson.ElementDatetime {
+		return time.Time{}, false
+	}
+	ms := int64(binary.LittleEndian.Uint64(v.Data))
+	return time.Unix(ms/1e3, ms%1e3*1e6), true
+}
+
+// Decimal128 returns v as Decimal128, if it's a BSON decimal128.
+func (v RawValue) Decimal128() (d Decimal128, ok bool) {
+	if v.Kind != bson.ElementDecimal128 {
+		return Decimal128{}, false
+	}
+	return decimalFromBits(binary.LittleEndian.Uint64(v.Data[8:]), binary.LittleEndian.Uint64(v.Data)), true
+}
+
+// Binary returns v as bson.Binary, if it's BSON binary data. The data
+// it's shared with v.
+func (v RawValue) Binary() (b bson.Binary, ok bool) {
+	if v.Kind != bson.ElementBinary {
+		return bson.Binary{}, false
+	}
+	b = bson.Binary{Kind: v.Data[4], Data: v.Data[5:]}
+	if b.Kind == 0x02 && len(b.Data) >= 4 {
+		// Old binary subtype holds its length again.
+		b.Data = b.Data[4:]
+	}
+	return b, true
+}
+
+// Document returns v as RawDocument, if it's a BSON document.
+func (v RawValue) Document() (d RawDocument, ok bool) {
+	if v.Kind != bson.ElementDocument {
+		return nil, false
+	}
+	return RawDocument(v.Data), true
+}
+
+// Array returns v as RawDocument, with indexes as keys, if it's a BSON
+// array.
+func (v RawValue) Array() (d RawDocument, ok bool) {
+	if v.Kind != bson.ElementArray {
+		return nil, false
+	}
+	return RawDocument(v.Data), true
+}
+
+// validateDoc checks the document doc, returning what's wrong on it.
+func validateDoc(doc []byte) error {
+	if len(doc) < 5 {
+		return errors.New("too short")
+	}
+	if n := int(binary.LittleEndian.Uint32(doc)); n != len(doc) {
+		return fmt.Errorf("declared size %d, but has %d bytes", n, len(doc))
+	}
+	if doc[len(doc)-1] != 0 {
+		return errors.New("missing terminator")
+	}
+
+	var err error
+	if errEach := RawDocument(doc).Each(func(key []byte, v RawValue) bool {
+		if err = validateValue(v); err != nil {
+			err = fmt.Errorf("field %q: %s", key, err)
+		}
+		return err == nil
+	}); errEach != nil {
+		return errors.New("bad element")
+	}
+	return err
+}
+
+// validateValue checks the contents of v, already with the right size.
+func validateValue(v RawValue) error {
+	switch v.Kind {
+	case bson.ElementDocument, bson.ElementArray:
+		return validateDoc(v.Data)
+	case bson.ElementBool:
+		if v.Data[0] > 1 {
+			return errors.New("bad boolean")
+		}
+	case bson.ElementRegEx:
+		if bytes.Count(v.Data, []byte{0}) != 2 {
+			return errors.New("bad regular expression")
+		}
+	case bson.ElementDBPointer:
+		if _, err := bson.BSONElementSize(bson.ElementString, 0, v.Data); err != nil || len(v.Data) < 17 {
+			return errors.New("bad DBPointer")
+		}
+	case bson.ElementJavaScriptWithScope:
+		if len(v.Data) < 14 {
+			return errors.New("bad code with scope")
+		}
+		n, err := bson.BSONElementSize(bson.ElementString, 4, v.Data)
+		if err != nil {
+			return errors.New("bad code with scope")
+		}
+		return validateDoc(v.Data[4+n:])
+	}
+	return nil
+}
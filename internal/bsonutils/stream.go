@@ -0,0 +1,164 @@
+package bsonutils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxDocumentSize it's the size limit of documents used by Reader and
+// Writer without one, the limit of documents on MongoDB.
+const MaxDocumentSize = 16 * 1024 * 1024
+
+// ErrDocumentTooLarge it's an error received when reading or writing a
+// document larger than the size limit.
+var ErrDocumentTooLarge = errors.New("document is too large")
+
+// Reader reads consecutive BSON documents, each prefixed by its
+// length, like the .bson files written by mongodump. Documents are
+// read one at a time, so streams of any size can be processed without
+// being loaded into memory.
+type Reader struct {
+	// MaxSize it's the size limit of documents read, MaxDocumentSize
+	// if zero.
+	MaxSize int
+	// Decoder decodes documents read by Decode.
+	Decoder Decoder
+
+	r      *bufio.Reader
+	buf    []byte
+	offset int64
+	err    error
+}
+
+// NewReader returns a Reader of documents on r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadRaw returns the next document, validated. The document it's
+// only valid until the next call, since its buffer it's reused. It
+// returns io.EOF when there are no more documents, and an error
+// wrapping ErrCorrupted, io.ErrUnexpectedEOF or ErrDocumentTooLarge,
+// with the offset of document, if it can't be read. After an error,
+// the same error it's returned by every call.
+func (r *Reader) ReadRaw() (RawDocument, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return nil, r.fail(err)
+	}
+
+	n := int(int32(binary.LittleEndian.Uint32(size[:])))
+	if n < 5 {
+		return nil, r.fail(fmt.Errorf("%w: declared size %d", ErrCorrupted, n))
+	}
+	if n > maxSize(r.MaxSize) {
+		return nil, r.fail(fmt.Errorf("%w: %d bytes", ErrDocumentTooLarge, n))
+	}
+
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	copy(r.buf, size[:])
+	if _, err := io.ReadFull(r.r, r.buf[4:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, r.fail(err)
+	}
+
+	d := RawDocument(r.buf)
+	if err := d.Validate(); err != nil {
+		return nil, r.fail(err)
+	}
+
+	r.offset += int64(n)
+	return d, nil
+}
+
+// Decode reads the next document into out, using the Decoder of r. It
+// returns io.EOF when there are no more documents.
+func (r *Reader) Decode(out interface{}) error {
+	d, err := r.ReadRaw()
+	if err != nil {
+		return err
+	}
+	return r.Decoder.Unmarshal(d, out)
+}
+
+// Offset returns the number of bytes of the documents read.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// fail keeps and returns err with the offset of the document not
+// read. The end of stream, between documents, it's returned as it is.
+func (r *Reader) fail(err error) error {
+	if err != io.EOF {
+		err = fmt.Errorf("bson document at offset %d: %w", r.offset, err)
+	}
+	r.err = err
+	return err
+}
+
+// Writer writes BSON documents, each prefixed by its length, like the
+// .bson files written by mongodump and read by Reader.
+type Writer struct {
+	// MaxSize it's the size limit of documents written,
+	// MaxDocumentSize if zero.
+	MaxSize int
+	// Encoder encodes values written by Encode.
+	Encoder Encoder
+
+	w io.Writer
+}
+
+// NewWriter returns a Writer of documents on w. Documents are written
+// with one call to w each, so w can be buffered by the caller.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteRaw writes the document d, after checking it's valid and isn't
+// larger than the size limit.
+func (w *Writer) WriteRaw(d RawDocument) error {
+	if len(d) > maxSize(w.MaxSize) {
+		return fmt.Errorf("%w: %d bytes", ErrDocumentTooLarge, len(d))
+	}
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(d)
+	return err
+}
+
+// Encode marshals in, a map or a struct, with the Encoder of w and
+// writes it.
+func (w *Writer) Encode(in interface{}) error {
+	if d, ok := in.(RawDocument); ok {
+		return w.WriteRaw(d)
+	}
+
+	data, err := w.Encoder.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return w.WriteRaw(data)
+}
+
+// maxSize returns the size limit n, or MaxDocumentSize if it isn't
+// positive.
+func maxSize(n int) int {
+	if n <= 0 {
+		return MaxDocumentSize
+	}
+	return n
+}
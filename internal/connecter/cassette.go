@@ -0,0 +1,376 @@
+package connecter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// Operation codes from MongoDB wire protocol used by mgo.
+	opReply       = 1
+	opUpdate      = 2001
+	opInsert      = 2002
+	opQuery       = 2004
+	opGetMore     = 2005
+	opDelete      = 2006
+	opKillCursors = 2007
+
+	// headerSize it's the size of the header on every wire message.
+	headerSize = 16
+	// maxMessageSize it's the biggest message accepted on the wire.
+	maxMessageSize = 48 * 1000 * 1000
+	// flagQueryFailure it's the flag set on replies of failed queries.
+	flagQueryFailure = 2
+)
+
+var (
+	// ErrCorruptedMessage it's an error received when a message read
+	// from the wire doesn't follow MongoDB wire protocol.
+	ErrCorruptedMessage = errors.New("corrupted wire message")
+)
+
+// Interaction it's a single operation sent by mgo over the wire,
+// paired with the reply MongoDB sent back, when the operation expects
+// one. Request and Reply holds the messages without their headers,
+// and with keys of documents on Request sorted.
+type Interaction struct {
+	OpCode  int32  `json:"op"`
+	Command string `json:"command"`
+	Request []byte `json:"request"`
+	Reply   []byte `json:"reply,omitempty"`
+}
+
+// Cassette it's the record of every Interaction made through a
+// Recorder, along the name of the database used.
+type Cassette struct {
+	Database     string        `json:"database"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// loadCassette reads a Cassette stored on file at path p.
+func loadCassette(p string) (c *Cassette, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(p); err == nil {
+		c = &Cassette{}
+		err = json.Unmarshal(data, c)
+	}
+	return
+}
+
+// save writes the Cassette on file at path p.
+func (c *Cassette) save(p string) (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(c, "", "\t"); err == nil {
+		err = ioutil.WriteFile(p, data, 0644)
+	}
+	return
+}
+
+// message it's a MongoDB wire protocol message.
+type message struct {
+	requestID  int32
+	responseTo int32
+	opCode     int32
+	body       []byte
+}
+
+// readMessage reads a complete message from r.
+func readMessage(r io.Reader) (m *message, err error) {
+	var header [headerSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+
+	length := int32(binary.LittleEndian.Uint32(header[0:]))
+	if length < headerSize || length > maxMessageSize {
+		err = ErrCorruptedMessage
+		return
+	}
+
+	m = &message{
+		requestID:  int32(binary.LittleEndian.Uint32(header[4:])),
+		responseTo: int32(binary.LittleEndian.Uint32(header[8:])),
+		opCode:     int32(binary.LittleEndian.Uint32(header[12:])),
+		body:       make([]byte, length-headerSize),
+	}
+
+	if _, err = io.ReadFull(r, m.body); err != nil {
+		m = nil
+	}
+	return
+}
+
+// bytes returns the message encoded as it's sent on the wire.
+func (m *message) bytes() (b []byte) {
+	b = make([]byte, headerSize, headerSize+len(m.body))
+	binary.LittleEndian.PutUint32(b[0:], uint32(headerSize+len(m.body)))
+	binary.LittleEndian.PutUint32(b[4:], uint32(m.requestID))
+	binary.LittleEndian.PutUint32(b[8:], uint32(m.responseTo))
+	binary.LittleEndian.PutUint32(b[12:], uint32(m.opCode))
+	b = append(b, m.body...)
+	return
+}
+
+// expectsReply checks if the message is an operation MongoDB answers.
+func (m *message) expectsReply() (r bool) {
+	r = m.opCode == opQuery || m.opCode == opGetMore
+	return
+}
+
+// namespace returns the full collection name targeted by message, or
+// empty if the operation has none.
+func (m *message) namespace() (ns string) {
+	if m.opCode == opKillCursors {
+		return
+	}
+
+	// Every other operation starts with an int32 before namespace.
+	for i := 4; i < len(m.body); i++ {
+		if m.body[i] == 0 {
+			ns = string(m.body[4:i])
+			break
+		}
+	}
+	return
+}
+
+// request returns the normalized body, or the body as it's received
+// when it can't be normalized.
+func (m *message) request() (body []byte) {
+	var err error
+	if body, err = m.normalized(); err != nil {
+		body = m.body
+	}
+	return
+}
+
+// normalized returns the message body with the keys of every document
+// sorted, since mgo encodes maps on random order. Messages equivalent
+// have the same normalized body.
+func (m *message) normalized() (body []byte, err error) {
+	// Fields between namespace and documents for each operation.
+	var extra int
+	switch m.opCode {
+	case opQuery:
+		extra = 8
+	case opUpdate, opDelete:
+		extra = 4
+	case opInsert:
+		extra = 0
+	default:
+		body = m.body
+		return
+	}
+
+	start := 4 + len(m.namespace()) + 1 + extra
+	if start > len(m.body) {
+		err = ErrCorruptedMessage
+		return
+	}
+
+	body = append(body, m.body[:start]...)
+	for i := start; i < len(m.body) && err == nil; {
+		var doc []byte
+		if doc, err = sortDocument(m.body[i:], true); err == nil {
+			body = append(body, doc...)
+			i += len(doc)
+		}
+	}
+	return
+}
+
+// sortDocument returns the first BSON document on buffer b, with its
+// keys sorted when sortKeys is true. Nested documents are always
+// sorted, while arrays keep the order of its elements.
+func sortDocument(b []byte, sortKeys bool) (doc []byte, err error) {
+	if len(b) < 5 {
+		err = ErrCorruptedMessage
+		return
+	}
+
+	end := int(binary.LittleEndian.Uint32(b))
+	if end < 5 || end > len(b) || b[end-1] != 0 {
+		err = ErrCorruptedMessage
+		return
+	}
+
+	type element struct {
+		name string
+		data []byte
+	}
+
+	var elements []element
+	for i := 4; i < end-1; {
+		start := i
+		kind := b[i]
+
+		i++
+		for i < end && b[i] != 0 {
+			i++
+		}
+		name := string(b[start+1 : i])
+		i++
+
+		size, errSize := bson.BSONElementSize(kind, i, b[:end])
+		if errSize != nil || i+size > end-1 {
+			err = ErrCorruptedMessage
+			return
+		}
+
+		data := append([]byte{}, b[start:i]...)
+		switch kind {
+		case 0x03, 0x04:
+			var nested []byte
+			if nested, err = sortDocument(b[i:i+size], kind == 0x03); err != nil {
+				return
+			}
+			data = append(data, nested...)
+		default:
+			data = append(data, b[i:i+size]...)
+		}
+
+		elements = append(elements, element{name, data})
+		i += size
+	}
+
+	if sortKeys {
+		sort.SliceStable(elements, func(i, j int) bool {
+			return elements[i].name < elements[j].name
+		})
+	}
+
+	doc = append([]byte{}, b[:4]...)
+	for _, e := range elements {
+		doc = append(doc, e.data...)
+	}
+	doc = append(doc, 0)
+	return
+}
+
+// isAdminCommand checks if message it's a command run on admin
+// database, as the ones mgo use to monitor servers.
+func (m *message) isAdminCommand() (r bool) {
+	r = m.opCode == opQuery && m.namespace() == "admin.$cmd"
+	return
+}
+
+// describe returns a human readable summary of the operation on
+// message, to ease reading cassettes and failures.
+func (m *message) describe() (s string) {
+	ns := m.namespace()
+
+	switch m.opCode {
+	case opQuery:
+		// Skip flags, namespace, skip and limit to reach query.
+		s = "query " + ns
+		if start := 4 + len(ns) + 1 + 8; start < len(m.body) {
+			var doc bson.D
+			if raw, err := sortDocument(m.body[start:], false); err == nil && bson.Unmarshal(raw, &doc) == nil {
+				s = fmt.Sprintf("query %s %v", ns, doc)
+			}
+		}
+	case opGetMore:
+		s = "getMore " + ns
+	case opInsert:
+		s = "insert " + ns
+	case opUpdate:
+		s = "update " + ns
+	case opDelete:
+		s = "delete " + ns
+	case opKillCursors:
+		s = "killCursors"
+	default:
+		s = fmt.Sprintf("op %d", m.opCode)
+	}
+	return
+}
+
+// failureReply creates a reply to m, making mgo fail the operation
+// with the error message received.
+func failureReply(m *message, msg string) (r *message) {
+	doc, _ := bson.Marshal(bson.D{
+		{Name: "$err", Value: msg},
+		{Name: "code", Value: 0},
+	})
+
+	body := make([]byte, 20, 20+len(doc))
+	binary.LittleEndian.PutUint32(body[0:], flagQueryFailure)
+	binary.LittleEndian.PutUint32(body[16:], 1)
+	body = append(body, doc...)
+
+	r = &message{
+		responseTo: m.requestID,
+		opCode:     opReply,
+		body:       body,
+	}
+	return
+}
+
+// listener accepts connections on a local address and keep track of
+// them, to be able to close every one when stopped.
+type listener struct {
+	sync.Mutex
+	net.Listener
+	conns map[net.Conn]bool
+}
+
+// listen starts a listener on a random local port, that hands every
+// connection accepted to handle.
+func listen(handle func(net.Conn)) (l *listener, err error) {
+	var nl net.Listener
+	if nl, err = net.Listen("tcp", "127.0.0.1:0"); err == nil {
+		l = &listener{
+			Listener: nl,
+			conns:    make(map[net.Conn]bool),
+		}
+		go l.serve(handle)
+	}
+	return
+}
+
+// serve accepts connections until listener is closed.
+func (l *listener) serve(handle func(net.Conn)) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		l.Lock()
+		l.conns[conn] = true
+		l.Unlock()
+
+		go func() {
+			defer l.forget(conn)
+			handle(conn)
+		}()
+	}
+}
+
+// forget closes a connection, and stops tracking it.
+func (l *listener) forget(conn net.Conn) {
+	l.Lock()
+	delete(l.conns, conn)
+	l.Unlock()
+	conn.Close()
+}
+
+// stop closes the listener and all connections accepted.
+func (l *listener) stop() {
+	l.Close()
+
+	l.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.Unlock()
+}
@@ -7,7 +7,9 @@ Package connecter implements production and test connecters for MongoDB.
 
 I've created this package to implement two models for same interface
 MongoConnecter. Then created two objects implementing this interface,
-the Mongo and TestMongo types.
+the Mongo and TestMongo types. The Recorder and Replay types implements
+the same interface, recording operations made through other connecters
+and replaying them without any database.
 
 The main reason because this code needed to be at an internal package
 was due to restrictions on testing. Since TestMain on mongo package
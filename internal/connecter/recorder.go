@@ -0,0 +1,236 @@
+package connecter
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+var (
+	// ErrNoLiveServers it's an error received when the connecter
+	// decorated by a Recorder has no server to forward operations.
+	ErrNoLiveServers = errors.New("no live servers to record")
+)
+
+// dialTimeout it's the time waited to connect on local addresses.
+const dialTimeout = 10 * time.Second
+
+// Recorder is a MongoConnecter decorating another MongoConnecter. It
+// records every operation sent, and the replies received, saving them
+// on a cassette file when disconnected. Only the first live server of
+// the decorated connecter is recorded, so it must connect to a single
+// server, not a replica set or sharded cluster.
+type Recorder struct {
+	sync.Mutex
+	inner    MongoConnecter
+	path     string
+	database string
+	session  *mgo.Session
+	listener *listener
+	cassette *Cassette
+}
+
+// NewRecorder returns a Recorder as MongoConnecter, recording
+// operations made through the connecter c on the cassette file at
+// path p. The cassette can be used later with NewReplay.
+func NewRecorder(c MongoConnecter, p string) (m MongoConnecter) {
+	m = &Recorder{
+		inner: c,
+		path:  p,
+	}
+	return
+}
+
+// Connect to MongoDB using the decorated connecter, and then creates
+// a session passing through the Recorder, so every operation made on
+// Session will be recorded. Operations are forwarded to the first
+// live server of the decorated connecter. If the recording can't
+// start, the decorated connecter is disconnected.
+func (m *Recorder) Connect() (err error) {
+	if err = m.inner.Connect(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			m.abort()
+		}
+	}()
+
+	servers := m.inner.Session().LiveServers()
+	if len(servers) == 0 {
+		err = ErrNoLiveServers
+		return
+	}
+
+	m.inner.ConsumeDatabaseOnSession(func(db *mgo.Database) {
+		if db != nil {
+			m.database = db.Name
+		}
+	})
+	m.cassette = &Cassette{
+		Database: m.database,
+	}
+
+	// Fail early if the cassette can't be written.
+	if err = m.cassette.save(m.path); err != nil {
+		return
+	}
+
+	if m.listener, err = listen(func(conn net.Conn) {
+		m.record(conn, servers[0])
+	}); err == nil {
+		m.session, err = mgo.DialWithInfo(&mgo.DialInfo{
+			Addrs:    []string{m.listener.Addr().String()},
+			Direct:   true,
+			Database: m.database,
+			Timeout:  dialTimeout,
+		})
+	}
+
+	if err == nil {
+		m.session.SetSafe(&mgo.Safe{})
+	}
+
+	return
+}
+
+// abort undo a connection whose recording failed to start, without
+// saving the cassette.
+func (m *Recorder) abort() {
+	if m.session != nil {
+		m.session.Close()
+		m.session = nil
+	}
+
+	if m.listener != nil {
+		m.listener.stop()
+		m.listener = nil
+	}
+
+	m.Lock()
+	m.cassette = nil
+	m.Unlock()
+
+	m.inner.Disconnect()
+}
+
+// record forwards messages between client connection and server
+// at addr, recording each operation made.
+func (m *Recorder) record(client net.Conn, addr string) {
+	server, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+
+	var mu sync.Mutex
+	pending := make(map[int32]*Interaction)
+
+	go func() {
+		defer client.Close()
+		for {
+			reply, err := readMessage(server)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			if in, ok := pending[reply.responseTo]; ok {
+				delete(pending, reply.responseTo)
+				in.Reply = reply.body
+				m.add(in)
+			}
+			mu.Unlock()
+
+			if _, err = client.Write(reply.bytes()); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		request, err := readMessage(client)
+		if err != nil {
+			return
+		}
+
+		in := &Interaction{
+			OpCode:  request.opCode,
+			Command: request.describe(),
+			Request: request.request(),
+		}
+
+		if request.expectsReply() {
+			mu.Lock()
+			pending[request.requestID] = in
+			mu.Unlock()
+		} else {
+			m.add(in)
+		}
+
+		if _, err = server.Write(request.bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// add appends an Interaction to cassette being recorded.
+func (m *Recorder) add(in *Interaction) {
+	m.Lock()
+	if m.cassette != nil {
+		m.cassette.Interactions = append(m.cassette.Interactions, *in)
+	}
+	m.Unlock()
+}
+
+// Disconnect undo the connection made, saving the cassette with the
+// operations recorded. Preparing package for a new connection.
+func (m *Recorder) Disconnect() {
+	if m.session != nil {
+		m.session.Close()
+		m.session = nil
+	}
+
+	if m.listener != nil {
+		m.listener.stop()
+		m.listener = nil
+	}
+
+	m.Lock()
+	if m.cassette != nil {
+		if err := m.cassette.save(m.path); err != nil {
+			// Avoid leaving an incomplete cassette to be replayed.
+			os.Remove(m.path)
+		}
+		m.cassette = nil
+	}
+	m.Unlock()
+
+	m.inner.Disconnect()
+}
+
+// ConsumeDatabaseOnSession clones a session and use it to creates a
+// Databaser object to be consumed in f function. Closes session after
+// consume of Databaser object. Returns nil if no session is available.
+func (m *Recorder) ConsumeDatabaseOnSession(f func(*mgo.Database)) {
+	if s := m.Session(); s != nil {
+		s := s.Clone()
+		defer s.Close()
+
+		f(s.DB(m.database))
+	} else {
+		f(nil)
+	}
+}
+
+// Session return connected mongo session, which operations are
+// recorded.
+func (m *Recorder) Session() (s *mgo.Session) {
+	s = m.session
+	return
+}
@@ -0,0 +1,106 @@
+// +build !acceptance
+
+package connecter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// Feature Record and replay operations
+// - As a developer,
+// - I want to be able to record operations made on MongoDB and replay them later,
+// - So that I can test code using the database without any MongoDB running.
+func Test_Record_and_replay_operations(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	dir, _ := ioutil.TempDir("", "cassettes")
+	defer os.RemoveAll(dir)
+	cassette := filepath.Join(dir, "products.json")
+
+	given(t, "a Recorder m decorating a new test MongoConnecter with fixtures", func(when bdd.When) {
+		mc := NewRecorder(NewTestable("", "internalTesting", colIdFixtures), cassette)
+
+		err := mc.Connect()
+
+		when("err := mc.Connect() is called", func(it bdd.It) {
+			it("shouldn't return any error", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+		})
+
+		var n int
+		mc.ConsumeDatabaseOnSession(func(db *mgo.Database) {
+			n, err = db.C("products").Count()
+		})
+
+		when("products are counted on recorded session", func(it bdd.It) {
+			it("shouldn't return any error", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("should count 2 products", func(assert bdd.Assert) {
+				assert.Equal(2, n)
+			})
+		})
+
+		mc.Disconnect()
+
+		when("mc.Disconnect() is called", func(it bdd.It) {
+			_, errStat := os.Stat(cassette)
+
+			it("should have saved the cassette", func(assert bdd.Assert) {
+				assert.Nil(errStat)
+			})
+		})
+	})
+
+	given(t, "a Replay m of the cassette recorded", func(when bdd.When) {
+		var Verify func() error
+		mc := NewReplay(cassette, &Verify)
+
+		err := mc.Connect()
+		defer mc.Disconnect()
+
+		when("err := mc.Connect() is called", func(it bdd.It) {
+			it("shouldn't return any error", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+		})
+
+		var n int
+		mc.ConsumeDatabaseOnSession(func(db *mgo.Database) {
+			n, err = db.C("products").Count()
+		})
+
+		when("products are counted on replayed session", func(it bdd.It) {
+			it("shouldn't return any error", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("should count 2 products", func(assert bdd.Assert) {
+				assert.Equal(2, n)
+			})
+			it("should have Verify() return no errors", func(assert bdd.Assert) {
+				assert.Nil(Verify())
+			})
+		})
+
+		mc.ConsumeDatabaseOnSession(func(db *mgo.Database) {
+			err = db.C("products").Insert(newProduct())
+		})
+
+		when("a product not recorded is inserted on replayed session", func(it bdd.It) {
+			it("should return an error", func(assert bdd.Assert) {
+				assert.Error(err)
+				assert.Contains(err.Error(), "unexpected operation")
+			})
+			it("should have Verify() return an error", func(assert bdd.Assert) {
+				assert.Error(Verify())
+			})
+		})
+	})
+}
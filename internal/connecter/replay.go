@@ -0,0 +1,206 @@
+package connecter
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/globalsign/mgo"
+)
+
+// Replay is a MongoConnecter that doesn't need any MongoDB. It serves
+// the replies recorded on a cassette file by a Recorder, answering
+// each operation with the reply received for the same operation.
+//
+// Operations not found on cassette fail with an error describing the
+// operation. Commands mgo use to monitor servers may be answered more
+// than once, every other recorded operation is answered only once.
+type Replay struct {
+	sync.Mutex
+	path       string
+	session    *mgo.Session
+	listener   *listener
+	cassette   *Cassette
+	used       []bool
+	unexpected []string
+	verifyFn   *func() error
+}
+
+// NewReplay returns a Replay as MongoConnecter, serving replies from
+// the cassette file at path p, and a optional verify function address,
+// to be set when connecting the MongoConnecter.
+//
+// The verify function returns an error listing the operations not
+// found on cassette, and the operations recorded that were never
+// replayed.
+func NewReplay(p string, verify ...*func() error) (m MongoConnecter) {
+	r := &Replay{
+		path: p,
+	}
+
+	if len(verify) == 1 {
+		r.verifyFn = verify[0]
+	}
+
+	m = r
+	return
+}
+
+// Connect loads the cassette and creates a session to a local server
+// replaying it. It also defines the verify function if received on
+// constructor. If the session can't be created, the local server is
+// stopped.
+func (m *Replay) Connect() (err error) {
+	if m.cassette, err = loadCassette(m.path); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			m.Disconnect()
+		}
+	}()
+
+	m.used = make([]bool, len(m.cassette.Interactions))
+	m.unexpected = nil
+
+	if m.listener, err = listen(m.replay); err == nil {
+		m.session, err = mgo.DialWithInfo(&mgo.DialInfo{
+			Addrs:    []string{m.listener.Addr().String()},
+			Direct:   true,
+			Database: m.cassette.Database,
+			Timeout:  dialTimeout,
+		})
+	}
+
+	if err == nil {
+		m.session.SetSafe(&mgo.Safe{})
+
+		if m.verifyFn != nil {
+			*m.verifyFn = m.verify
+		}
+	}
+
+	return
+}
+
+// replay answers every message received on conn with the recorded
+// replies.
+func (m *Replay) replay(conn net.Conn) {
+	for {
+		request, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+
+		body, found := m.match(request)
+
+		if request.expectsReply() {
+			var reply *message
+			if found {
+				reply = &message{
+					responseTo: request.requestID,
+					opCode:     opReply,
+					body:       body,
+				}
+			} else {
+				reply = failureReply(request, "replay: unexpected operation "+request.describe())
+			}
+
+			if _, err = conn.Write(reply.bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// match search for the reply recorded to request, marking it as
+// used. Requests not recorded are stored to be reported as unexpected.
+func (m *Replay) match(request *message) (reply []byte, found bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	body := request.request()
+
+	last := -1
+	for i, in := range m.cassette.Interactions {
+		if in.OpCode != request.opCode || !bytes.Equal(in.Request, body) {
+			continue
+		}
+
+		if !m.used[i] {
+			m.used[i] = true
+			reply, found = in.Reply, true
+			return
+		}
+
+		last = i
+	}
+
+	if last >= 0 && request.isAdminCommand() {
+		reply, found = m.cassette.Interactions[last].Reply, true
+	} else {
+		m.unexpected = append(m.unexpected, request.describe())
+	}
+
+	return
+}
+
+// verify returns an error if there were unexpected operations, or
+// recorded operations never replayed.
+func (m *Replay) verify() (err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var problems []string
+	for _, u := range m.unexpected {
+		problems = append(problems, "unexpected "+u)
+	}
+
+	for i, in := range m.cassette.Interactions {
+		if !m.used[i] && !strings.HasPrefix(in.Command, "query admin.$cmd") {
+			problems = append(problems, "not replayed "+in.Command)
+		}
+	}
+
+	if len(problems) > 0 {
+		err = fmt.Errorf("replay of %s failed: %s", m.path, strings.Join(problems, "; "))
+	}
+	return
+}
+
+// Disconnect undo the connection made. Preparing package for a new
+// connection.
+func (m *Replay) Disconnect() {
+	if m.session != nil {
+		m.session.Close()
+		m.session = nil
+	}
+
+	if m.listener != nil {
+		m.listener.stop()
+		m.listener = nil
+	}
+}
+
+// ConsumeDatabaseOnSession clones a session and use it to creates a
+// Databaser object to be consumed in f function. Closes session after
+// consume of Databaser object. Returns nil if no session is available.
+func (m *Replay) ConsumeDatabaseOnSession(f func(*mgo.Database)) {
+	if s := m.Session(); s != nil {
+		s := s.Clone()
+		defer s.Close()
+
+		f(s.DB(m.cassette.Database))
+	} else {
+		f(nil)
+	}
+}
+
+// Session return connected mongo session, answered by the cassette.
+func (m *Replay) Session() (s *mgo.Session) {
+	s = m.session
+	return
+}
@@ -0,0 +1,50 @@
+// Copyright 2009 Dênnis Dantas de Sousa. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package migrations applies numbered changes on MongoDB documents.
+
+Each migration it's a Go function changing the database, with an
+optional function undoing it. They're registered with a version, and
+applied in order of version, each one only once:
+
+	func init() {
+		migrations.Register(1, "split_name", func(s *mgo.Session) error {
+			// Change documents with s.DB("").
+			return nil
+		}, nil)
+	}
+
+The migrations applied are recorded on the migrations collection. While
+they run, a lock document on migrations_lock prevents other processes
+from running them too, returning ErrLocked. The lock is refreshed while
+held, and a lock abandoned by a process that crashed is taken after
+LockTimeout. Each migration checks the lock is still held before being
+run and recorded, stopping with ErrLockLost otherwise.
+
+The migrations can be run with the migrate command, from the module
+registering them:
+
+	go get github.com/ddspog/mongo/cmd/migrate
+	migrate -pkg ./migrations up
+
+It builds a small program importing the package, that calls Main:
+
+	package main
+
+	import (
+		"github.com/ddspog/mongo/migrations"
+		_ "example.com/app/migrations"
+	)
+
+	func main() {
+		migrations.Main()
+	}
+
+That connects with MONGODB_URL, like mongo.Connect, and accepts the
+commands status, up [version] and down [n]. The same program can be
+kept on the module instead. A Migrator can also be used directly, with
+any mgo.Session.
+*/
+package migrations
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+var (
+	// Helpful vars for testing with database.
+	resetDB func() error
+)
+
+// TestMain setup tests to run with a temporary database.
+func TestMain(m *testing.M) {
+	mongo.InitConnecter(mongo.NewTestableConnecter("", "migrations", map[string]interface{}{}, &resetDB))
+
+	_ = mongo.Connect()
+	defer mongo.Disconnect()
+
+	retCode := m.Run()
+	defer os.Exit(retCode)
+}
+
+// cleanChanges call resetDB ignoring its error.
+func cleanChanges() {
+	_ = resetDB()
+}
+
+// newMigrator returns a Migrator with two migrations, adding and
+// removing a price of 1 on all products, and a name to bread.
+func newMigrator() (m *Migrator) {
+	m = &Migrator{}
+	_ = m.Add(Migration{
+		Version: 2,
+		Name:    "add_bread",
+		Up: func(s *mgo.Session) error {
+			return s.DB("").C("products").Insert(mongo.M{"name": "bread"})
+		},
+		Down: func(s *mgo.Session) (err error) {
+			_, err = s.DB("").C("products").RemoveAll(mongo.M{"name": "bread"})
+			return
+		},
+	}, Migration{
+		Version: 1,
+		Name:    "create_products",
+		Up: func(s *mgo.Session) error {
+			return s.DB("").C("products").Create(&mgo.CollectionInfo{})
+		},
+		Down: func(s *mgo.Session) error {
+			return s.DB("").C("products").DropCollection()
+		},
+	})
+	return
+}
@@ -0,0 +1,139 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+// lockID it's the _id of the lock document.
+const lockID = "lock"
+
+// defaultLockTimeout it's the LockTimeout used if not defined.
+const defaultLockTimeout = 10 * time.Minute
+
+// lock it's the document held by the process running migrations.
+type lock struct {
+	ID       string `bson:"_id"`
+	Owner    string `bson:"owner"`
+	LockedOn int64  `bson:"locked_on"`
+}
+
+// locked runs f on a copy of s, holding the lock of Migrator with the
+// owner identifying it. While f runs, the lock is refreshed on every
+// third of LockTimeout, so it isn't taken as abandoned. It returns
+// ErrLocked if other process holds it.
+func (m *Migrator) locked(s *mgo.Session, f func(s *mgo.Session, owner string) error) (err error) {
+	s = s.Copy()
+	defer s.Close()
+
+	// The lock must be read from primary, as soon as it's taken.
+	s.SetMode(mgo.Strong, true)
+
+	var owner string
+	if owner, err = m.lock(s); err != nil {
+		return
+	}
+
+	stop := m.heartbeat(s, owner)
+	defer func() {
+		stop()
+		if errUnlock := m.unlock(s, owner); err == nil {
+			err = errUnlock
+		}
+	}()
+
+	err = f(s, owner)
+	return
+}
+
+// lock takes the lock of Migrator on s, or the one abandoned for more
+// than LockTimeout, returning the owner identifying it.
+func (m *Migrator) lock(s *mgo.Session) (owner string, err error) {
+	host, _ := os.Hostname()
+	owner = fmt.Sprintf("%s:%d:%s", host, os.Getpid(), mongo.NewID().Hex())
+	now := mongo.NowInMilli()
+
+	c := m.locks(s)
+	if err = c.Insert(lock{ID: lockID, Owner: owner, LockedOn: now}); !mgo.IsDup(err) {
+		return
+	}
+
+	err = c.Update(mongo.M{
+		"_id":       lockID,
+		"locked_on": mongo.M{"$lt": now - int64(m.lockTimeout()/time.Millisecond)},
+	}, lock{ID: lockID, Owner: owner, LockedOn: now})
+
+	if err == mgo.ErrNotFound {
+		err = ErrLocked
+	}
+	return
+}
+
+// heartbeat refreshes the lock held by owner on s, on every third of
+// LockTimeout, until stop is called.
+func (m *Migrator) heartbeat(s *mgo.Session, owner string) (stop func()) {
+	s = s.Copy()
+	ticker := time.NewTicker(m.lockTimeout() / 3)
+	done, stopped := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		defer s.Close()
+
+		for {
+			select {
+			case <-ticker.C:
+				// A lock lost is reported by owns, before each step.
+				_ = m.locks(s).Update(mongo.M{"_id": lockID, "owner": owner}, mongo.M{
+					"$set": mongo.M{"locked_on": mongo.NowInMilli()},
+				})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop = func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+	return
+}
+
+// owns returns ErrLockLost if the lock of Migrator on s isn't held by
+// owner anymore, being taken by other process.
+func (m *Migrator) owns(s *mgo.Session, owner string) (err error) {
+	var n int
+	if n, err = m.locks(s).Find(mongo.M{"_id": lockID, "owner": owner}).Count(); err == nil && n == 0 {
+		err = ErrLockLost
+	}
+	return
+}
+
+// lockTimeout returns the LockTimeout of Migrator, or the default one.
+func (m *Migrator) lockTimeout() (timeout time.Duration) {
+	if timeout = m.LockTimeout; timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+	return
+}
+
+// unlock releases the lock of Migrator on s, if still held by owner.
+func (m *Migrator) unlock(s *mgo.Session, owner string) (err error) {
+	if err = m.locks(s).Remove(mongo.M{"_id": lockID, "owner": owner}); err == mgo.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// locks returns the collection holding the lock document.
+func (m *Migrator) locks(s *mgo.Session) (c *mgo.Collection) {
+	c = m.records(s)
+	c = c.Database.C(c.Name + "_lock")
+	return
+}
@@ -0,0 +1,144 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+// ErrUsage it's an error received when the arguments of Main aren't
+// valid.
+var ErrUsage = errors.New("usage: [status | up [version] | down [n]]")
+
+// command it's an action asked to Main, with its number argument.
+type command struct {
+	name string
+	n    int
+}
+
+// Main runs the migrations registered with Register, on the database
+// of MONGODB_URL, as asked by command line arguments:
+//
+//     status       lists migrations, and if they were applied
+//     up           applies all migrations pending
+//     up version   applies migrations pending until version
+//     down         rolls back the last migration applied
+//     down n       rolls back the last n migrations applied
+//
+// It exits the process with status 2 on invalid arguments, and 1 when
+// the command fails. It's meant to be the main function of a command
+// importing the packages registering migrations, as the one built by
+// the migrate command:
+//
+//     package main
+//
+//     import (
+//         "github.com/ddspog/mongo/migrations"
+//         _ "example.com/app/migrations"
+//     )
+//
+//     func main() {
+//         migrations.Main()
+//     }
+func Main() {
+	os.Exit(execute(os.Args[1:], os.Stdout))
+}
+
+// execute runs the command asked on args, as Main, writing the result
+// on w. It returns the exit code of process, after disconnecting.
+func execute(args []string, w io.Writer) (code int) {
+	log.SetFlags(0)
+	log.SetPrefix("migrations: ")
+
+	cmd, err := parseCommand(args)
+	if err != nil {
+		log.Println(err)
+		code = 2
+		return
+	}
+
+	if err = mongo.Connect(); err != nil {
+		log.Println(err)
+		code = 1
+		return
+	}
+	defer mongo.Disconnect()
+
+	if err = run(defaultMigrator, mongo.Session(), cmd, w); err != nil {
+		log.Println(err)
+		code = 1
+	}
+	return
+}
+
+// parseCommand reads the command asked on args.
+func parseCommand(args []string) (cmd command, err error) {
+	cmd = command{name: "status"}
+	if len(args) > 0 {
+		cmd.name = args[0]
+	}
+
+	switch {
+	case len(args) > 2:
+		err = ErrUsage
+	case cmd.name == "status" && len(args) > 1:
+		err = ErrUsage
+	case cmd.name == "down":
+		cmd.n = 1
+		fallthrough
+	case cmd.name == "up":
+		if len(args) == 2 {
+			if cmd.n, err = strconv.Atoi(args[1]); err != nil || cmd.n <= 0 {
+				err = ErrUsage
+			}
+		}
+	case cmd.name != "status":
+		err = ErrUsage
+	}
+	return
+}
+
+// run executes cmd with Migrator m on session s, writing the result
+// on w.
+func run(m *Migrator, s *mgo.Session, cmd command, w io.Writer) (err error) {
+	var versions []int
+
+	switch cmd.name {
+	case "up":
+		versions, err = m.UpTo(s, cmd.n)
+		for _, v := range versions {
+			fmt.Fprintf(w, "applied %s\n", m.migrations[m.find(v)])
+		}
+	case "down":
+		versions, err = m.Down(s, cmd.n)
+		for _, v := range versions {
+			fmt.Fprintf(w, "rolled back %s\n", m.migrations[m.find(v)])
+		}
+	default:
+		var status []Status
+		if status, err = m.Status(s); err == nil {
+			writeStatus(w, status)
+		}
+	}
+	return
+}
+
+// writeStatus writes each migration on status, with the time applied
+// or pending.
+func writeStatus(w io.Writer, status []Status) {
+	for _, st := range status {
+		state := "pending"
+		if st.Applied {
+			state = "applied on " + time.Unix(0, st.AppliedOn*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\n", st.Migration, state)
+	}
+}
@@ -0,0 +1,344 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+var (
+	// ErrInvalidVersion it's an error received registering a Migration
+	// with a version not positive.
+	ErrInvalidVersion = errors.New("migration version must be positive")
+	// ErrDuplicateVersion it's an error received registering a Migration
+	// with the version of one already registered.
+	ErrDuplicateVersion = errors.New("migration version already registered")
+	// ErrNoUp it's an error received registering a Migration without Up.
+	ErrNoUp = errors.New("migration without Up")
+	// ErrIrreversible it's an error received rolling back a Migration
+	// without Down.
+	ErrIrreversible = errors.New("migration without Down")
+	// ErrUnknownVersion it's an error received when a version applied
+	// on database isn't registered.
+	ErrUnknownVersion = errors.New("migration version not registered")
+	// ErrLocked it's an error received when other process is running
+	// migrations on the same database.
+	ErrLocked = errors.New("migrations locked by other process")
+	// ErrLockLost it's an error received when the lock held while
+	// running migrations was taken by other process, having stopped
+	// being refreshed for LockTimeout.
+	ErrLockLost = errors.New("migrations lock lost to other process")
+)
+
+// DefaultCollection it's the collection where the migrations applied
+// are recorded, if not defined on Migrator.
+const DefaultCollection = "migrations"
+
+// Migration it's a change on database, identified by Version. Up makes
+// the change, and Down undo it, being optional for migrations that
+// can't be rolled back. Both receive a session connected to database.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(s *mgo.Session) error
+	Down    func(s *mgo.Session) error
+}
+
+// String returns version and name of Migration.
+func (m Migration) String() (s string) {
+	s = fmt.Sprintf("%d_%s", m.Version, m.Name)
+	return
+}
+
+// Status it's a Migration registered, and if it was applied on
+// database, when, as time in Millisecond unit.
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedOn int64
+}
+
+// record it's the document stored for each Migration applied.
+type record struct {
+	Version   int    `bson:"_id"`
+	Name      string `bson:"name"`
+	AppliedOn int64  `bson:"applied_on"`
+}
+
+// Migrator keeps the migrations registered, applying them on database
+// in order of version. The migrations applied are recorded on
+// collection, and a lock document on collection with suffix _lock
+// prevents two processes from running them at the same time.
+type Migrator struct {
+	// Collection it's the collection recording the migrations
+	// applied, DefaultCollection if empty.
+	Collection string
+	// LockTimeout it's the time after a lock it's considered
+	// abandoned by a process that crashed, 10 minutes if zero. The
+	// process holding the lock refreshes it on every third of
+	// LockTimeout, so migrations can take longer than it.
+	LockTimeout time.Duration
+
+	migrations []Migration
+}
+
+// defaultMigrator it's the Migrator used by Register and Main.
+var defaultMigrator = &Migrator{}
+
+// Default returns the Migrator holding migrations registered with
+// Register, used by Main.
+func Default() (m *Migrator) {
+	m = defaultMigrator
+	return
+}
+
+// Register adds a migration on the Migrator returned by Default. It's
+// meant to be called on init functions, panicking on invalid
+// migrations, like database/sql.Register:
+//
+//     func init() {
+//         migrations.Register(1, "add_price", upAddPrice, downAddPrice)
+//     }
+func Register(version int, name string, up, down func(*mgo.Session) error) {
+	if err := defaultMigrator.Add(Migration{
+		Version: version,
+		Name:    name,
+		Up:      up,
+		Down:    down,
+	}); err != nil {
+		panic(fmt.Sprintf("migrations: %v %s", err, Migration{Version: version, Name: name}))
+	}
+}
+
+// Add registers migrations on Migrator, returning an error if any has
+// invalid version, a version already registered, or no Up function.
+func (m *Migrator) Add(migrations ...Migration) (err error) {
+	for _, mig := range migrations {
+		switch {
+		case mig.Version <= 0:
+			err = ErrInvalidVersion
+		case mig.Up == nil:
+			err = ErrNoUp
+		case m.find(mig.Version) >= 0:
+			err = ErrDuplicateVersion
+		}
+
+		if err != nil {
+			return
+		}
+
+		m.migrations = append(m.migrations, mig)
+		sort.Slice(m.migrations, func(i, j int) bool {
+			return m.migrations[i].Version < m.migrations[j].Version
+		})
+	}
+	return
+}
+
+// Migrations returns the migrations registered, in order of version.
+func (m *Migrator) Migrations() (migrations []Migration) {
+	migrations = append(migrations, m.migrations...)
+	return
+}
+
+// Status returns the migrations registered, telling if each one was
+// applied on database of s.
+func (m *Migrator) Status(s *mgo.Session) (status []Status, err error) {
+	var applied map[int]record
+	if applied, err = m.applied(s); err != nil {
+		return
+	}
+
+	status = make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		r, ok := applied[mig.Version]
+		status[i] = Status{Migration: mig, Applied: ok, AppliedOn: r.AppliedOn}
+	}
+	return
+}
+
+// Up applies all migrations not applied yet on database of s, in order
+// of version. It returns the versions applied.
+func (m *Migrator) Up(s *mgo.Session) (versions []int, err error) {
+	versions, err = m.UpTo(s, 0)
+	return
+}
+
+// UpTo applies the migrations not applied yet on database of s, with
+// version until target, in order of version. A target of zero applies
+// all of them. It returns the versions applied, stopping on the first
+// error.
+func (m *Migrator) UpTo(s *mgo.Session, target int) (versions []int, err error) {
+	err = m.locked(s, func(s *mgo.Session, owner string) (err error) {
+		var applied map[int]record
+		if applied, err = m.applied(s); err != nil {
+			return
+		}
+
+		for _, mig := range pending(m.migrations, applied, target) {
+			if err = m.up(s, owner, mig); err != nil {
+				return
+			}
+			versions = append(versions, mig.Version)
+		}
+		return
+	})
+	return
+}
+
+// Down rolls back the last n migrations applied on database of s, the
+// newest first. It returns the versions rolled back, stopping on the
+// first error.
+func (m *Migrator) Down(s *mgo.Session, n int) (versions []int, err error) {
+	err = m.locked(s, func(s *mgo.Session, owner string) (err error) {
+		var applied map[int]record
+		if applied, err = m.applied(s); err != nil {
+			return
+		}
+
+		var last []Migration
+		if last, err = latest(m.migrations, applied, n); err != nil {
+			return
+		}
+
+		for _, mig := range last {
+			if err = m.down(s, owner, mig); err != nil {
+				return
+			}
+			versions = append(versions, mig.Version)
+		}
+		return
+	})
+	return
+}
+
+// up applies mig on s, recording it, while the lock is held by
+// owner.
+func (m *Migrator) up(s *mgo.Session, owner string, mig Migration) (err error) {
+	if err = m.owns(s, owner); err != nil {
+		err = fmt.Errorf("migration %s: %w", mig, err)
+		return
+	}
+
+	if err = mig.Up(s); err != nil {
+		err = fmt.Errorf("migration %s up: %w", mig, err)
+		return
+	}
+
+	if err = m.owns(s, owner); err != nil {
+		err = fmt.Errorf("migration %s applied, but not recorded: %w", mig, err)
+		return
+	}
+
+	err = m.records(s).Insert(record{
+		Version:   mig.Version,
+		Name:      mig.Name,
+		AppliedOn: mongo.NowInMilli(),
+	})
+	return
+}
+
+// down rolls back mig on s, removing its record, while the lock is
+// held by owner.
+func (m *Migrator) down(s *mgo.Session, owner string, mig Migration) (err error) {
+	if mig.Down == nil {
+		err = fmt.Errorf("migration %s: %w", mig, ErrIrreversible)
+		return
+	}
+
+	if err = m.owns(s, owner); err != nil {
+		err = fmt.Errorf("migration %s: %w", mig, err)
+		return
+	}
+
+	if err = mig.Down(s); err != nil {
+		err = fmt.Errorf("migration %s down: %w", mig, err)
+		return
+	}
+
+	if err = m.owns(s, owner); err != nil {
+		err = fmt.Errorf("migration %s rolled back, but still recorded: %w", mig, err)
+		return
+	}
+
+	err = m.records(s).RemoveId(mig.Version)
+	return
+}
+
+// applied returns the records of migrations applied on database of s,
+// by version.
+func (m *Migrator) applied(s *mgo.Session) (applied map[int]record, err error) {
+	var records []record
+	if err = m.records(s).Find(nil).All(&records); err == nil {
+		applied = make(map[int]record, len(records))
+		for _, r := range records {
+			applied[r.Version] = r
+		}
+	}
+	return
+}
+
+// records returns the collection recording migrations applied.
+func (m *Migrator) records(s *mgo.Session) (c *mgo.Collection) {
+	name := m.Collection
+	if name == "" {
+		name = DefaultCollection
+	}
+
+	c = s.DB("").C(name)
+	return
+}
+
+// find returns the index of migration with version on Migrator, or -1.
+func (m *Migrator) find(version int) (i int) {
+	for i = range m.migrations {
+		if m.migrations[i].Version == version {
+			return
+		}
+	}
+
+	i = -1
+	return
+}
+
+// pending returns the migrations not applied, with version until
+// target, or all of them if target it's zero.
+func pending(migrations []Migration, applied map[int]record, target int) (out []Migration) {
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; !ok && (target == 0 || mig.Version <= target) {
+			out = append(out, mig)
+		}
+	}
+	return
+}
+
+// latest returns the last n migrations applied, the newest first. It
+// returns ErrUnknownVersion if one of them isn't registered.
+func latest(migrations []Migration, applied map[int]record, n int) (out []Migration, err error) {
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	for i := 0; i < len(versions) && i < n; i++ {
+		found := false
+		for _, mig := range migrations {
+			if found = mig.Version == versions[i]; found {
+				out = append(out, mig)
+				break
+			}
+		}
+
+		if !found {
+			err = fmt.Errorf("%w: %d", ErrUnknownVersion, versions[i])
+			out = nil
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,231 @@
+// +build !acceptance
+
+package migrations
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo"
+	"github.com/globalsign/mgo"
+)
+
+// up it's an Up function doing nothing.
+func up(s *mgo.Session) (err error) {
+	return
+}
+
+// Feature Register migrations
+// - As a developer,
+// - I want to register numbered migrations,
+// - So that they are applied in order.
+func Test_Register_migrations(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a Migrator m with migrations 2 and 1 added", func(when bdd.When, args ...interface{}) {
+		m := newMigrator()
+
+		when("m.Migrations() is called", func(it bdd.It) {
+			migrations := m.Migrations()
+
+			it("should return them in order of version", func(assert bdd.Assert) {
+				assert.Len(migrations, 2)
+				assert.Equal("1_create_products", migrations[0].String())
+				assert.Equal("2_add_bread", migrations[1].String())
+			})
+		})
+
+		when("m.Add() is called with %[1]v", func(it bdd.It) {
+			err := m.Add(args[1].(Migration))
+
+			it("should return %[2]v", func(assert bdd.Assert) {
+				assert.Equal(args[2].(error), err)
+			})
+		})
+	}, like(
+		s("version 1 again", Migration{Version: 1, Up: up}, ErrDuplicateVersion),
+		s("version 0", Migration{Version: 0, Up: up}, ErrInvalidVersion),
+		s("no Up", Migration{Version: 3}, ErrNoUp),
+	))
+
+	given(t, "migrations 1, 2 and 3, with 1 and 3 applied", func(when bdd.When, args ...interface{}) {
+		migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+		applied := map[int]record{1: {Version: 1}, 3: {Version: 3}}
+
+		when("pending() and latest() are called", func(it bdd.It) {
+			it("pending() should return 2", func(assert bdd.Assert) {
+				assert.Equal(migrations[1:2], pending(migrations, applied, 0))
+				assert.Empty(pending(migrations, applied, 1))
+			})
+			it("latest() should return 3 and then 1", func(assert bdd.Assert) {
+				last, err := latest(migrations, applied, 5)
+				assert.NoError(err)
+				assert.Equal([]Migration{migrations[2], migrations[0]}, last)
+			})
+			it("latest() should fail with version 4 applied", func(assert bdd.Assert) {
+				_, err := latest(migrations, map[int]record{4: {Version: 4}}, 1)
+				assert.True(errors.Is(err, ErrUnknownVersion))
+			})
+		})
+	})
+}
+
+// Feature Parse command line of migrations
+// - As a developer,
+// - I want a small CLI running my migrations,
+// - So that I can apply them on deploys.
+func Test_Parse_command_line_of_migrations(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "the arguments %[1]v", func(when bdd.When, args ...interface{}) {
+		when("parseCommand() is called", func(it bdd.It) {
+			cmd, err := parseCommand(args[0].([]string))
+
+			it("should return command %[2]v %[3]v", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(command{name: args[1].(string), n: args[2].(int)}, cmd)
+			})
+		})
+	}, like(
+		s([]string{}, "status", 0), s([]string{"up"}, "up", 0),
+		s([]string{"up", "3"}, "up", 3), s([]string{"down"}, "down", 1),
+		s([]string{"down", "2"}, "down", 2),
+	))
+
+	given(t, "the invalid arguments %[1]v", func(when bdd.When, args ...interface{}) {
+		when("parseCommand() is called", func(it bdd.It) {
+			_, err := parseCommand(args[0].([]string))
+
+			it("should return ErrUsage", func(assert bdd.Assert) {
+				assert.Equal(ErrUsage, err)
+			})
+		})
+	}, like(
+		s([]string{"redo"}), s([]string{"up", "x"}), s([]string{"down", "0"}),
+		s([]string{"status", "1"}), s([]string{"up", "1", "2"}),
+	))
+}
+
+// Feature Apply migrations on database
+// - As a developer,
+// - I want migrations applied and recorded on database,
+// - So that each one runs only once.
+func Test_Apply_migrations_on_database(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a Migrator m with migrations 1 and 2", func(when bdd.When, args ...interface{}) {
+		m := newMigrator()
+		s := mongo.Session()
+
+		when("m.UpTo(s, 1), m.Up(s) and m.Up(s) again are called", func(it bdd.It) {
+			first, errFirst := m.UpTo(s, 1)
+			second, errSecond := m.Up(s)
+			again, errAgain := m.Up(s)
+			status, errStatus := m.Status(s)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+				assert.NoError(errSecond)
+				assert.NoError(errAgain)
+				assert.NoError(errStatus)
+			})
+			it("should apply 1, then 2, then nothing", func(assert bdd.Assert) {
+				assert.Equal([]int{1}, first)
+				assert.Equal([]int{2}, second)
+				assert.Empty(again)
+			})
+			it("m.Status(s) should have both applied", func(assert bdd.Assert) {
+				assert.True(status[0].Applied)
+				assert.True(status[1].Applied)
+			})
+		})
+
+		when("run() is called with down 2", func(it bdd.It) {
+			var out bytes.Buffer
+			err := run(m, s, command{name: "down", n: 2}, &out)
+			n, _ := s.DB("").C("products").Count()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should roll back 2, then 1", func(assert bdd.Assert) {
+				assert.Equal("rolled back 2_add_bread\nrolled back 1_create_products\n", out.String())
+				assert.Equal(0, n)
+			})
+		})
+	})
+
+	given(t, "a Migrator m and a lock held by other process", func(when bdd.When, args ...interface{}) {
+		m := newMigrator()
+		s := mongo.Session()
+		_ = m.locks(s).Insert(lock{ID: lockID, Owner: "other", LockedOn: mongo.NowInMilli()})
+
+		when("m.Up(s) is called", func(it bdd.It) {
+			versions, err := m.Up(s)
+			_ = m.locks(s).RemoveId(lockID)
+
+			it("should return ErrLocked", func(assert bdd.Assert) {
+				assert.Equal(ErrLocked, err)
+			})
+			it("should apply nothing", func(assert bdd.Assert) {
+				assert.Empty(versions)
+			})
+		})
+	})
+
+	given(t, "a Migrator m with LockTimeout of 300ms, and a migration lasting 1s", func(when bdd.When, args ...interface{}) {
+		s := mongo.Session()
+		m := &Migrator{Collection: "slow_migrations", LockTimeout: 300 * time.Millisecond}
+		_ = m.Add(Migration{Version: 1, Name: "slow", Up: func(*mgo.Session) error {
+			time.Sleep(time.Second)
+			return nil
+		}})
+
+		when("other Migrator calls Up(s) while m.Up(s) runs", func(it bdd.It) {
+			done := make(chan error)
+			go func() {
+				_, err := m.Up(s)
+				done <- err
+			}()
+
+			time.Sleep(600 * time.Millisecond)
+			other := &Migrator{Collection: m.Collection, LockTimeout: m.LockTimeout}
+			_ = other.Add(m.Migrations()...)
+			_, errOther := other.Up(s)
+			errFirst := <-done
+
+			it("should return ErrLocked to the other", func(assert bdd.Assert) {
+				assert.Equal(ErrLocked, errOther)
+			})
+			it("should finish m.Up(s) without errors", func(assert bdd.Assert) {
+				assert.NoError(errFirst)
+			})
+		})
+	})
+
+	given(t, "a Migrator m with a migration whose lock is taken by other process", func(when bdd.When, args ...interface{}) {
+		s := mongo.Session()
+		m := &Migrator{Collection: "lost_migrations"}
+		_ = m.Add(Migration{Version: 1, Name: "lost", Up: func(s *mgo.Session) error {
+			return m.locks(s).UpdateId(lockID, mongo.M{"$set": mongo.M{"owner": "other"}})
+		}})
+
+		when("m.Up(s) is called", func(it bdd.It) {
+			versions, err := m.Up(s)
+			status, _ := m.Status(s)
+			_ = m.locks(s).RemoveId(lockID)
+
+			it("should return ErrLockLost", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrLockLost))
+			})
+			it("should record nothing", func(assert bdd.Assert) {
+				assert.Empty(versions)
+				assert.False(status[0].Applied)
+			})
+		})
+	})
+}
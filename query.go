@@ -0,0 +1,554 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+var (
+	// ErrInvalidQuery it's an error received when a Query uses an
+	// operator in a way MongoDB would reject.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrUnknownField it's an error received when a Query uses a field
+	// not found on bson tags of the Documenter checked.
+	ErrUnknownField = errors.New("unknown field")
+)
+
+// Q it's an empty Query, used to start building new ones:
+//
+//     mongo.Q.Eq("name", "bread").Gt("price", 1)
+var Q Query
+
+// Query it's an immutable builder of search maps. Each method returns
+// a new Query with the condition added, and errors found are reported
+// when the search map is built with M or MFor.
+type Query struct {
+	conds []condition
+	err   error
+}
+
+// condition it's a single operator applied on a field, or a logical
+// operator applied on queries, when field is empty.
+type condition struct {
+	field string
+	op    string
+	value interface{}
+}
+
+// Eq matches documents where field equals value.
+func (q Query) Eq(field string, value interface{}) (r Query) {
+	r = q.with(field, "", value)
+	return
+}
+
+// Ne matches documents where field doesn't equal value.
+func (q Query) Ne(field string, value interface{}) (r Query) {
+	r = q.with(field, "$ne", value)
+	return
+}
+
+// Gt matches documents where field is greater than value.
+func (q Query) Gt(field string, value interface{}) (r Query) {
+	r = q.with(field, "$gt", value)
+	return
+}
+
+// Gte matches documents where field is greater than or equal to value.
+func (q Query) Gte(field string, value interface{}) (r Query) {
+	r = q.with(field, "$gte", value)
+	return
+}
+
+// Lt matches documents where field is less than value.
+func (q Query) Lt(field string, value interface{}) (r Query) {
+	r = q.with(field, "$lt", value)
+	return
+}
+
+// Lte matches documents where field is less than or equal to value.
+func (q Query) Lte(field string, value interface{}) (r Query) {
+	r = q.with(field, "$lte", value)
+	return
+}
+
+// In matches documents where field equals any of values.
+func (q Query) In(field string, values ...interface{}) (r Query) {
+	r = q.with(field, "$in", values)
+	return
+}
+
+// Nin matches documents where field equals none of values.
+func (q Query) Nin(field string, values ...interface{}) (r Query) {
+	r = q.with(field, "$nin", values)
+	return
+}
+
+// Exists matches documents that have field, or that don't have it,
+// when exists is false.
+func (q Query) Exists(field string, exists bool) (r Query) {
+	r = q.with(field, "$exists", exists)
+	return
+}
+
+// Regex matches documents where field matches pattern, using options
+// as the MongoDB $options.
+func (q Query) Regex(field, pattern, options string) (r Query) {
+	r = q.with(field, "$regex", bson.RegEx{Pattern: pattern, Options: options})
+	return
+}
+
+// Or matches documents matching any of queries.
+func (q Query) Or(queries ...Query) (r Query) {
+	r = q.with("", "$or", queries)
+	return
+}
+
+// And matches documents matching all of queries.
+func (q Query) And(queries ...Query) (r Query) {
+	r = q.with("", "$and", queries)
+	return
+}
+
+// Nor matches documents matching none of queries.
+func (q Query) Nor(queries ...Query) (r Query) {
+	r = q.with("", "$nor", queries)
+	return
+}
+
+// Err returns the first error found on conditions added to Query.
+func (q Query) Err() (err error) {
+	err = q.err
+	return
+}
+
+// M returns the search map built from Query, or the first error found
+// on its conditions.
+func (q Query) M() (m M, err error) {
+	if err = q.err; err != nil {
+		return
+	}
+
+	m = M{}
+	ops := make(map[string]M)
+	for _, c := range q.conds {
+		if err = c.put(m, ops); err != nil {
+			m = nil
+			return
+		}
+	}
+	return
+}
+
+// MFor works as M, but also checks if all fields used by Query are
+// keys of the bson tags of d, or of its Encoder if d implements
+// Encoding, returning ErrUnknownField otherwise.
+// Values compared by equality with deterministic encrypted fields are
+// encrypted as stored, with each key listed by KeyLister, while other
+// comparisons with encrypted fields return ErrEncryptedField.
+func (q Query) MFor(d Documenter) (m M, err error) {
+	if d == nil || reflect.ValueOf(d).IsNil() {
+		err = DocNotDefined
+		return
+	}
+
+	t, keys := reflect.TypeOf(d), encoderOf(d)
+	var fields map[string]encryptedField
+	if err = q.checkFields(t, keys); err == nil {
+		if fields, err = encryptedFields(t, keys); err == nil {
+			if q, err = q.encrypted(fields); err == nil {
+				m, err = q.M()
+			}
+		}
+	}
+	return
+}
+
+// with returns a copy of Query with condition added, recording the
+// first error found on it.
+func (q Query) with(field, op string, value interface{}) (r Query) {
+	r = Query{
+		conds: make([]condition, len(q.conds), len(q.conds)+1),
+		err:   q.err,
+	}
+	copy(r.conds, q.conds)
+
+	c := condition{field: field, op: op, value: value}
+	if r.err == nil {
+		r.err = c.check()
+	}
+
+	r.conds = append(r.conds, c)
+	return
+}
+
+// checkFields checks the fields used by Query, and its subqueries, on
+// type t.
+func (q Query) checkFields(t reflect.Type, keys fieldKeyer) (err error) {
+	for i := 0; i < len(q.conds) && err == nil; i++ {
+		c := q.conds[i]
+		if c.logical() {
+			for _, sub := range c.value.([]Query) {
+				if err = sub.checkFields(t, keys); err != nil {
+					break
+				}
+			}
+		} else if !hasField(t, keys, strings.Split(c.field, ".")) {
+			err = fmt.Errorf("%w %s", ErrUnknownField, c.field)
+		}
+	}
+	return
+}
+
+// encrypted returns a copy of Query, and its subqueries, with values
+// compared with fields encrypted.
+func (q Query) encrypted(fields map[string]encryptedField) (r Query, err error) {
+	if len(fields) == 0 {
+		r = q
+		return
+	}
+
+	r = Query{conds: make([]condition, len(q.conds)), err: q.err}
+	for i := 0; i < len(q.conds) && err == nil; i++ {
+		c := q.conds[i]
+		if c.logical() {
+			subs := c.value.([]Query)
+			encrypted := make([]Query, len(subs))
+			for j := 0; j < len(subs) && err == nil; j++ {
+				encrypted[j], err = subs[j].encrypted(fields)
+			}
+			c.value = encrypted
+		} else if f, found := fields[withoutIndexes(c.field)]; found {
+			c, err = c.encrypted(f)
+		}
+		r.conds[i] = c
+	}
+	return
+}
+
+// withoutIndexes returns field without the indexes of arrays on its
+// path, like items.sku for items.0.sku.
+func withoutIndexes(field string) (r string) {
+	parts := strings.Split(field, ".")
+	keys := parts[:0]
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			keys = append(keys, p)
+		}
+	}
+	r = strings.Join(keys, ".")
+	return
+}
+
+// encrypted returns condition comparing encrypted field f, with its
+// values encrypted as stored. Values encrypted with many keys turn Eq
+// into $in, and Ne into $nin, matching any of them.
+func (c condition) encrypted(f encryptedField) (r condition, err error) {
+	r = c
+	switch {
+	case c.op == "$exists":
+	case c.op != "" && c.op != "$ne" && c.op != "$in" && c.op != "$nin":
+		err = fmt.Errorf("%w: %s with %s", ErrEncryptedField, c.field, c.op)
+	case !f.deterministic:
+		err = fmt.Errorf("%w: %s isn't deterministic", ErrEncryptedField, c.field)
+	default:
+		values := []interface{}{c.value}
+		if c.op == "$in" || c.op == "$nin" {
+			values = c.value.([]interface{})
+		}
+
+		list := make([]interface{}, 0, len(values))
+		for i := 0; i < len(values) && err == nil; i++ {
+			var encrypted []interface{}
+			encrypted, err = encryptQueryValues(values[i], f)
+			list = append(list, encrypted...)
+		}
+
+		switch {
+		case c.op == "$in" || c.op == "$nin":
+			r.value = list
+		case len(list) == 1:
+			r.value = list[0]
+		case c.op == "":
+			r.op, r.value = "$in", list
+		default:
+			r.op, r.value = "$nin", list
+		}
+	}
+	return
+}
+
+// filterFor returns filter with the values compared with encrypted
+// fields of d encrypted, as done by MFor, so M filters match the values
+// stored. Values already encrypted, like the ones of Query, are kept.
+func filterFor(d Documenter, filter M) (out M, err error) {
+	var fields map[string]encryptedField
+	if fields, err = encryptedFields(reflect.TypeOf(d), encoderOf(d)); err == nil {
+		out, err = encryptFilter(filter, fields)
+	}
+	return
+}
+
+// encryptFilter returns filter, and the ones of its logical operators,
+// with the values compared with fields encrypted.
+func encryptFilter(filter M, fields map[string]encryptedField) (out M, err error) {
+	if len(fields) == 0 || len(filter) == 0 {
+		out = filter
+		return
+	}
+
+	out = make(M, len(filter))
+	for k, v := range filter {
+		if k == "$and" || k == "$or" || k == "$nor" {
+			v, err = encryptFilters(v, fields)
+		} else if f, found := fields[withoutIndexes(k)]; found {
+			v, err = encryptFilterValue(k, v, f)
+		}
+
+		if err != nil {
+			out = nil
+			return
+		}
+		out[k] = v
+	}
+	return
+}
+
+// encryptFilters returns v, the filters of a logical operator, with
+// each one encrypted by encryptFilter.
+func encryptFilters(v interface{}, fields map[string]encryptedField) (out interface{}, err error) {
+	switch list := v.(type) {
+	case []M:
+		encrypted := make([]M, len(list))
+		for i := 0; i < len(list) && err == nil; i++ {
+			encrypted[i], err = encryptFilter(list[i], fields)
+		}
+		out = encrypted
+	case []interface{}:
+		encrypted := make([]interface{}, len(list))
+		for i := 0; i < len(list) && err == nil; i++ {
+			encrypted[i] = list[i]
+			if m, ok := asM(list[i]); ok {
+				encrypted[i], err = encryptFilter(m, fields)
+			}
+		}
+		out = encrypted
+	default:
+		out = v
+	}
+	return
+}
+
+// encryptFilterValue returns v, compared with encrypted field f on a
+// filter, encrypted as done for conditions of Query. The v value can
+// be compared by equality, or be a M of operators.
+func encryptFilterValue(field string, v interface{}, f encryptedField) (out interface{}, err error) {
+	ops, isOps := asM(v)
+	isOps = isOps && len(ops) > 0
+	for op := range ops {
+		isOps = isOps && strings.HasPrefix(op, "$")
+	}
+
+	var c condition
+	if !isOps {
+		if c, err = (condition{field: field, value: v}).encrypted(f); err == nil {
+			out = c.value
+			if c.op != "" {
+				out = M{c.op: c.value}
+			}
+		}
+		return
+	}
+
+	names := make([]string, 0, len(ops))
+	for op := range ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	encrypted := make(M, len(ops))
+	for _, op := range names {
+		c = condition{field: field, op: op, value: ops[op]}
+		if op == "$eq" {
+			c.op = ""
+		}
+		if op == "$in" || op == "$nin" {
+			var ok bool
+			if c.value, ok = interfaces(ops[op]); !ok {
+				err = fmt.Errorf("%w: %s with %s needs a list", ErrInvalidQuery, field, op)
+				return
+			}
+		}
+
+		if c, err = c.encrypted(f); err != nil {
+			return
+		}
+		if c.op == "" {
+			c.op = "$eq"
+		}
+
+		// $ne and $nin both turn into $nin, excluding values of both.
+		prev, dup := encrypted[c.op]
+		switch {
+		case dup && c.op == "$nin":
+			c.value = append(prev.([]interface{}), c.value.([]interface{})...)
+		case dup:
+			err = fmt.Errorf("%w: field %s uses %s twice", ErrInvalidQuery, field, c.op)
+			return
+		}
+		encrypted[c.op] = c.value
+	}
+	out = encrypted
+	return
+}
+
+// asM returns v as M, if it's a M or a map of same type.
+func asM(v interface{}) (m M, ok bool) {
+	switch x := v.(type) {
+	case M:
+		m, ok = x, true
+	case map[string]interface{}:
+		m, ok = M(x), true
+	}
+	return
+}
+
+// interfaces returns the values of v, a slice or array, as a list.
+func interfaces(v interface{}) (list []interface{}, ok bool) {
+	if list, ok = v.([]interface{}); ok {
+		return
+	}
+
+	rv := reflect.ValueOf(v)
+	if ok = rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array; ok {
+		list = make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+	}
+	return
+}
+
+// logical returns true if condition applies an operator on queries.
+func (c condition) logical() (r bool) {
+	_, r = c.value.([]Query)
+	r = r && c.field == ""
+	return
+}
+
+// check returns an error if condition would be rejected by MongoDB.
+func (c condition) check() (err error) {
+	switch {
+	case c.logical() && len(c.value.([]Query)) == 0:
+		err = fmt.Errorf("%w: %s needs at least one query", ErrInvalidQuery, c.op)
+	case c.logical():
+		for _, sub := range c.value.([]Query) {
+			if err = sub.err; err != nil {
+				break
+			}
+		}
+	case c.field == "":
+		err = fmt.Errorf("%w: field can't be empty", ErrInvalidQuery)
+	case strings.HasPrefix(c.field, "$"):
+		err = fmt.Errorf("%w: field %s can't start with $", ErrInvalidQuery, c.field)
+	case strings.Contains(c.field, ".."), strings.HasSuffix(c.field, "."), strings.HasPrefix(c.field, "."):
+		err = fmt.Errorf("%w: field %s has an empty key", ErrInvalidQuery, c.field)
+	}
+	return
+}
+
+// put adds condition on search map m, returning an error if it
+// conflicts with conditions already added. The operators of each field
+// are kept on ops.
+func (c condition) put(m M, ops map[string]M) (err error) {
+	if c.logical() {
+		subs := c.value.([]Query)
+		built := make([]M, len(subs))
+		for i := 0; i < len(subs) && err == nil; i++ {
+			built[i], err = subs[i].M()
+		}
+
+		if err != nil {
+			return
+		}
+
+		list, found := m[c.op].([]M)
+		switch {
+		case !found:
+			m[c.op] = built
+		case c.op == "$or":
+			// Two $or must both match, so the new one goes to $and.
+			and, _ := m["$and"].([]M)
+			m["$and"] = append(and, M{"$or": built})
+		default:
+			m[c.op] = append(list, built...)
+		}
+		return
+	}
+
+	_, found := m[c.field]
+	fieldOps, hasOps := ops[c.field]
+
+	switch {
+	case !found && c.op == "":
+		m[c.field] = c.value
+	case !found:
+		ops[c.field] = M{c.op: c.value}
+		m[c.field] = ops[c.field]
+	case c.op == "" || !hasOps:
+		err = fmt.Errorf("%w: field %s has conflicting conditions", ErrInvalidQuery, c.field)
+	default:
+		if _, dup := fieldOps[c.op]; dup {
+			err = fmt.Errorf("%w: field %s uses %s twice", ErrInvalidQuery, c.field, c.op)
+		} else {
+			fieldOps[c.op] = c.value
+		}
+	}
+	return
+}
+
+// hasField returns true if the path of keys, told by keys, exists on
+// type t. Paths going through maps, interfaces and array indexes are
+// accepted.
+func hasField(t reflect.Type, keys fieldKeyer, path []string) (ok bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		if t.Kind() != reflect.Ptr && len(path) > 0 {
+			if _, err := strconv.Atoi(path[0]); err == nil {
+				path = path[1:]
+			}
+		}
+		t = t.Elem()
+	}
+
+	switch {
+	case len(path) == 0:
+		ok = true
+	case t.Kind() == reflect.Map, t.Kind() == reflect.Interface:
+		ok = true
+	case t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}):
+		ok = false
+	default:
+		for i := 0; i < t.NumField() && !ok; i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			name, inline := keys.FieldKey(sf)
+			switch {
+			case name == "-":
+			case inline:
+				ok = hasField(sf.Type, keys, path)
+			case name == path[0]:
+				ok = hasField(sf.Type, keys, path[1:])
+			}
+		}
+	}
+	return
+}
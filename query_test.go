@@ -0,0 +1,164 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// Feature Build search maps with Query
+// - As a developer,
+// - I want to build search maps with a typed Query,
+// - So that mistakes on operators and fields are caught.
+func Test_Build_search_maps_with_Query(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a Query q built with %[1]v", func(when bdd.When, args ...interface{}) {
+		q := args[1].(Query)
+
+		when("q.M() is called", func(it bdd.It) {
+			m, err := q.M()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should return %[3]v", func(assert bdd.Assert) {
+				assert.Equal(args[2].(M), m)
+			})
+		})
+	}, like(
+		s("Eq and Gt", Q.Eq("name", "bread").Gt("price", 1), M{
+			"name":  "bread",
+			"price": M{"$gt": 1},
+		}),
+		s("Gte and Lt on the same field", Q.Gte("price", 1).Lt("price", 5), M{
+			"price": M{"$gte": 1, "$lt": 5},
+		}),
+		s("In and Exists", Q.In("kind", "food", "drink").Exists("price", true), M{
+			"kind":  M{"$in": []interface{}{"food", "drink"}},
+			"price": M{"$exists": true},
+		}),
+		s("Or", Q.Or(Q.Eq("name", "bread"), Q.Lt("price", 1)), M{
+			"$or": []M{{"name": "bread"}, {"price": M{"$lt": 1}}},
+		}),
+		s("Or twice", Q.Or(Q.Eq("a", 1)).Or(Q.Eq("b", 2)), M{
+			"$or":  []M{{"a": 1}},
+			"$and": []M{{"$or": []M{{"b": 2}}}},
+		}),
+	))
+
+	given(t, "a Query q built with %[1]v", func(when bdd.When, args ...interface{}) {
+		q := args[1].(Query)
+
+		when("q.M() is called", func(it bdd.It) {
+			m, err := q.M()
+
+			it("should return an error matching ErrInvalidQuery", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrInvalidQuery))
+				assert.True(errors.Is(q.Err(), ErrInvalidQuery) || q.Err() == nil)
+			})
+			it("should return a nil map", func(assert bdd.Assert) {
+				assert.Nil(m)
+			})
+		})
+	}, like(
+		s("an operator as field", Q.Eq("$where", "true")),
+		s("an empty key on field", Q.Gt("address..street", 1)),
+		s("an empty Or", Q.Or()),
+		s("an invalid query inside And", Q.And(Q.Eq("", 1))),
+		s("Eq and Gt on the same field", Q.Eq("price", 1).Gt("price", 0)),
+		s("Gt twice on the same field", Q.Gt("price", 1).Gt("price", 2)),
+	))
+
+	given(t, "a Query q and the base Query it was built from", func(when bdd.When, args ...interface{}) {
+		base := Q.Eq("name", "bread")
+		q := base.Gt("price", 1)
+
+		when("base.M() is called", func(it bdd.It) {
+			m, _ := base.M()
+
+			it("should not have the condition added on q", func(assert bdd.Assert) {
+				assert.Equal(M{"name": "bread"}, m)
+			})
+			it("q.M() should have both conditions", func(assert bdd.Assert) {
+				m, _ := q.M()
+				assert.Len(m, 2)
+			})
+		})
+	})
+}
+
+// Feature Check Query fields against a Documenter
+// - As a developer,
+// - I want Query to check fields on bson tags of my documents,
+// - So that typos on field names don't fail silently.
+func Test_Check_Query_fields_against_a_Documenter(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a Query q using field '%[1]v'", func(when bdd.When, args ...interface{}) {
+		q := Q.Eq(args[0].(string), 1)
+
+		when("q.MFor() is called with a customer", func(it bdd.It) {
+			_, err := q.MFor(&customer{})
+
+			it("should match ErrUnknownField: %[2]v", func(assert bdd.Assert) {
+				assert.Equal(args[1].(bool), errors.Is(err, ErrUnknownField))
+			})
+		})
+	}, like(
+		s("name", false), s("_id", false), s("created_on", false),
+		s("address.street", false), s("tags.0", false),
+		s("nome", true), s("address.number", true), s("NameV", true),
+	))
+
+	given(t, "a Query q with an unknown field inside Or", func(when bdd.When, args ...interface{}) {
+		q := Q.Or(Q.Eq("name", "bread"), Q.Eq("nome", "bread"))
+
+		when("q.MFor() is called with a customer", func(it bdd.It) {
+			_, err := q.MFor(&customer{})
+
+			it("should return an error matching ErrUnknownField", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrUnknownField))
+			})
+		})
+
+		when("q.MFor() is called with nil", func(it bdd.It) {
+			_, err := q.MFor(nil)
+
+			it("should return DocNotDefined", func(assert bdd.Assert) {
+				assert.Equal(DocNotDefined, err)
+			})
+		})
+	})
+
+	given(t, "a Handle h of customers", func(when bdd.When, args ...interface{}) {
+		h := &Handle{}
+		h.SetDocument(&customer{})
+		h.SearchFor(M{"name": "old"})
+
+		when("h.Where() is called with a Query on unknown field", func(it bdd.It) {
+			err := h.Where(Q.Eq("nome", "bread"))
+
+			it("should return an error matching ErrUnknownField", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrUnknownField))
+			})
+			it("should keep the search map", func(assert bdd.Assert) {
+				assert.Equal(M{"name": "old"}, h.SearchMap())
+			})
+		})
+
+		when("h.Where() is called with a valid Query", func(it bdd.It) {
+			err := h.Where(Q.Eq("name", "bread"))
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should set the search map", func(assert bdd.Assert) {
+				assert.Equal(M{"name": "bread"}, h.SearchMap())
+			})
+		})
+	})
+}
@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"encoding/binary"
+
+	"github.com/ddspog/mongo/internal/bsonutils"
+)
+
+// RawDocument it's a BSON document kept as the bytes received, with
+// its fields looked up by dotted paths, without decoding it whole.
+type RawDocument = bsonutils.RawDocument
+
+// RawValue it's a BSON value of a RawDocument, with typed accessors.
+type RawValue = bsonutils.RawValue
+
+// ErrCorrupted it's an error received when a BSON buffer isn't a valid
+// document.
+var ErrCorrupted = bsonutils.ErrCorrupted
+
+// NewRawDocument returns data as a RawDocument, checking it's a valid
+// BSON document.
+func NewRawDocument(data []byte) (d RawDocument, err error) {
+	d, err = bsonutils.NewRawDocument(data)
+	return
+}
+
+// popRaw returns the number on key of document raw, and raw without
+// it. The other elements are kept in order.
+func popRaw(raw RawDocument, key string) (f float64, out RawDocument, err error) {
+	out = make(RawDocument, 4, len(raw))
+
+	err = raw.Each(func(name []byte, v RawValue) bool {
+		if string(name) == key {
+			f, _ = v.Float64()
+		} else {
+			out = append(append(append(out, v.Kind), name...), 0)
+			out = append(out, v.Data...)
+		}
+		return true
+	})
+
+	out = append(out, 0)
+	binary.LittleEndian.PutUint32(out, uint32(len(out)))
+	return
+}
@@ -0,0 +1,165 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/ddspog/mongo/internal/bsonutils"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Feature Read fields of raw documents
+// - As a developer,
+// - I want to look up fields of BSON documents without decoding them,
+// - So that I could read only what I need from large documents.
+func Test_Read_fields_of_raw_documents(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a RawDocument d with nested documents and arrays", func(when bdd.When, args ...interface{}) {
+		on := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+		data, _ := bsonutils.Marshal(bson.D{
+			{Name: "_id", Value: ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b")},
+			{Name: "name", Value: "box"},
+			{Name: "on", Value: on},
+			{Name: "items", Value: []bson.D{
+				{{Name: "sku", Value: "a"}, {Name: "price", Value: decimal("1.50")}},
+				{{Name: "sku", Value: "b"}, {Name: "qty", Value: 3}},
+			}},
+			{Name: "ok", Value: true},
+		})
+		d, err := NewRawDocument(data)
+
+		when("NewRawDocument(data) is called", func(it bdd.It) {
+			it("should accept the buffer", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+		})
+
+		when("d.Keys() is called", func(it bdd.It) {
+			keys, errKeys := d.Keys()
+
+			it("should return the keys in order", func(assert bdd.Assert) {
+				assert.NoError(errKeys)
+				assert.Equal([]string{"_id", "name", "on", "items", "ok"}, keys)
+			})
+		})
+
+		when("d.Lookup() is called with paths of many types", func(it bdd.It) {
+			id, foundID := d.Lookup("_id")
+			oid, _ := id.ObjectId()
+			name, _ := d.Lookup("name")
+			s, okS := name.StringValue()
+			date, _ := d.Lookup("on")
+			tm, _ := date.Time()
+			price, _ := d.Lookup("items.0.price")
+			dec, okDec := price.Decimal128()
+			qty, _ := d.Lookup("items.1.qty")
+			n, okN := qty.Int64()
+			ok, _ := d.Lookup("ok")
+			b, _ := ok.Bool()
+
+			it("should return each value with its type", func(assert bdd.Assert) {
+				assert.True(foundID)
+				assert.Equal(ObjectIdHex("5a1c2f0e9d1b2c3d4e5f6a7b"), oid)
+				assert.True(okS)
+				assert.Equal("box", s)
+				assert.True(tm.Equal(on))
+				assert.True(okDec)
+				assert.Equal("1.50", dec.String())
+				assert.True(okN)
+				assert.Equal(int64(3), n)
+				assert.True(b)
+			})
+
+			_, okWrong := name.Int64()
+
+			it("should refuse accessors of other types", func(assert bdd.Assert) {
+				assert.False(okWrong)
+			})
+		})
+
+		when("d.Lookup() is called with missing paths", func(it bdd.It) {
+			_, foundKey := d.Lookup("missing")
+			_, foundIndex := d.Lookup("items.2.sku")
+			_, foundScalar := d.Lookup("name.first")
+
+			it("should not find them", func(assert bdd.Assert) {
+				assert.False(foundKey)
+				assert.False(foundIndex)
+				assert.False(foundScalar)
+			})
+		})
+
+		when("a value of d is unmarshalled into a struct", func(it bdd.It) {
+			var item struct {
+				SKU   string     `bson:"sku"`
+				Price Decimal128 `bson:"price"`
+			}
+			v, _ := d.Lookup("items.0")
+			errItem := v.Unmarshal(&item)
+
+			it("should decode only that value", func(assert bdd.Assert) {
+				assert.NoError(errItem)
+				assert.Equal("a", item.SKU)
+				assert.Equal("1.50", item.Price.String())
+			})
+		})
+
+		when("d is a field of a struct marshalled and unmarshalled", func(it bdd.It) {
+			type holder struct {
+				Doc RawDocument `bson:"doc"`
+			}
+			buf, errMarshal := bsonutils.Marshal(holder{Doc: d})
+			var h holder
+			errUnmarshal := bsonutils.Unmarshal(buf, &h)
+			name, _ := h.Doc.Lookup("name")
+			s, _ := name.StringValue()
+
+			it("should keep the document as it is", func(assert bdd.Assert) {
+				assert.NoError(errMarshal)
+				assert.NoError(errUnmarshal)
+				assert.Equal("box", s)
+			})
+		})
+	})
+}
+
+// Feature Detect corrupted raw documents
+// - As a developer,
+// - I want invalid BSON buffers refused,
+// - So that I don't read garbage from corrupted data.
+func Test_Detect_corrupted_raw_documents(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	valid, _ := bsonutils.Marshal(bson.D{
+		{Name: "name", Value: "box"},
+		{Name: "nested", Value: bson.D{{Name: "ok", Value: true}}},
+	})
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+
+	given(t, "a buffer b that is %[1]s", func(when bdd.When, args ...interface{}) {
+		b := args[1].([]byte)
+
+		when("NewRawDocument(b) is called", func(it bdd.It) {
+			_, err := NewRawDocument(b)
+
+			it("should return ErrCorrupted", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrCorrupted))
+			})
+		})
+	}, like(
+		s("too short", []byte{5, 0, 0}),
+		s("with wrong declared size", corrupt(func(b []byte) []byte { b[0]++; return b })),
+		s("truncated", corrupt(func(b []byte) []byte { b = b[:len(b)-3]; b[0] -= 3; return b })),
+		s("missing its terminator", corrupt(func(b []byte) []byte { b[len(b)-1] = 1; return b })),
+		s("with an unknown kind", corrupt(func(b []byte) []byte { b[4] = 0x42; return b })),
+		s("with a bad string size", corrupt(func(b []byte) []byte { b[4+1+5] = 0x7f; return b })),
+		s("with a bad boolean", corrupt(func(b []byte) []byte { b[len(b)-3] = 2; return b })),
+	))
+}
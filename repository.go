@@ -0,0 +1,262 @@
+package mongo
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Repository it's a stateless alternative to Handle. It stores only
+// the collection name, indexes and a Documenter used as prototype of
+// documents returned, receiving documents and filters as arguments of
+// each method. Each operation uses its own cloned session, so a single
+// Repository can be shared by all goroutines. Values of filters
+// compared with encrypted fields of prototype are encrypted, as done
+// by Query.MFor.
+type Repository struct {
+	name      string
+	prototype Documenter
+	indexes   []mgo.Index
+
+	mu        sync.Mutex
+	indexErr  error
+	schemaErr error
+}
+
+// NewRepository creates a new Repository on collection name, returning
+// documents of the same type of prototype, created with its New method.
+// The optional indexes are loaded onto collection on the first
+// operation, with any error reported by IndexErr, as the schema of
+// prototype when enabled by SetSchemaValidation, reported by SchemaErr.
+func NewRepository(name string, prototype Documenter, indexes ...mgo.Index) (r *Repository) {
+	r = &Repository{
+		name:      name,
+		prototype: prototype,
+		indexes:   indexes,
+	}
+
+	defaultIndexes.Declare(name, indexes...)
+	return
+}
+
+// Name returns the name of collection used by Repository.
+func (r *Repository) Name() (n string) {
+	n = r.name
+	return
+}
+
+// IndexErr returns the error received loading the indexes of
+// Repository onto collection.
+func (r *Repository) IndexErr() (err error) {
+	r.mu.Lock()
+	err = r.indexErr
+	r.mu.Unlock()
+	return
+}
+
+// Count returns the number of documents on collection matching
+// filter. A nil filter matches all documents.
+func (r *Repository) Count(filter M) (n int, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		n, err = c.Find(filter).Count()
+		return
+	})
+	return
+}
+
+// Find search for a document on collection matching filter.
+func (r *Repository) Find(filter M) (out Documenter, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		var raw bson.Raw
+		if err = c.Find(filter).One(&raw); err == nil {
+			out, err = r.initRaw(raw.Data)
+		}
+		return
+	})
+	return
+}
+
+// FindAll search for all documents on collection matching filter.
+// Accepts options to alter result.
+func (r *Repository) FindAll(filter M, opts ...QueryOptions) (out []Documenter, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		qry := c.Find(filter)
+
+		if len(opts) == 1 && opts[0].Sort != nil {
+			qry = qry.Sort(opts[0].Sort...)
+		}
+
+		var result []bson.Raw
+		if err = qry.All(&result); err == nil {
+			out = make([]Documenter, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				out[i], err = r.initRaw(result[i].Data)
+			}
+		}
+		return
+	})
+	return
+}
+
+// Insert puts document d on collection, defining its id, if empty,
+// and created_on. The document it's checked by ValidateStruct and its
+// Validate method before.
+func (r *Repository) Insert(d Documenter) (err error) {
+	if err = r.check(d); err != nil {
+		return
+	}
+
+	if d.ID() == "" {
+		d.GenerateID()
+	}
+
+	d.CalculateCreatedOn()
+
+	var mapped M
+	if mapped, err = r.mapped(d); err == nil {
+		mapped["_id"] = d.ID()
+		mapped["created_on"] = currentTimeFormat().Value(d.CreatedOn())
+
+		err = r.consume(func(c *mgo.Collection) error {
+			return c.Insert(mapped)
+		})
+	}
+	return
+}
+
+// Update replaces the document matching id with document d, defining
+// its updated_on. The document it's checked by ValidateStruct and its
+// Validate method before.
+func (r *Repository) Update(id ObjectId, d Documenter) (err error) {
+	if id == "" {
+		err = ErrIDNotDefined
+		return
+	}
+
+	if err = r.check(d); err != nil {
+		return
+	}
+
+	d.CalculateUpdatedOn()
+
+	var mapped M
+	if mapped, err = r.mapped(d); err == nil {
+		delete(mapped, "_id")
+		mapped["updated_on"] = currentTimeFormat().Value(d.UpdatedOn())
+
+		err = r.consume(func(c *mgo.Collection) error {
+			return c.UpdateId(id, mapped)
+		})
+	}
+	return
+}
+
+// Remove delete the document matching id on collection.
+func (r *Repository) Remove(id ObjectId) (err error) {
+	if id == "" {
+		err = ErrIDNotDefined
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) error {
+		return c.RemoveId(id)
+	})
+	return
+}
+
+// RemoveAll delete all documents on collection matching filter. A nil
+// filter matches all documents.
+func (r *Repository) RemoveAll(filter M) (info *mgo.ChangeInfo, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		info, err = c.RemoveAll(filter)
+		return
+	})
+	return
+}
+
+// consume runs f with the collection of Repository on a cloned
+// session, loading indexes and schema before if needed. Errors
+// returned by f are translated with wrapErr.
+func (r *Repository) consume(f func(*mgo.Collection) error) (err error) {
+	r.ensureIndexes()
+	r.ensureSchema()
+
+	ConsumeDatabaseOnSession(func(db *mgo.Database) {
+		if db == nil {
+			err = ErrNotConnected
+			return
+		}
+
+		err = wrapErr(r.name, f(db.C(r.name)))
+	})
+	return
+}
+
+// ensureIndexes syncs the indexes of Repository with collection,
+// using the IndexManager returned by Indexes.
+func (r *Repository) ensureIndexes() {
+	if len(r.indexes) == 0 {
+		return
+	}
+
+	err := defaultIndexes.Sync(r.name)
+
+	r.mu.Lock()
+	r.indexErr = err
+	r.mu.Unlock()
+}
+
+// check returns DocNotDefined if d is nil, or the errors found
+// validating d.
+func (r *Repository) check(d Documenter) (err error) {
+	if d == nil || reflect.ValueOf(d).IsNil() {
+		err = DocNotDefined
+	} else {
+		err = validateDocument(Bind(d))
+	}
+	return
+}
+
+// mapped returns document d mapped, with its times on the TimeFormat
+// of connection.
+func (r *Repository) mapped(d Documenter) (m M, err error) {
+	if m, err = Bind(d).Map(); err == nil {
+		currentTimeFormat().storeTimes(m)
+	}
+	return
+}
+
+// initRaw creates a new document from prototype, filled with the
+// document raw, read from collection, straight when the document
+// supports it, or through a M given to Init.
+func (r *Repository) initRaw(raw RawDocument) (d Documenter, err error) {
+	d = Bind(r.prototype.New())
+
+	var decoded bool
+	if decoded, err = decodeDocument(d, raw, currentTimeFormat()); !decoded {
+		var m M
+		if m, err = UnmarshalToM(raw); err == nil {
+			currentTimeFormat().loadTimes(m)
+			err = d.Init(m)
+		}
+	}
+	return
+}
@@ -0,0 +1,98 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// newProductRepository returns a Repository storing products.
+func newProductRepository() (r *Repository) {
+	r = NewRepository("products", newProduct(), mgo.Index{
+		Key: []string{"created_on"},
+	})
+	return
+}
+
+// Feature Query documents with a stateless Repository
+// - As a developer,
+// - I want to pass documents and filters to each operation,
+// - So that I can share a Repository between goroutines.
+func Test_Query_documents_with_a_stateless_Repository(t *testing.T) {
+	defer cleanChanges()
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a Repository r and products collection with documents "+colFixtures, func(when bdd.When, args ...interface{}) {
+		r := newProductRepository()
+
+		when("r.Find() is called with _id '%[1]v'", func(it bdd.It) {
+			d, err := r.Find(M{"_id": ObjectIdHex(args[0].(string))})
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("d.ID().Hex() should return %[1]v", func(assert bdd.Assert) {
+				assert.Equal(args[0].(string), d.ID().Hex())
+			})
+			it("r.IndexErr() should return no errors", func(assert bdd.Assert) {
+				assert.NoError(r.IndexErr())
+			})
+		})
+	}, like(
+		s(id1), s(id2), s(id3),
+	))
+
+	given(t, "a Repository r shared by 10 goroutines", func(when bdd.When, args ...interface{}) {
+		r := newProductRepository()
+
+		when("each goroutine calls r.Insert() and r.Remove() with its own product", func(it bdd.It) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					p := newProduct()
+					errs <- r.Insert(p)
+					errs <- r.Remove(p.ID())
+				}()
+			}
+
+			wg.Wait()
+			close(errs)
+
+			n, errCount := r.Count(nil)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				for err := range errs {
+					assert.NoError(err)
+				}
+				assert.NoError(errCount)
+			})
+			it("r.Count(nil) should still return the number of fixtures", func(assert bdd.Assert) {
+				assert.Equal(len(fixtures), n)
+			})
+		})
+	})
+
+	given(t, "a Repository r and a nil product", func(when bdd.When, args ...interface{}) {
+		r := newProductRepository()
+
+		when("r.Insert() and r.Update() are called", func(it bdd.It) {
+			var p *product
+			errInsert := r.Insert(p)
+			errUpdate := r.Update(ObjectIdHex(id1), p)
+
+			it("should return DocNotDefined", func(assert bdd.Assert) {
+				assert.Equal(DocNotDefined, errInsert)
+				assert.Equal(DocNotDefined, errUpdate)
+			})
+		})
+	})
+}
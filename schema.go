@@ -0,0 +1,375 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+var (
+	// getterType it's the type of bson.Getter, whose BSON types can't
+	// be told from the Go type.
+	getterType = reflect.TypeOf((*bson.Getter)(nil)).Elem()
+	// timeType it's the type of time.Time, stored as BSON date.
+	timeType = reflect.TypeOf(time.Time{})
+	// objectIDType it's the type of ObjectId, stored as BSON objectId.
+	objectIDType = reflect.TypeOf(ObjectId(""))
+	// decimalType it's the type of Decimal128, stored as BSON decimal.
+	decimalType = reflect.TypeOf(Decimal128{})
+
+	// schemaValidation stores if Handle and Repository apply the schema
+	// of their documents, and the collections already applied.
+	schemaValidation = struct {
+		sync.Mutex
+		enabled bool
+		applied map[string]bool
+	}{
+		applied: make(map[string]bool),
+	}
+)
+
+// JSONSchema returns the $jsonSchema validator of documents like d,
+// derived from its struct. The properties are named by bson tags, or
+// by the keys of its Encoder if d implements Encoding, with BSON types
+// from Go types. Fields with validate tags also have the
+// rules required, min, max and oneof checked. The _id field it's
+// always required, and created_on and updated_on accept the values of
+// any TimeFormat. Fields tagged with mongo:"encrypt" are binary data.
+// Structs nested on themselves are only checked to be objects, from
+// the second level they appear.
+func JSONSchema(d Documenter) (schema M, err error) {
+	if d == nil || reflect.ValueOf(d).IsNil() {
+		err = DocNotDefined
+		return
+	}
+
+	t := indirect(reflect.TypeOf(d))
+	if t.Kind() != reflect.Struct {
+		err = fmt.Errorf("can't derive schema of %s, it isn't a struct", t)
+		return
+	}
+
+	schema = objectSchema(t, encoderOf(d), map[reflect.Type]bool{})
+	for _, key := range []string{"created_on", "updated_on"} {
+		if p, ok := schema["properties"].(M)[key]; ok {
+			p.(M)["bsonType"] = []string{"int", "long", "date"}
+		}
+	}
+
+	if _, ok := schema["properties"].(M)["_id"]; ok {
+		required, _ := schema["required"].([]string)
+		schema["required"] = append([]string{"_id"}, required...)
+	}
+	return
+}
+
+// ApplySchema sets the $jsonSchema of documents like d as validator of
+// collection name, creating it if needed. The server rejects writes
+// of documents not following it, from any client.
+func ApplySchema(name string, d Documenter) (err error) {
+	var schema M
+	if schema, err = JSONSchema(d); err != nil {
+		return
+	}
+
+	consumeDatabase(func(db *mgo.Database) {
+		validator := M{"$jsonSchema": schema}
+
+		err = db.Run(bson.D{
+			{Name: "create", Value: name},
+			{Name: "validator", Value: validator},
+		}, nil)
+
+		if isNamespaceExists(err) {
+			err = db.Run(bson.D{
+				{Name: "collMod", Value: name},
+				{Name: "validator", Value: validator},
+				{Name: "validationLevel", Value: "strict"},
+				{Name: "validationAction", Value: "error"},
+			}, nil)
+		}
+	}, &err)
+
+	err = wrapErr(name, err)
+	return
+}
+
+// ApplySchema sets the $jsonSchema of Document as validator of
+// collection connected to Handle, as done by ApplySchema function.
+func (h *Handle) ApplySchema() (err error) {
+	err = ApplySchema(h.collectionName, h.Document())
+	return
+}
+
+// ApplySchema sets the $jsonSchema of prototype as validator of
+// collection used by Repository, as done by ApplySchema function.
+func (r *Repository) ApplySchema() (err error) {
+	err = ApplySchema(r.name, r.prototype)
+	return
+}
+
+// SetSchemaValidation defines if Handle and Repository apply the
+// $jsonSchema of their documents as validator of collection, as done by
+// ApplySchema, when set up. Handle applies it when created, and
+// Repository on its first operation. Each collection it's applied only
+// once per process, until it succeeds, with any error reported by
+// SchemaErr. It's disabled by default.
+func SetSchemaValidation(enabled bool) {
+	schemaValidation.Lock()
+	schemaValidation.enabled = enabled
+	schemaValidation.applied = make(map[string]bool)
+	schemaValidation.Unlock()
+}
+
+// ensureSchema applies the schema of documents like d as validator of
+// collection name, if enabled by SetSchemaValidation and not applied
+// yet.
+func ensureSchema(name string, d Documenter) (err error) {
+	schemaValidation.Lock()
+	skip := !schemaValidation.enabled || schemaValidation.applied[name]
+	schemaValidation.Unlock()
+
+	if skip {
+		return
+	}
+
+	if err = ApplySchema(name, d); err == nil {
+		schemaValidation.Lock()
+		schemaValidation.applied[name] = true
+		schemaValidation.Unlock()
+	}
+	return
+}
+
+// SchemaErr returns the error received applying the schema of Document
+// as validator of collection, when enabled by SetSchemaValidation.
+func (h *Handle) SchemaErr() (err error) {
+	h.mu.RLock()
+	err = h.schemaErr
+	h.mu.RUnlock()
+	return
+}
+
+// ensureSchema applies the schema of Document as validator of
+// collection, when enabled by SetSchemaValidation. The error received
+// is reported by SchemaErr.
+func (h *Handle) ensureSchema() {
+	if d := h.Document(); d != nil {
+		err := ensureSchema(h.collectionName, d)
+
+		h.mu.Lock()
+		h.schemaErr = err
+		h.mu.Unlock()
+	}
+}
+
+// SchemaErr returns the error received applying the schema of
+// prototype as validator of collection, when enabled by
+// SetSchemaValidation.
+func (r *Repository) SchemaErr() (err error) {
+	r.mu.Lock()
+	err = r.schemaErr
+	r.mu.Unlock()
+	return
+}
+
+// ensureSchema applies the schema of prototype as validator of
+// collection, when enabled by SetSchemaValidation. The error received
+// is reported by SchemaErr.
+func (r *Repository) ensureSchema() {
+	err := ensureSchema(r.name, r.prototype)
+
+	r.mu.Lock()
+	r.schemaErr = err
+	r.mu.Unlock()
+}
+
+// objectSchema returns the schema of struct t, as a BSON object, with
+// properties named by keys. The structs being derived are on seen, so
+// structs nested on themselves aren't derived again.
+func objectSchema(t reflect.Type, keys fieldKeyer, seen map[reflect.Type]bool) (schema M) {
+	properties := M{}
+	var required []string
+
+	seen[t] = true
+	addFields(t, keys, properties, &required, seen)
+	delete(seen, t)
+
+	schema = M{"bsonType": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return
+}
+
+// addFields puts the schema of each field of struct t on properties,
+// adding the required ones to required. Inline structs have their
+// fields added too, unless being derived, on seen.
+func addFields(t reflect.Type, keys fieldKeyer, properties M, required *[]string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name, inline := keys.FieldKey(sf)
+		if name == "-" {
+			continue
+		}
+
+		if inline {
+			if ft := indirect(sf.Type); ft.Kind() == reflect.Struct && !seen[ft] {
+				seen[ft] = true
+				addFields(ft, keys, properties, required, seen)
+				delete(seen, ft)
+			}
+			continue
+		}
+
+		p := typeSchema(sf.Type, keys, seen)
+		if applyRules(p, sf.Type, sf.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+
+		if encrypted, _ := encryptOption(sf); encrypted {
+			// The server only sees the binary of encrypted values.
+			p = M{"bsonType": "binData"}
+		}
+
+		properties[name] = p
+	}
+}
+
+// typeSchema returns the schema of values of type t, with properties
+// named by keys. Structs being derived, on seen, are only checked to be
+// objects.
+func typeSchema(t reflect.Type, keys fieldKeyer, seen map[reflect.Type]bool) (schema M) {
+	schema = M{}
+
+	if indirect(t) == decimalType {
+		schema["bsonType"] = "decimal"
+		return
+	}
+
+	if t.Implements(getterType) || reflect.PtrTo(t).Implements(getterType) {
+		return
+	}
+
+	switch t = indirect(t); {
+	case t == timeType:
+		schema["bsonType"] = "date"
+	case t == objectIDType:
+		schema["bsonType"] = "objectId"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema["bsonType"] = "binData"
+	}
+
+	if _, ok := schema["bsonType"]; ok {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema["bsonType"] = "string"
+	case reflect.Bool:
+		schema["bsonType"] = "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["bsonType"] = []string{"int", "long"}
+	case reflect.Float32, reflect.Float64:
+		schema["bsonType"] = []string{"double", "int", "long"}
+	case reflect.Slice, reflect.Array:
+		schema["bsonType"] = "array"
+		if items := typeSchema(t.Elem(), keys, seen); len(items) > 0 {
+			schema["items"] = items
+		}
+	case reflect.Map:
+		schema["bsonType"] = "object"
+	case reflect.Struct:
+		if seen[t] {
+			schema["bsonType"] = "object"
+		} else {
+			schema = objectSchema(t, keys, seen)
+		}
+	}
+	return
+}
+
+// applyRules adds on schema the validate rules of a field of type t,
+// returning if it's required. Rules that can't be checked by server
+// are ignored.
+func applyRules(schema M, t reflect.Type, rules string) (required bool) {
+	for _, rule := range strings.Split(rules, ",") {
+		param := ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			rule, param = rule[:i], rule[i+1:]
+		}
+
+		switch rule {
+		case "required":
+			required = true
+		case "min", "max":
+			if limit, err := strconv.ParseFloat(param, 64); err == nil {
+				if key, count := limitKey(indirect(t), rule); count {
+					schema[key] = int64(limit)
+				} else if key != "" {
+					schema[key] = limit
+				}
+			}
+		case "oneof":
+			if indirect(t).Kind() == reflect.String {
+				schema["enum"] = strings.Fields(param)
+			}
+		}
+	}
+	return
+}
+
+// limitKey returns the schema keyword of rule min or max, for values
+// of type t, and if it limits a count, requiring an integer.
+func limitKey(t reflect.Type, rule string) (key string, count bool) {
+	kind := t.Kind()
+	if t == decimalType {
+		kind = reflect.Float64
+	}
+
+	switch kind {
+	case reflect.String:
+		key, count = rule+"Length", true
+	case reflect.Slice, reflect.Array:
+		key, count = rule+"Items", true
+	case reflect.Map:
+		key, count = rule+"Properties", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if key = "maximum"; rule == "min" {
+			key = "minimum"
+		}
+	}
+	return
+}
+
+// indirect returns the type pointed by t, if it's a pointer.
+func indirect(t reflect.Type) (r reflect.Type) {
+	for r = t; r.Kind() == reflect.Ptr; r = r.Elem() {
+	}
+	return
+}
+
+// isNamespaceExists returns true if err tells the collection already
+// exists.
+func isNamespaceExists(err error) (r bool) {
+	var qe *mgo.QueryError
+	if errors.As(err, &qe) {
+		r = qe.Code == 48 || strings.Contains(qe.Message, "already exists")
+	}
+	return
+}
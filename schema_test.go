@@ -0,0 +1,187 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// category it's a type embedding the Document struct, nested on
+// itself through a pointer and a slice.
+type category struct {
+	Document `bson:",inline"`
+	NameV    string      `bson:"name"`
+	Parent   *category   `bson:"parent,omitempty"`
+	Children []*category `bson:"children"`
+}
+
+// New creates a new category bound to its Document.
+func (c *category) New() (doc Documenter) {
+	doc = Bind(&category{})
+	return
+}
+
+// Validate checks for problems on category.
+func (c *category) Validate() (err error) {
+	return
+}
+
+// Feature Derive JSON Schema from Documenter types
+// - As a developer,
+// - I want a $jsonSchema derived from my document types,
+// - So that the server rejects invalid writes from any client.
+func Test_Derive_JSON_Schema_from_Documenter_types(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "a customer with bson and validate tags", func(when bdd.When, args ...interface{}) {
+		c := &customer{}
+
+		when("JSONSchema(c) is called", func(it bdd.It) {
+			schema, err := JSONSchema(c)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should have the properties with BSON types and rules", func(assert bdd.Assert) {
+				assert.Equal(M{
+					"_id":        M{"bsonType": "objectId"},
+					"created_on": M{"bsonType": []string{"int", "long", "date"}},
+					"updated_on": M{"bsonType": []string{"int", "long", "date"}},
+					"name":       M{"bsonType": "string", "minLength": int64(2), "maxLength": int64(10)},
+					"email":      M{"bsonType": "string"},
+					"age":        M{"bsonType": []string{"int", "long"}, "minimum": 18.0},
+					"plan":       M{"bsonType": "string", "enum": []string{"free", "pro"}},
+					"tags":       M{"bsonType": "array", "items": M{"bsonType": "string"}, "maxItems": int64(2)},
+					"address": M{
+						"bsonType":   "object",
+						"properties": M{"street": M{"bsonType": "string"}},
+						"required":   []string{"street"},
+					},
+				}, schema["properties"])
+			})
+			it("should require _id and name", func(assert bdd.Assert) {
+				assert.Equal("object", schema["bsonType"])
+				assert.Equal([]string{"_id", "name"}, schema["required"])
+			})
+		})
+	})
+
+	given(t, "a place with a Point", func(when bdd.When, args ...interface{}) {
+		p := &place{}
+
+		when("JSONSchema(p) is called", func(it bdd.It) {
+			schema, _ := JSONSchema(p)
+
+			it("loc should accept any value", func(assert bdd.Assert) {
+				assert.Equal(M{}, schema["properties"].(M)["loc"])
+			})
+		})
+
+		when("JSONSchema(nil) is called", func(it bdd.It) {
+			_, err := JSONSchema(nil)
+
+			it("should return DocNotDefined", func(assert bdd.Assert) {
+				assert.Equal(DocNotDefined, err)
+			})
+		})
+	})
+	given(t, "a category nested on itself", func(when bdd.When, args ...interface{}) {
+		c := &category{}
+
+		when("JSONSchema(c) is called", func(it bdd.It) {
+			schema, err := JSONSchema(c)
+			props := schema["properties"].(M)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should check the nested categories only as objects", func(assert bdd.Assert) {
+				assert.Equal(M{"bsonType": "object"}, props["parent"])
+				assert.Equal(M{"bsonType": "array", "items": M{"bsonType": "object"}}, props["children"])
+			})
+		})
+	})
+}
+
+// Feature Validate documents on server
+// - As a developer,
+// - I want the schema applied on collections,
+// - So that other services can't write invalid documents.
+func Test_Validate_documents_on_server(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a Handle h of customers with schema applied twice", func(when bdd.When, args ...interface{}) {
+		h := NewHandle("customers", &customer{})
+		defer h.Close()
+
+		errCreate := h.ApplySchema()
+		errMod := h.ApplySchema()
+
+		when("a customer without name is inserted directly", func(it bdd.It) {
+			var err error
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				err = db.C("customers").Insert(M{"_id": NewID(), "age": 30})
+			})
+
+			it("h.ApplySchema() should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errCreate)
+				assert.NoError(errMod)
+			})
+			it("should be rejected by server", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+
+		when("a valid customer is inserted with h", func(it bdd.It) {
+			h.SetDocument(validCustomer())
+			err := h.Insert()
+
+			it("should be accepted", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+		})
+	})
+	given(t, "schema validation enabled by SetSchemaValidation", func(when bdd.When, args ...interface{}) {
+		SetSchemaValidation(true)
+		defer SetSchemaValidation(false)
+
+		when("a Handle of customers is created, and a customer without name inserted directly", func(it bdd.It) {
+			h := NewHandle("validated_customers", &customer{})
+			defer h.Close()
+
+			var err error
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				err = db.C("validated_customers").Insert(M{"_id": NewID(), "age": 30})
+			})
+
+			it("h.SchemaErr() should return no errors", func(assert bdd.Assert) {
+				assert.NoError(h.SchemaErr())
+			})
+			it("should be rejected by server", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+
+		when("a Repository of customers counts them, and a customer without name is inserted directly", func(it bdd.It) {
+			r := NewRepository("repository_customers", &customer{})
+			_, errCount := r.Count(nil)
+
+			var err error
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				err = db.C("repository_customers").Insert(M{"_id": NewID(), "age": 30})
+			})
+
+			it("r.SchemaErr() should return no errors", func(assert bdd.Assert) {
+				assert.NoError(errCount)
+				assert.NoError(r.SchemaErr())
+			})
+			it("should be rejected by server", func(assert bdd.Assert) {
+				assert.Error(err)
+			})
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package mongo
+
+import (
+	"sort"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// scoreKey it's the key receiving the textScore of documents found on
+// text searches.
+const scoreKey = "_score"
+
+// TextResult it's a document found on a text search, with the score
+// telling its relevance to the term searched.
+type TextResult struct {
+	Document Documenter
+	Score    float64
+}
+
+// TextIndex returns a text index on the fields with the weights given,
+// using language as default language for stemming. An empty language
+// uses the default of MongoDB, english. The index can be passed to
+// NewHandle or NewRepository.
+func TextIndex(language string, weights map[string]int) (i mgo.Index) {
+	fields := make([]string, 0, len(weights))
+	for f := range weights {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	i = mgo.Index{
+		Key:             make([]string, len(fields)),
+		Weights:         weights,
+		DefaultLanguage: language,
+	}
+
+	for k, f := range fields {
+		i.Key[k] = "$text:" + f
+	}
+	return
+}
+
+// Search finds documents on collection connected to Handle matching
+// term on its text index, and the search map if defined. The results
+// are sorted by relevance, with the score of each document.
+func (h *Handle) Search(term string) (out []TextResult, err error) {
+	var d Documenter
+	if d, err = h.current(); err != nil {
+		return
+	}
+
+	var filter M
+	if filter, err = h.filter(d); err != nil {
+		return
+	}
+
+	var c *mgo.Collection
+	if c, err = h.acquire(); err == nil {
+		defer h.release()
+
+		var result []bson.Raw
+		if err = wrapErr(h.collectionName, textQuery(c, term, filter).All(&result)); err == nil {
+			out = make([]TextResult, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				var doc RawDocument
+				if out[i].Score, doc, err = popScore(result[i].Data); err == nil {
+					out[i].Document = h.newDocument()
+					err = h.initRaw(out[i].Document, doc)
+				}
+			}
+		}
+	}
+	return
+}
+
+// Search finds documents on collection matching term on its text index,
+// and filter if not nil. The results are sorted by relevance, with the
+// score of each document.
+func (r *Repository) Search(term string, filter M) (out []TextResult, err error) {
+	if filter, err = filterFor(r.prototype, filter); err != nil {
+		return
+	}
+
+	err = r.consume(func(c *mgo.Collection) (err error) {
+		var result []bson.Raw
+		if err = textQuery(c, term, filter).All(&result); err == nil {
+			out = make([]TextResult, len(result))
+			for i := 0; i < len(result) && err == nil; i++ {
+				var doc RawDocument
+				if out[i].Score, doc, err = popScore(result[i].Data); err == nil {
+					out[i].Document, err = r.initRaw(doc)
+				}
+			}
+		}
+		return
+	})
+	return
+}
+
+// textQuery returns the query searching term on c, with filter,
+// projecting and sorting by textScore.
+func textQuery(c *mgo.Collection, term string, filter M) (q *mgo.Query) {
+	selector := make(M, len(filter)+1)
+	for k, v := range filter {
+		selector[k] = v
+	}
+	selector["$text"] = M{"$search": term}
+
+	q = c.Find(selector).Select(M{
+		scoreKey: M{"$meta": "textScore"},
+	}).Sort("$textScore:" + scoreKey)
+	return
+}
+
+// popScore returns the textScore of document raw, and raw without it.
+func popScore(raw RawDocument) (score float64, doc RawDocument, err error) {
+	score, doc, err = popRaw(raw, scoreKey)
+	return
+}
@@ -0,0 +1,101 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// Feature Declare text indexes
+// - As a developer,
+// - I want to declare text indexes with weights and language,
+// - So that I can search documents by relevance.
+func Test_Declare_text_indexes(t *testing.T) {
+	given := bdd.Sentences().Given()
+
+	given(t, "the weights name: 3 and email: 1", func(when bdd.When, args ...interface{}) {
+		weights := map[string]int{"name": 3, "email": 1}
+
+		when("TextIndex('portuguese', weights) is called", func(it bdd.It) {
+			i := TextIndex("portuguese", weights)
+
+			it("should have a $text key for each field, sorted", func(assert bdd.Assert) {
+				assert.Equal([]string{"$text:email", "$text:name"}, i.Key)
+			})
+			it("should have the weights and language", func(assert bdd.Assert) {
+				assert.Equal(weights, i.Weights)
+				assert.Equal("portuguese", i.DefaultLanguage)
+			})
+		})
+	})
+
+	given(t, "a document raw with a textScore", func(when bdd.When, args ...interface{}) {
+		raw, _ := MarshalM(M{"name": "Jane", scoreKey: 1.5})
+
+		when("popScore(raw) is called", func(it bdd.It) {
+			score, doc, err := popScore(raw)
+			m, _ := UnmarshalToM(doc)
+
+			it("should return 1.5", func(assert bdd.Assert) {
+				assert.NoError(err)
+				assert.Equal(1.5, score)
+			})
+			it("doc should have only the document fields", func(assert bdd.Assert) {
+				assert.Equal(M{"name": "Jane"}, m)
+			})
+		})
+	})
+}
+
+// Feature Search documents by text
+// - As a developer,
+// - I want to search documents by a term,
+// - So that I receive the most relevant ones first.
+func Test_Search_documents_by_text(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a Repository r of customers, with a text index on name and email", func(when bdd.When, args ...interface{}) {
+		r := NewRepository("customers", &customer{}, TextIndex("", map[string]int{
+			"name":  3,
+			"email": 1,
+		}))
+
+		for _, name := range []string{"Jane", "John", "Mary"} {
+			c := validCustomer()
+			c.NameV, c.EmailV = name, "jane@example.com"
+			_ = r.Insert(c)
+		}
+
+		when("r.Search('jane', nil) is called", func(it bdd.It) {
+			out, err := r.Search("jane", nil)
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should return 3 results, the most relevant first", func(assert bdd.Assert) {
+				assert.Len(out, 3)
+				assert.Equal("Jane", out[0].Document.(*customer).NameV)
+				assert.True(out[0].Score > out[1].Score)
+			})
+		})
+
+		when("a Handle h of customers calls h.Search('jane') with search map name: Mary", func(it bdd.It) {
+			h := NewHandle("customers", &customer{})
+			defer h.Close()
+
+			h.SearchFor(M{"name": "Mary"})
+			out, err := h.Search("jane")
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.NoError(err)
+			})
+			it("should return only Mary", func(assert bdd.Assert) {
+				assert.Len(out, 1)
+				assert.Equal("Mary", out[0].Document.(*customer).NameV)
+			})
+		})
+	})
+}
@@ -0,0 +1,251 @@
+package mongo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// TimeFormat it's the representation used to store created_on and
+// updated_on values of documents on MongoDB. Documenter types always
+// hold these values as int64 in Millisecond unit, being converted
+// when written and read by Handle.
+type TimeFormat int
+
+const (
+	// Millis stores times as int64 values in Millisecond unit. It's
+	// the format used by default.
+	Millis TimeFormat = iota + 1
+	// Seconds stores times as int64 values in Second unit, the Unix
+	// time.
+	Seconds
+	// DateTime stores times as BSON datetime values, allowing use of
+	// TTL indexes and date aggregation operators.
+	DateTime
+)
+
+const (
+	// timeFormatMigrations it's the collection recording the last
+	// MigrateTimeFormat of each collection.
+	timeFormatMigrations = "time_format_migrations"
+	// migratingField it's the field marking documents converted by a
+	// MigrateTimeFormat not finished.
+	migratingField = "_migrating_time_format"
+)
+
+var (
+	// timeFormat stores the TimeFormat used by connection.
+	timeFormat = struct {
+		sync.RWMutex
+		f TimeFormat
+	}{
+		f: Millis,
+	}
+)
+
+// SetTimeFormat defines the TimeFormat used by connection to store
+// created_on and updated_on values. Receiving an invalid format, it
+// returns to use Millis.
+func SetTimeFormat(f TimeFormat) {
+	if !f.valid() {
+		f = Millis
+	}
+
+	timeFormat.Lock()
+	timeFormat.f = f
+	timeFormat.Unlock()
+}
+
+// currentTimeFormat returns the TimeFormat used by connection.
+func currentTimeFormat() (f TimeFormat) {
+	timeFormat.RLock()
+	f = timeFormat.f
+	timeFormat.RUnlock()
+	return
+}
+
+// valid checks if f is one of the formats known.
+func (f TimeFormat) valid() (r bool) {
+	r = f == Millis || f == Seconds || f == DateTime
+	return
+}
+
+// Value returns the time ms, in Millisecond unit, represented on
+// format f to be stored.
+func (f TimeFormat) Value(ms int64) (v interface{}) {
+	switch f {
+	case Seconds:
+		v = ms / 1000
+	case DateTime:
+		v = time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+	default:
+		v = ms
+	}
+	return
+}
+
+// Milli returns the time in Millisecond unit of value v, stored on
+// format f. Datetime values are read on any format. It returns false
+// if v isn't a time value.
+func (f TimeFormat) Milli(v interface{}) (ms int64, ok bool) {
+	ok = true
+
+	switch t := v.(type) {
+	case time.Time:
+		ms = inMilli(t)
+		return
+	case int64:
+		ms = t
+	case int:
+		ms = int64(t)
+	case int32:
+		ms = int64(t)
+	case float64:
+		ms = int64(t)
+	default:
+		ok = false
+		return
+	}
+
+	if f == Seconds {
+		ms *= 1000
+	}
+	return
+}
+
+// storeTimes converts created_on and updated_on values on m, from
+// Millisecond unit to format f.
+func (f TimeFormat) storeTimes(m M) {
+	for _, k := range []string{"created_on", "updated_on"} {
+		if ms, ok := m[k].(int64); ok {
+			m[k] = f.Value(ms)
+		}
+	}
+}
+
+// loadTimes converts created_on and updated_on values on m, from
+// format f to Millisecond unit.
+func (f TimeFormat) loadTimes(m M) {
+	for _, k := range []string{"created_on", "updated_on"} {
+		if v, found := m[k]; found {
+			if ms, ok := f.Milli(v); ok {
+				m[k] = ms
+			}
+		}
+	}
+}
+
+// loadRawTimes sets created_on and updated_on of s with the values on
+// raw, converted from format f to Millisecond unit.
+func (f TimeFormat) loadRawTimes(raw RawDocument, s Stamper) {
+	if ms, ok := f.rawMilli(raw, "created_on"); ok {
+		s.SetCreatedOn(ms)
+	}
+	if ms, ok := f.rawMilli(raw, "updated_on"); ok {
+		s.SetUpdatedOn(ms)
+	}
+}
+
+// rawMilli returns the time in Millisecond unit of key on raw, stored
+// on format f. It returns false if key isn't a time value.
+func (f TimeFormat) rawMilli(raw RawDocument, key string) (ms int64, ok bool) {
+	var v interface{}
+	if rv, found := raw.Lookup(key); found && rv.Unmarshal(&v) == nil {
+		ms, ok = f.Milli(v)
+	}
+	return
+}
+
+// MigrateTimeFormat converts created_on and updated_on values of every
+// document on collection name, stored on format from, to format to.
+// It returns the number of documents updated.
+//
+// Each document converted is marked on the same update, and the
+// migration finished is recorded on the time_format_migrations
+// collection, so it can be run again after failing, or after being
+// finished, without converting any document twice.
+func MigrateTimeFormat(name string, from, to TimeFormat) (n int, err error) {
+	ConsumeDatabaseOnSession(func(db *mgo.Database) {
+		if db == nil {
+			err = ErrNotConnected
+			return
+		}
+
+		c, record := db.C(name), db.C(timeFormatMigrations)
+		mark := fmt.Sprintf("%d-%d", from, to)
+
+		var last struct {
+			Mark string `bson:"mark"`
+			Done bool   `bson:"done"`
+		}
+		if err = record.FindId(name).One(&last); err == mgo.ErrNotFound {
+			err = nil
+		}
+
+		if err == nil && (last.Mark != mark || !last.Done) {
+			if _, err = record.UpsertId(name, M{"mark": mark, "done": false}); err == nil {
+				n, err = convertTimes(c, from, to, mark)
+			}
+			if err == nil {
+				err = record.UpdateId(name, M{"$set": M{"done": true}})
+			}
+		}
+
+		// Marks are removed only after the migration is recorded as done,
+		// so a failure here is fixed by running it again.
+		if err == nil {
+			_, err = c.UpdateAll(M{migratingField: M{"$exists": true}}, M{
+				"$unset": M{migratingField: 1},
+			})
+		}
+	})
+	return
+}
+
+// convertTimes converts created_on and updated_on values of documents
+// on collection c, not marked with mark yet, from format from to
+// format to, marking them. It returns the number of documents
+// converted.
+func convertTimes(c *mgo.Collection, from, to TimeFormat, mark string) (n int, err error) {
+	iter := c.Find(M{
+		migratingField: M{"$ne": mark},
+		"$or": []M{
+			{"created_on": M{"$exists": true}},
+			{"updated_on": M{"$exists": true}},
+		},
+	}).Select(M{
+		"created_on": 1,
+		"updated_on": 1,
+	}).Iter()
+
+	var doc M
+	for err == nil && iter.Next(&doc) {
+		set := M{}
+		for _, k := range []string{"created_on", "updated_on"} {
+			if ms, ok := from.Milli(doc[k]); ok {
+				set[k] = to.Value(ms)
+			}
+		}
+
+		if len(set) == 0 {
+			continue
+		}
+		set[migratingField] = mark
+
+		// The mark on filter skips documents returned again by the
+		// cursor, after being moved by the update.
+		switch err = c.Update(M{"_id": doc["_id"], migratingField: M{"$ne": mark}}, M{"$set": set}); err {
+		case nil:
+			n++
+		case mgo.ErrNotFound:
+			err = nil
+		}
+	}
+
+	if errIter := iter.Close(); err == nil {
+		err = errIter
+	}
+	return
+}
@@ -0,0 +1,172 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ddspog/bdd"
+	"github.com/globalsign/mgo"
+)
+
+// Feature Represent times on different formats
+// - As a developer,
+// - I want to be able to choose how created_on and updated_on are stored,
+// - So that I could use TTL indexes and date operators on MongoDB.
+func Test_Represent_times_on_different_formats(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a time %[1]v in milliseconds ms", func(when bdd.When, args ...interface{}) {
+		ms := expectedNowInMilli(args[0].(time.Time))
+
+		when("Millis.Value(ms) is called", func(it bdd.It) {
+			v := Millis.Value(ms)
+
+			it("should return ms", func(assert bdd.Assert) {
+				assert.Equal(ms, v)
+			})
+		})
+
+		when("Seconds.Value(ms) is called", func(it bdd.It) {
+			v := Seconds.Value(ms)
+
+			it("should return %[1]v Unix time", func(assert bdd.Assert) {
+				assert.Equal(args[0].(time.Time).Unix(), v)
+			})
+		})
+
+		when("DateTime.Value(ms) is called", func(it bdd.It) {
+			v := DateTime.Value(ms)
+
+			it("should return %[1]v as time.Time", func(assert bdd.Assert) {
+				assert.Equal(args[0].(time.Time).UTC(), v)
+			})
+		})
+
+		when("the values are read back with Milli", func(it bdd.It) {
+			fromMillis, okMillis := Millis.Milli(Millis.Value(ms))
+			fromSeconds, okSeconds := Seconds.Milli(Seconds.Value(ms))
+			fromDateTime, okDateTime := DateTime.Milli(DateTime.Value(ms))
+
+			it("should return ms for all formats", func(assert bdd.Assert) {
+				assert.True(okMillis && okSeconds && okDateTime)
+				assert.Equal(ms, fromMillis)
+				assert.Equal(ms, fromSeconds)
+				assert.Equal(ms, fromDateTime)
+			})
+		})
+	}, like(
+		s(timeFmt("22-03-2000 10:12:21")), s(timeFmt("15-06-1995 08:50:20")),
+	))
+}
+
+// Feature Store times with Handle on chosen format
+// - As a developer,
+// - I want Handle to write times on the format chosen,
+// - So that documents on collection have the representation I need.
+func Test_Store_times_with_Handle_on_chosen_format(t *testing.T) {
+	defer cleanChanges()
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a linked ProductHandle p using DateTime format at time %[1]v", func(when bdd.When, args ...interface{}) {
+		SetClock(FrozenClock(args[0].(time.Time)))
+		defer resetUtils()
+
+		p := newProductHandle()
+		p.SetTimeFormat(DateTime)
+
+		when("p.Insert() is called", func(it bdd.It) {
+			err := p.Insert()
+
+			var stored M
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				_ = db.C("products").FindId(p.Document().ID()).One(&stored)
+			})
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("should store created_on as time.Time", func(assert bdd.Assert) {
+				_, ok := stored["created_on"].(time.Time)
+				assert.True(ok)
+			})
+		})
+
+		when("p.Find() is called with the inserted id", func(it bdd.It) {
+			d, err := p.SetDocument(&product{
+				IDV: p.Document().ID(),
+			}).Find()
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("d.CreatedOn() should return %[1]v in milliseconds", func(assert bdd.Assert) {
+				assert.Equal(expectedNowInMilli(args[0].(time.Time)), d.CreatedOn())
+			})
+		})
+	}, like(
+		s(timeFmt("22-03-2000 10:12:21")), s(timeFmt("15-06-1995 08:50:20")),
+	))
+}
+
+// Feature Migrate times to another format
+// - As a developer,
+// - I want to convert times of documents already stored,
+// - So that I can change the format used on existing collections.
+func Test_Migrate_times_to_another_format(t *testing.T) {
+	defer cleanChanges()
+	given := bdd.Sentences().Given()
+
+	given(t, "a products collection with documents "+colFixtures+" stored with Millis", func(when bdd.When) {
+		when("n, err := MigrateTimeFormat('products', Millis, DateTime) is called", func(it bdd.It) {
+			n, err := MigrateTimeFormat("products", Millis, DateTime)
+
+			var stored M
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				_ = db.C("products").FindId(fixture(1).ID()).One(&stored)
+			})
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(err)
+			})
+			it("should have updated all documents", func(assert bdd.Assert) {
+				assert.Equal(len(fixtures), n)
+			})
+			it("should store created_on as time.Time", func(assert bdd.Assert) {
+				_, ok := stored["created_on"].(time.Time)
+				assert.True(ok)
+			})
+		})
+	})
+
+	given(t, "a products collection with documents "+colFixtures+" stored with Millis", func(when bdd.When) {
+		cleanChanges()
+
+		when("MigrateTimeFormat('products', Millis, Seconds) is called twice", func(it bdd.It) {
+			first, errFirst := MigrateTimeFormat("products", Millis, Seconds)
+			second, errSecond := MigrateTimeFormat("products", Millis, Seconds)
+
+			var stored M
+			ConsumeDatabaseOnSession(func(db *mgo.Database) {
+				_ = db.C("products").FindId(fixture(1).ID()).One(&stored)
+			})
+
+			it("should return no errors", func(assert bdd.Assert) {
+				assert.Nil(errFirst)
+				assert.Nil(errSecond)
+			})
+			it("should update the documents only on the first call", func(assert bdd.Assert) {
+				assert.Equal(len(fixtures), first)
+				assert.Equal(0, second)
+			})
+			it("should store created_on in seconds, converted once", func(assert bdd.Assert) {
+				assert.Equal(fixture(1).CreatedOn()/1000, stored["created_on"])
+			})
+			it("should leave no marks on documents", func(assert bdd.Assert) {
+				_, found := stored[migratingField]
+				assert.False(found)
+			})
+		})
+	})
+}
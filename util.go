@@ -1,21 +1,12 @@
 package mongo
 
 import (
-	"time"
+	"reflect"
 
 	"github.com/ddspog/mongo/internal/bsonutils"
 	"github.com/globalsign/mgo/bson"
 )
 
-var (
-	// now it's stores imported calculation of time for mocking
-	// purposes.
-	now = time.Now
-	// newID it's stores imported generation of new ids for documents
-	// for mocking purposes.
-	newID = bson.NewObjectId
-)
-
 // M is a convenient alias for a map[string]interface{} map, useful for
 // dealing with BSON in a native way.  For instance:
 //
@@ -41,52 +32,99 @@ func ObjectIdHex(s string) ObjectId {
 }
 
 // NowInMilli returns the actual time, in a int64 value in Millisecond
-// unit, used by the updaters of created_on and updated_on.
+// unit, used by the updaters of created_on and updated_on. The time is
+// told by the Clock defined with SetClock.
 func NowInMilli() (t int64) {
-	t = now().UnixNano() / int64(time.Millisecond)
+	t = inMilli(currentClock().Now())
 	return
 }
 
-// NewID generates a new id for documents.
+// NewID generates a new id for documents, using the IDGenerator
+// defined with SetIDGenerator.
 func NewID() (id bson.ObjectId) {
-	id = newID()
+	id = currentIDGenerator().NewID()
 	return
 }
 
+// documenterEncoder it's the Encoder used on documents, omitting empty
+// fields, so only the ones defined are stored or searched.
+var documenterEncoder = bsonutils.Encoder{OmitEmptyDefault: true}
+
 // InitDocumenter translates a M received, to the Documenter
 // structure received as a pointer. It fills the structure fields with
-// the values of each key in the M received.
+// the values of each key in the M received, decrypting the ones of
+// fields tagged with mongo:"encrypt". Documenters implementing Encoding
+// are read with the keys of their Encoder.
 func InitDocumenter(in M, out *Documenter) (err error) {
-	var marshalled []byte
+	err = InitDocumenterWith(decoderOf(*out), in, out)
+	return
+}
 
-	bsonutils.SetOmitEmptyAsDefault(true)
+// InitDocumenterWith translates a M received to the Documenter, as
+// done by InitDocumenter, unmarshalling it with dec. It allows types
+// tagged for other formats, or failing on unknown keys, when called by
+// their Init method.
+func InitDocumenterWith(dec Decoder, in M, out *Documenter) (err error) {
+	var marshalled []byte
+	var fields map[string]encryptedField
 
-	if marshalled, err = bsonutils.Marshal(in); err == nil {
-		err = bsonutils.Unmarshal(marshalled, *out)
+	if fields, err = encryptedFields(reflect.TypeOf(*out), dec); err != nil {
+		return
+	}
+	if len(fields) > 0 {
+		if in, err = decryptFields(in, fields); err != nil {
+			return
+		}
 	}
 
-	bsonutils.SetOmitEmptyAsDefault(false)
+	if marshalled, err = documenterEncoder.Marshal(in); err == nil {
+		err = dec.Unmarshal(marshalled, *out)
+	}
 
 	return
 }
 
 // MapDocumenter translates a Documenter in whatever structure
 // it has, to a M object, more easily read by mgo.Collection
-// methods.
+// methods. Fields tagged with mongo:"encrypt" are encrypted with the
+// KeyProvider defined by SetKeyProvider. Documenters implementing
+// Encoding are marshalled with their Encoder.
 func MapDocumenter(in Documenter) (out M, err error) {
-	var buf []byte
-	var target interface{}
+	out, err = MapDocumenterWith(encoderOf(in), in)
+	return
+}
 
-	bsonutils.SetOmitEmptyAsDefault(true)
+// MapDocumenterWith translates a Documenter to a M object, as done by
+// MapDocumenter, marshalling it with enc. It allows types tagged for
+// other formats, or with inline maps repeating their keys, when called
+// by their Map method. Empty fields are only omitted if enc has
+// OmitEmptyDefault.
+func MapDocumenterWith(enc Encoder, in Documenter) (out M, err error) {
+	var doc RawDocument
+	var target interface{}
 
-	if buf, err = bsonutils.Marshal(in); err == nil {
-		if err = bsonutils.Unmarshal(buf, &target); err == nil {
+	if doc, err = documenterRaw(enc, in); err == nil {
+		if err = bsonutils.Unmarshal(doc, &target); err == nil {
 			out = target.(M)
 		}
 	}
 
-	bsonutils.SetOmitEmptyAsDefault(false)
+	return
+}
+
+// documenterRaw returns the Documenter marshalled with enc, with the
+// fields tagged with mongo:"encrypt" encrypted. Documents written
+// elsewhere, like on Extended JSON or dumps, use it too, so they're
+// never written with those fields in plain text.
+func documenterRaw(enc Encoder, in Documenter) (doc RawDocument, err error) {
+	var fields map[string]encryptedField
+	if fields, err = encryptedFields(reflect.TypeOf(in), enc); err != nil {
+		return
+	}
 
+	if doc, err = enc.Marshal(in); err == nil && len(fields) > 0 {
+		doc, err = encryptRaw(doc, fields)
+	}
 	return
 }
 
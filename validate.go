@@ -0,0 +1,296 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnknownRule it's an error received when a validate tag uses a
+	// rule not known, or a rule with an invalid parameter.
+	ErrUnknownRule = errors.New("unknown validation rule")
+
+	// emailPattern it's the pattern of values accepted by email rule.
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// FieldError it's a problem found on a field validating a document.
+// Field it's the path of keys to field, like address.street.
+type FieldError struct {
+	Field string
+	Rule  string
+	Param string
+	Value interface{}
+}
+
+// Error returns a message describing the problem on field.
+func (e FieldError) Error() (s string) {
+	switch e.Rule {
+	case "required":
+		s = e.Field + " is required"
+	case "min", "max":
+		limit := "at least"
+		if e.Rule == "max" {
+			limit = "at most"
+		}
+
+		if hasLength(reflect.ValueOf(e.Value)) {
+			s = fmt.Sprintf("%s must have length %s %s", e.Field, limit, e.Param)
+		} else {
+			s = fmt.Sprintf("%s must be %s %s", e.Field, limit, e.Param)
+		}
+	case "email":
+		s = e.Field + " must be a valid email"
+	case "oneof":
+		s = fmt.Sprintf("%s must be one of [%s]", e.Field, e.Param)
+	default:
+		s = fmt.Sprintf("%s fails rule %s", e.Field, e.Rule)
+	}
+	return
+}
+
+// ValidationError it's an error received when a document has fields
+// failing the rules of its validate tags.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error returns a message describing the problems on all fields.
+func (e *ValidationError) Error() (s string) {
+	msgs := make([]string, len(e.Fields))
+	for i := range e.Fields {
+		msgs[i] = e.Fields[i].Error()
+	}
+
+	s = "invalid document: " + strings.Join(msgs, "; ")
+	return
+}
+
+// ValidateStruct checks the fields of struct v, or pointer to it,
+// against the rules on validate tags. Rules are separated by commas:
+//
+//     required   field can't have its zero value.
+//     min=n      numbers can't be lower than n, and strings, slices
+//                and maps can't be shorter than n. Strings are
+//                measured in characters, not bytes.
+//     max=n      numbers can't be greater than n, and strings, slices
+//                and maps can't be longer than n.
+//     email      strings must be an email.
+//     oneof=a b  field must be one of values separated by space.
+//
+// Empty values aren't checked by email and oneof, use required to
+// forbid them. Fields with struct types are checked too. It returns a
+// *ValidationError with the first rule failed by each field, named by
+// their keys, the ones of its Encoder if v implements Encoding.
+func ValidateStruct(v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			err = DocNotDefined
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		err = fmt.Errorf("can't validate %s, it isn't a struct", rv.Type())
+		return
+	}
+
+	var fields []FieldError
+	if fields, err = validateFields(rv, "", encoderOf(v)); err == nil && len(fields) > 0 {
+		err = &ValidationError{
+			Fields: fields,
+		}
+	}
+	return
+}
+
+// validateDocument checks d with ValidateStruct, when it's a struct,
+// and with its Validate method.
+func validateDocument(d Documenter) (err error) {
+	if reflect.Indirect(reflect.ValueOf(d)).Kind() == reflect.Struct {
+		err = ValidateStruct(d)
+	}
+
+	if err == nil {
+		err = d.Validate()
+	}
+	return
+}
+
+// validateFields checks the fields of struct rv, named with prefix and
+// their keys on keys.
+func validateFields(rv reflect.Value, prefix string, keys fieldKeyer) (fields []FieldError, err error) {
+	t := rv.Type()
+	for i := 0; i < t.NumField() && err == nil; i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		rules := sf.Tag.Get("validate")
+		if rules == "-" {
+			continue
+		}
+
+		name, inline := keys.FieldKey(sf)
+		if name == "-" {
+			continue
+		}
+
+		if inline {
+			name = strings.TrimSuffix(prefix, ".")
+		} else {
+			name = prefix + name
+		}
+
+		fv := rv.Field(i)
+		if rules != "" {
+			var found []FieldError
+			if found, err = validateField(fv, name, rules); err != nil {
+				return
+			}
+			fields = append(fields, found...)
+		}
+
+		if sv, ok := nestedStruct(fv); ok {
+			if inline {
+				name = prefix
+			} else {
+				name += "."
+			}
+
+			var found []FieldError
+			if found, err = validateFields(sv, name, keys); err == nil {
+				fields = append(fields, found...)
+			}
+		}
+	}
+	return
+}
+
+// nestedStruct returns the struct on field fv, to be checked too.
+func nestedStruct(fv reflect.Value) (sv reflect.Value, ok bool) {
+	sv = fv
+	if sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+
+	ok = sv.Kind() == reflect.Struct && sv.Type() != reflect.TypeOf(time.Time{})
+	return
+}
+
+// validateField checks field fv, named name, against rules. Only the
+// first rule failed it's reported.
+func validateField(fv reflect.Value, name, rules string) (fields []FieldError, err error) {
+	for _, rule := range strings.Split(rules, ",") {
+		param := ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			rule, param = rule[:i], rule[i+1:]
+		}
+
+		var ok bool
+		if ok, err = checkRule(fv, strings.TrimSpace(rule), param); err != nil {
+			err = fmt.Errorf("%w %s on field %s", err, rule, name)
+			return
+		}
+
+		if !ok {
+			fields = append(fields, FieldError{
+				Field: name,
+				Rule:  strings.TrimSpace(rule),
+				Param: param,
+				Value: fv.Interface(),
+			})
+			return
+		}
+	}
+	return
+}
+
+// checkRule returns if field fv follows rule with param.
+func checkRule(fv reflect.Value, rule, param string) (ok bool, err error) {
+	switch rule {
+	case "required":
+		ok = !fv.IsZero()
+	case "min", "max":
+		var limit, value float64
+		if limit, err = strconv.ParseFloat(param, 64); err != nil {
+			err = ErrUnknownRule
+			return
+		}
+
+		if value, ok = measure(fv); !ok {
+			err = ErrUnknownRule
+			return
+		}
+
+		if rule == "min" {
+			ok = value >= limit
+		} else {
+			ok = value <= limit
+		}
+	case "email":
+		if fv.Kind() != reflect.String {
+			err = ErrUnknownRule
+			return
+		}
+
+		ok = fv.Len() == 0 || emailPattern.MatchString(fv.String())
+	case "oneof":
+		value := fmt.Sprint(fv.Interface())
+		ok = fv.IsZero()
+		for _, option := range strings.Fields(param) {
+			ok = ok || option == value
+		}
+	default:
+		err = ErrUnknownRule
+	}
+	return
+}
+
+// hasLength checks if v it's a value measured by its length.
+func hasLength(v reflect.Value) (r bool) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		r = true
+	}
+	return
+}
+
+// measure returns the length or numeric value of v, compared on min
+// and max rules. It returns false if v can't be measured.
+func measure(v reflect.Value) (m float64, ok bool) {
+	ok = true
+
+	switch v.Kind() {
+	case reflect.String:
+		// Characters are counted, as done by minLength and maxLength
+		// of JSONSchema.
+		m = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		m = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		m = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		m = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		m = v.Float()
+	case reflect.Struct:
+		d, isDecimal := v.Interface().(Decimal128)
+		if ok = isDecimal && !d.IsNaN(); ok {
+			f, _ := d.BigFloat()
+			m, _ = f.Float64()
+		}
+	default:
+		ok = false
+	}
+	return
+}
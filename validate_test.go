@@ -0,0 +1,139 @@
+// +build !acceptance
+
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddspog/bdd"
+)
+
+// address it's a type nested on customer.
+type address struct {
+	Street string `bson:"street" validate:"required"`
+}
+
+// customer it's a type embedding the Document struct, with validate
+// tags.
+type customer struct {
+	Document `bson:",inline"`
+	NameV    string   `bson:"name" validate:"required,min=2,max=10"`
+	EmailV   string   `bson:"email" validate:"email"`
+	AgeV     int      `bson:"age" validate:"min=18"`
+	PlanV    string   `bson:"plan" validate:"oneof=free pro"`
+	TagsV    []string `bson:"tags" validate:"max=2"`
+	Address  *address `bson:"address"`
+}
+
+// New creates a new customer bound to its Document.
+func (c *customer) New() (doc Documenter) {
+	doc = Bind(&customer{})
+	return
+}
+
+// Validate checks for problems on customer.
+func (c *customer) Validate() (err error) {
+	return
+}
+
+// validCustomer returns a customer passing all rules.
+func validCustomer() (c *customer) {
+	c = &customer{
+		NameV:   "Jane",
+		EmailV:  "jane@example.com",
+		AgeV:    30,
+		PlanV:   "pro",
+		TagsV:   []string{"vip"},
+		Address: &address{Street: "Main St"},
+	}
+	return
+}
+
+// Feature Validate documents with struct tags
+// - As a developer,
+// - I want to declare validation rules on struct tags,
+// - So that I don't need to write Validate by hand.
+func Test_Validate_documents_with_struct_tags(t *testing.T) {
+	given, like, s := bdd.Sentences().All()
+
+	given(t, "a customer c with %[1]v", func(when bdd.When, args ...interface{}) {
+		c := validCustomer()
+		args[1].(func(*customer))(c)
+
+		when("ValidateStruct(c) is called", func(it bdd.It) {
+			err := ValidateStruct(c)
+
+			if args[2].(string) == "" {
+				it("should return no errors", func(assert bdd.Assert) {
+					assert.NoError(err)
+				})
+			} else {
+				var verr *ValidationError
+				ok := errors.As(err, &verr)
+
+				it("should return a *ValidationError", func(assert bdd.Assert) {
+					assert.True(ok)
+				})
+				it("should fail rule %[3]v on field %[4]v", func(assert bdd.Assert) {
+					assert.Len(verr.Fields, 1)
+					assert.Equal(args[2].(string), verr.Fields[0].Rule)
+					assert.Equal(args[3].(string), verr.Fields[0].Field)
+				})
+				it("should have message '%[5]v'", func(assert bdd.Assert) {
+					assert.EqualError(err, args[4].(string))
+				})
+			}
+		})
+	}, like(
+		s("all fields valid", func(c *customer) {}, "", "", ""),
+		s("no name", func(c *customer) { c.NameV = "" }, "required", "name", "invalid document: name is required"),
+		s("a short name", func(c *customer) { c.NameV = "J" }, "min", "name", "invalid document: name must have length at least 2"),
+		s("a long name", func(c *customer) { c.NameV = "Jane Mary Doe" }, "max", "name", "invalid document: name must have length at most 10"),
+		s("a name of 9 characters and 12 bytes", func(c *customer) { c.NameV = "João Açaí" }, "", "", ""),
+		s("an invalid email", func(c *customer) { c.EmailV = "jane" }, "email", "email", "invalid document: email must be a valid email"),
+		s("an age of 17", func(c *customer) { c.AgeV = 17 }, "min", "age", "invalid document: age must be at least 18"),
+		s("an unknown plan", func(c *customer) { c.PlanV = "gold" }, "oneof", "plan", "invalid document: plan must be one of [free pro]"),
+		s("three tags", func(c *customer) { c.TagsV = []string{"a", "b", "c"} }, "max", "tags", "invalid document: tags must have length at most 2"),
+		s("an address without street", func(c *customer) { c.Address.Street = "" }, "required", "address.street", "invalid document: address.street is required"),
+	))
+
+	given(t, "a customer c with no name and an age of 17", func(when bdd.When, args ...interface{}) {
+		c := validCustomer()
+		c.NameV, c.AgeV = "", 17
+
+		when("ValidateStruct(c) is called", func(it bdd.It) {
+			err := ValidateStruct(c)
+
+			it("should report both fields", func(assert bdd.Assert) {
+				assert.EqualError(err, "invalid document: name is required; age must be at least 18")
+			})
+		})
+
+		when("a Handle h receives c and h.Insert() is called", func(it bdd.It) {
+			h := NewHandle("customers", c)
+			err := h.Insert()
+
+			it("should return the *ValidationError", func(assert bdd.Assert) {
+				assert.Equal(ValidateStruct(c), err)
+			})
+			it("should return an error matching ErrValidation", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrValidation))
+			})
+		})
+	})
+
+	given(t, "a struct with an unknown rule", func(when bdd.When, args ...interface{}) {
+		v := struct {
+			NameV string `bson:"name" validate:"uppercase"`
+		}{}
+
+		when("ValidateStruct(v) is called", func(it bdd.It) {
+			err := ValidateStruct(v)
+
+			it("should return ErrUnknownRule", func(assert bdd.Assert) {
+				assert.True(errors.Is(err, ErrUnknownRule))
+			})
+		})
+	})
+}